@@ -3,6 +3,8 @@ package app
 import (
 	"fmt"
 	"github.com/EscanBE/go-lib/logging"
+	"github.com/EscanBE/go-lib/logging/logtest"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
 	"github.com/EscanBE/go-lib/test_utils"
 	"math/rand"
 	"strings"
@@ -135,3 +137,31 @@ func testTryRecoverAndExecuteExitFunctionIfRecovered2(t *testing.T, logger loggi
 
 	panic(panicMsg)
 }
+
+func TestTryRecoverAndExecuteExitFunctionIfRecovered_Logging(t *testing.T) {
+	t.Run("with exit function", func(t *testing.T) {
+		logger := logtest.NewCapturingLogger()
+		logger.DumpOnFailure(t)
+
+		testTryRecoverAndExecuteExitFunctionIfRecovered1(t, logger)
+
+		logger.ExpectErrorEntry(t, "Recovered from panic, executing exit function")
+		logger.ExpectErrorEntry(t, "Executed exit function, going to panic using recovered error")
+		logger.ExpectNoEntry(t, "", "Panic caught")
+	})
+
+	t.Run("without exit function", func(t *testing.T) {
+		logger := logtest.NewCapturingLogger()
+		logger.DumpOnFailure(t)
+
+		testTryRecoverAndExecuteExitFunctionIfRecovered2(t, logger)
+
+		if !logger.ExpectErrorEntry(t, "Panic caught") {
+			return
+		}
+		entry := logger.FindEntries(logtypes.LOG_LEVEL_ERROR, "Panic caught")[0]
+		if !strings.Contains(fmt.Sprintf("%v", entry.Fields["error"]), "fake panic") {
+			t.Errorf("want recovered error logged, got %v", entry.Fields["error"])
+		}
+	})
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"fmt"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
 	"github.com/EscanBE/go-lib/utils"
 )
 
@@ -43,3 +44,11 @@ func (c PostgresDatabaseConfig) Validate() error {
 	}
 	return nil
 }
+
+// Redacted returns a copy of the config with password replaced, safe for logging
+func (c PostgresDatabaseConfig) Redacted() interface{} {
+	if len(c.Password) > 0 {
+		c.Password = logtypes.REDACTED_VALUE
+	}
+	return c
+}
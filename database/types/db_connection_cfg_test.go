@@ -1,6 +1,7 @@
 package types
 
 import (
+	logtypes "github.com/EscanBE/go-lib/logging/types"
 	"github.com/EscanBE/go-lib/test_utils"
 	"testing"
 )
@@ -172,3 +173,31 @@ func TestPostgresDatabaseConfig_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestPostgresDatabaseConfig_Redacted(t *testing.T) {
+	c := PostgresDatabaseConfig{
+		Host:     "127.0.0.1",
+		Port:     5432,
+		Username: "postgres",
+		Password: "s3cr3t",
+		Name:     "postgres",
+	}
+
+	redacted, ok := c.Redacted().(PostgresDatabaseConfig)
+	if !ok {
+		t.Errorf("Redacted() must return PostgresDatabaseConfig")
+		return
+	}
+	if redacted.Password != logtypes.REDACTED_VALUE {
+		t.Errorf("Redacted() password = %s, want %s", redacted.Password, logtypes.REDACTED_VALUE)
+	}
+	if redacted.Host != c.Host || redacted.Username != c.Username || redacted.Name != c.Name {
+		t.Errorf("Redacted() must keep non-secret fields")
+	}
+	if c.Password != "s3cr3t" {
+		t.Errorf("Redacted() must not modify the original")
+	}
+	if (PostgresDatabaseConfig{}).Redacted().(PostgresDatabaseConfig).Password != "" {
+		t.Errorf("Redacted() should keep empty password as is")
+	}
+}
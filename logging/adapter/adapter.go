@@ -0,0 +1,29 @@
+// Package adapter routes output of other logging interfaces, like the standard library log package,
+// go-ethereum log and Telegram Bot API, into a logging.Logger.
+package adapter
+
+import (
+	"fmt"
+	"github.com/EscanBE/go-lib/logging"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+)
+
+// logFunc is the function of logging.Logger which logs at a specific level
+type logFunc func(msg string, keyVals ...interface{})
+
+// getLogFunc returns the function of the logger which logs at the provided level
+func getLogFunc(logger logging.Logger, level string) (logFunc, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger is required")
+	}
+	switch level {
+	case logtypes.LOG_LEVEL_DEBUG:
+		return logger.Debug, nil
+	case logtypes.LOG_LEVEL_INFO:
+		return logger.Info, nil
+	case logtypes.LOG_LEVEL_ERROR:
+		return logger.Error, nil
+	default:
+		return nil, fmt.Errorf("invalid logging level: %s", level)
+	}
+}
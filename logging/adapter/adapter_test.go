@@ -0,0 +1,67 @@
+package adapter
+
+import (
+	"encoding/json"
+	"github.com/EscanBE/go-lib/logging"
+	"github.com/EscanBE/go-lib/logging/logtest"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	gethlog "github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_getLogFunc(t *testing.T) {
+	logger := logtest.NewCapturingLogger()
+
+	_, err := getLogFunc(nil, logtypes.LOG_LEVEL_INFO)
+	require.Error(t, err)
+
+	for _, level := range []string{"", "warn", "Info"} {
+		_, err = getLogFunc(logger, level)
+		require.Errorf(t, err, "level: %s", level)
+	}
+
+	for _, level := range []string{logtypes.LOG_LEVEL_DEBUG, logtypes.LOG_LEVEL_INFO, logtypes.LOG_LEVEL_ERROR} {
+		fn, err := getLogFunc(logger, level)
+		require.NoError(t, err)
+		fn("message", "level", level)
+		logger.ExpectEntry(t, level, "message", "level", level)
+	}
+	require.Len(t, logger.Entries(), 3)
+}
+
+func TestAdapters_caller(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "caller.log")
+	logger := logging.NewDefaultLogger()
+	require.NoError(t, logger.ApplyConfig(logtypes.LoggingConfig{
+		Level:       logtypes.LOG_LEVEL_DEBUG,
+		Format:      logtypes.LOG_FORMAT_JSON,
+		Caller:      true,
+		FileOutputs: []logtypes.LoggingFileOutputConfig{{Path: logPath}},
+	}))
+	defer func() {
+		_ = logger.(io.Closer).Close()
+	}()
+
+	botLogger, err := NewTelegramBotLogger(logger)
+	require.NoError(t, err)
+	botLogger.Printf("via telegram bot logger")
+
+	handler, err := NewGethLogHandler(logger)
+	require.NoError(t, err)
+	require.NoError(t, handler.Log(&gethlog.Record{Lvl: gethlog.LvlInfo, Msg: "via geth handler"}))
+
+	content, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		require.Contains(t, entry[logtypes.LOG_FIELD_CALLER], "adapter/adapter_test.go:", "caller must be outside the adapters, got %s", line)
+	}
+}
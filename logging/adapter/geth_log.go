@@ -0,0 +1,78 @@
+package adapter
+
+import (
+	"fmt"
+	"github.com/EscanBE/go-lib/logging"
+	gethlog "github.com/ethereum/go-ethereum/log"
+	"reflect"
+)
+
+var (
+	_ gethlog.Handler = &gethLogHandler{}
+)
+
+// gethLogHandler is a go-ethereum log.Handler which routes records into a logging.Logger
+type gethLogHandler struct {
+	logger logging.Logger
+}
+
+// NewGethLogHandler returns a go-ethereum log.Handler which routes records into the logger,
+// context of the records are logged as key/values.
+// Levels are mapped as: Crit and Error to Error, Warn and Info to Info, Debug and Trace to Debug.
+func NewGethLogHandler(logger logging.Logger) (gethlog.Handler, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger is required")
+	}
+	return &gethLogHandler{
+		logger: logger,
+	}, nil
+}
+
+// Log implements go-ethereum log.Handler
+func (h *gethLogHandler) Log(r *gethlog.Record) error {
+	if r == nil {
+		return nil
+	}
+
+	keyVals := make([]interface{}, 0, len(r.Ctx))
+	for i, keyOrVal := range r.Ctx {
+		if lazy, ok := keyOrVal.(gethlog.Lazy); ok && i%2 == 1 {
+			keyOrVal = evaluateLazy(lazy)
+		}
+		keyVals = append(keyVals, keyOrVal)
+	}
+
+	switch r.Lvl {
+	case gethlog.LvlCrit, gethlog.LvlError:
+		h.logger.Error(r.Msg, keyVals...)
+	case gethlog.LvlWarn, gethlog.LvlInfo:
+		h.logger.Info(r.Msg, keyVals...)
+	default:
+		h.logger.Debug(r.Msg, keyVals...)
+	}
+	return nil
+}
+
+// evaluateLazy calls the function of the lazy value, same as go-ethereum does, returns the value or the failure as string
+func evaluateLazy(lazy gethlog.Lazy) (value interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			value = fmt.Sprintf("lazy value panic: %v", r)
+		}
+	}()
+
+	fnType := reflect.TypeOf(lazy.Fn)
+	if fnType == nil || fnType.Kind() != reflect.Func || fnType.NumIn() > 0 || fnType.NumOut() == 0 {
+		return fmt.Sprintf("invalid lazy function %T", lazy.Fn)
+	}
+
+	results := reflect.ValueOf(lazy.Fn).Call(nil)
+	if len(results) == 1 {
+		return results[0].Interface()
+	}
+	values := make([]interface{}, len(results))
+	for i, result := range results {
+		values[i] = result.Interface()
+	}
+	return values
+}
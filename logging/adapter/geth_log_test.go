@@ -0,0 +1,83 @@
+package adapter
+
+import (
+	"github.com/EscanBE/go-lib/logging/logtest"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	gethlog "github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewGethLogHandler(t *testing.T) {
+	_, err := NewGethLogHandler(nil)
+	require.Error(t, err)
+
+	tests := []struct {
+		gethLevel gethlog.Lvl
+		wantLevel string
+	}{
+		{gethLevel: gethlog.LvlCrit, wantLevel: logtypes.LOG_LEVEL_ERROR},
+		{gethLevel: gethlog.LvlError, wantLevel: logtypes.LOG_LEVEL_ERROR},
+		{gethLevel: gethlog.LvlWarn, wantLevel: logtypes.LOG_LEVEL_INFO},
+		{gethLevel: gethlog.LvlInfo, wantLevel: logtypes.LOG_LEVEL_INFO},
+		{gethLevel: gethlog.LvlDebug, wantLevel: logtypes.LOG_LEVEL_DEBUG},
+		{gethLevel: gethlog.LvlTrace, wantLevel: logtypes.LOG_LEVEL_DEBUG},
+	}
+	for _, tt := range tests {
+		t.Run(tt.gethLevel.String(), func(t *testing.T) {
+			logger := logtest.NewCapturingLogger()
+			handler, err := NewGethLogHandler(logger)
+			require.NoError(t, err)
+
+			require.NoError(t, handler.Log(&gethlog.Record{
+				Lvl: tt.gethLevel,
+				Msg: "Imported new chain segment",
+				Ctx: []interface{}{"blocks", 1, "number", uint64(100)},
+			}))
+			logger.ExpectEntry(t, tt.wantLevel, "Imported new chain segment", "blocks", 1, "number", uint64(100))
+		})
+	}
+
+	t.Run("nil record", func(t *testing.T) {
+		logger := logtest.NewCapturingLogger()
+		handler, err := NewGethLogHandler(logger)
+		require.NoError(t, err)
+		require.NoError(t, handler.Log(nil))
+		require.Empty(t, logger.Entries())
+	})
+
+	t.Run("lazy values are evaluated", func(t *testing.T) {
+		logger := logtest.NewCapturingLogger()
+		handler, err := NewGethLogHandler(logger)
+		require.NoError(t, err)
+
+		require.NoError(t, handler.Log(&gethlog.Record{
+			Lvl: gethlog.LvlInfo,
+			Msg: "lazy",
+			Ctx: []interface{}{
+				"string", gethlog.Lazy{Fn: func() string { return "evaluated" }},
+				"multi", gethlog.Lazy{Fn: func() (int, int) { return 1, 2 }},
+				"invalid", gethlog.Lazy{Fn: "not a func"},
+				"panic", gethlog.Lazy{Fn: func() int { panic("boom") }},
+			},
+		}))
+		entries := logger.Entries()
+		require.Len(t, entries, 1)
+		require.Equal(t, "evaluated", entries[0].Fields["string"])
+		require.Equal(t, []interface{}{1, 2}, entries[0].Fields["multi"])
+		require.Contains(t, entries[0].Fields["invalid"], "invalid lazy function")
+		require.Contains(t, entries[0].Fields["panic"], "boom")
+	})
+
+	t.Run("works as root handler of go-ethereum", func(t *testing.T) {
+		logger := logtest.NewCapturingLogger()
+		handler, err := NewGethLogHandler(logger)
+		require.NoError(t, err)
+
+		gethLogger := gethlog.New("module", "p2p")
+		gethLogger.SetHandler(handler)
+		gethLogger.Warn("Peer dropped", "peer", "abc")
+
+		logger.ExpectInfoEntry(t, "Peer dropped", "module", "p2p", "peer", "abc")
+	})
+}
@@ -0,0 +1,70 @@
+package adapter
+
+import (
+	"github.com/EscanBE/go-lib/logging"
+	"io"
+	"log"
+	"strings"
+)
+
+var (
+	_ io.Writer = &stdLogWriter{}
+)
+
+// stdLogWriter receives output of a standard library *log.Logger, each write is a line
+type stdLogWriter struct {
+	log logFunc
+}
+
+// Write implements io.Writer
+func (w *stdLogWriter) Write(p []byte) (n int, err error) {
+	msg := strings.TrimRight(string(p), "\r\n")
+	if len(msg) > 0 {
+		w.log(msg)
+	}
+	return len(p), nil
+}
+
+// NewStdLogger returns a standard library *log.Logger which logs every line into the logger at the provided level.
+// Useful for libraries which accept a *log.Logger, like http.Server.ErrorLog.
+func NewStdLogger(logger logging.Logger, level string) (*log.Logger, error) {
+	writer, err := NewStdLogWriter(logger, level)
+	if err != nil {
+		return nil, err
+	}
+	return log.New(writer, "", 0), nil
+}
+
+// NewStdLogWriter returns an io.Writer which logs every write into the logger at the provided level, trailing new line is trimmed
+func NewStdLogWriter(logger logging.Logger, level string) (io.Writer, error) {
+	fn, err := getLogFunc(logger, level)
+	if err != nil {
+		return nil, err
+	}
+	return &stdLogWriter{
+		log: fn,
+	}, nil
+}
+
+// RedirectStdLog redirects output of the standard library global logger into the logger at the provided level,
+// the returned function restores the previous output, flags and prefix.
+func RedirectStdLog(logger logging.Logger, level string) (restore func(), err error) {
+	writer, err := NewStdLogWriter(logger, level)
+	if err != nil {
+		return nil, err
+	}
+
+	prevOutput := log.Writer()
+	prevFlags := log.Flags()
+	prevPrefix := log.Prefix()
+
+	log.SetOutput(writer)
+	log.SetFlags(0) // time is added by the logger
+	log.SetPrefix("")
+
+	return func() {
+		log.SetOutput(prevOutput)
+		log.SetFlags(prevFlags)
+		log.SetPrefix(prevPrefix)
+	}, nil
+}
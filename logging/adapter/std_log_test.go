@@ -0,0 +1,79 @@
+package adapter
+
+import (
+	"bytes"
+	"github.com/EscanBE/go-lib/logging/logtest"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"github.com/stretchr/testify/require"
+	"log"
+	"testing"
+)
+
+func TestNewStdLogger(t *testing.T) {
+	_, err := NewStdLogger(nil, logtypes.LOG_LEVEL_INFO)
+	require.Error(t, err)
+	_, err = NewStdLogger(logtest.NewCapturingLogger(), "invalid")
+	require.Error(t, err)
+
+	logger := logtest.NewCapturingLogger()
+	stdLogger, err := NewStdLogger(logger, logtypes.LOG_LEVEL_ERROR)
+	require.NoError(t, err)
+
+	stdLogger.Printf("failed to accept connection: %s", "timeout")
+	stdLogger.Println("second line")
+	stdLogger.Print("")
+
+	entries := logger.Entries()
+	require.Len(t, entries, 2, "empty line should be ignored")
+	require.Equal(t, logtypes.LOG_LEVEL_ERROR, entries[0].Level)
+	require.Equal(t, "failed to accept connection: timeout", entries[0].Message, "trailing new line must be trimmed")
+	require.Equal(t, "second line", entries[1].Message)
+}
+
+func TestNewStdLogWriter(t *testing.T) {
+	_, err := NewStdLogWriter(nil, logtypes.LOG_LEVEL_INFO)
+	require.Error(t, err)
+
+	logger := logtest.NewCapturingLogger()
+	writer, err := NewStdLogWriter(logger, logtypes.LOG_LEVEL_DEBUG)
+	require.NoError(t, err)
+
+	n, err := writer.Write([]byte("hello\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, 7, n, "must report all bytes were written")
+	logger.ExpectDebugEntry(t, "hello")
+	require.Equal(t, "hello", logger.Entries()[0].Message)
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	_, err := RedirectStdLog(nil, logtypes.LOG_LEVEL_INFO)
+	require.Error(t, err)
+
+	prevOutput, prevFlags, prevPrefix := log.Writer(), log.Flags(), log.Prefix()
+	defer func() {
+		log.SetOutput(prevOutput)
+		log.SetFlags(prevFlags)
+		log.SetPrefix(prevPrefix)
+	}()
+
+	original := &bytes.Buffer{}
+	log.SetOutput(original)
+	log.SetFlags(log.LstdFlags)
+	log.SetPrefix("prefix ")
+
+	logger := logtest.NewCapturingLogger()
+	restore, err := RedirectStdLog(logger, logtypes.LOG_LEVEL_INFO)
+	require.NoError(t, err)
+
+	log.Println("redirected")
+	logger.ExpectInfoEntry(t, "redirected")
+	require.Equal(t, "redirected", logger.Entries()[0].Message, "flags and prefix must be removed")
+	require.Empty(t, original.String())
+
+	restore()
+	require.Equal(t, log.LstdFlags, log.Flags())
+	require.Equal(t, "prefix ", log.Prefix())
+	log.Println("restored")
+	require.Contains(t, original.String(), "restored")
+	require.Len(t, logger.Entries(), 1)
+}
@@ -0,0 +1,39 @@
+package adapter
+
+import (
+	"fmt"
+	"github.com/EscanBE/go-lib/logging"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+)
+
+var (
+	_ tgbotapi.BotLogger = &telegramBotLogger{}
+)
+
+// telegramBotLogger is a tgbotapi.BotLogger which routes output into a logging.Logger
+type telegramBotLogger struct {
+	logger logging.Logger
+}
+
+// NewTelegramBotLogger returns a tgbotapi.BotLogger which routes output into the logger, use it with tgbotapi.SetLogger.
+// Telegram Bot API library uses Println to report failures and Printf to dump requests and responses in debug mode,
+// so Println is mapped to Error and Printf is mapped to Debug.
+func NewTelegramBotLogger(logger logging.Logger) (tgbotapi.BotLogger, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger is required")
+	}
+	return &telegramBotLogger{
+		logger: logger,
+	}, nil
+}
+
+// Println implements tgbotapi.BotLogger, logs at level Error
+func (l *telegramBotLogger) Println(v ...interface{}) {
+	l.logger.Error(strings.TrimRight(fmt.Sprintln(v...), "\n"))
+}
+
+// Printf implements tgbotapi.BotLogger, logs at level Debug
+func (l *telegramBotLogger) Printf(format string, v ...interface{}) {
+	l.logger.Debug(strings.TrimRight(fmt.Sprintf(format, v...), "\n"))
+}
@@ -0,0 +1,30 @@
+package adapter
+
+import (
+	"errors"
+	"github.com/EscanBE/go-lib/logging/logtest"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewTelegramBotLogger(t *testing.T) {
+	_, err := NewTelegramBotLogger(nil)
+	require.Error(t, err)
+
+	logger := logtest.NewCapturingLogger()
+	botLogger, err := NewTelegramBotLogger(logger)
+	require.NoError(t, err)
+
+	botLogger.Println(errors.New("connection refused"))
+	botLogger.Println("Failed to get updates, retrying in 3 seconds...")
+	botLogger.Printf("Endpoint: %s, params: %v\n", "getMe", map[string]string{})
+
+	entries := logger.Entries()
+	require.Len(t, entries, 3)
+	logger.ExpectErrorEntry(t, "connection refused")
+	logger.ExpectErrorEntry(t, "Failed to get updates")
+	logger.ExpectDebugEntry(t, "Endpoint: getMe, params: map[]")
+	for _, entry := range entries {
+		require.NotContains(t, entry.Message, "\n", "trailing new line must be trimmed")
+	}
+}
@@ -0,0 +1,202 @@
+package logging
+
+import (
+	"context"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+)
+
+// contextKey is the type of keys which logging package uses to store values in context.Context
+type contextKey int
+
+const (
+	loggerContextKey contextKey = iota
+	fieldsContextKey
+	requestIdContextKey
+	traceIdContextKey
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// CONTEXT_FIELD_REQUEST_ID is the field name of request ID, added by context-aware log functions
+	CONTEXT_FIELD_REQUEST_ID = "request-id"
+
+	// CONTEXT_FIELD_TRACE_ID is the field name of trace ID, added by context-aware log functions
+	CONTEXT_FIELD_TRACE_ID = "trace-id"
+)
+
+// ContextWithLogger returns a copy of the context which carries the logger
+func ContextWithLogger(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey, logger)
+}
+
+// LoggerFromContext returns the logger carried by the context, or nil if none
+func LoggerFromContext(ctx context.Context) Logger {
+	if ctx == nil {
+		return nil
+	}
+	logger, _ := ctx.Value(loggerContextKey).(Logger)
+	return logger
+}
+
+// ContextWithFields returns a copy of the context which carries the key/values,
+// appended after the key/values carried by the parent context.
+// Value of a key which is already carried by the parent context is replaced in place, so a field is never carried twice.
+func ContextWithFields(ctx context.Context, keyVals ...interface{}) context.Context {
+	if len(keyVals) < 1 {
+		return ctx
+	}
+	parentKeyVals := FieldsFromContext(ctx)
+	merged := make([]interface{}, 0, len(parentKeyVals)+len(keyVals))
+	merged = append(merged, parentKeyVals...)
+	for i := 0; i < len(keyVals); i += 2 {
+		if i+1 >= len(keyVals) {
+			merged = append(merged, keyVals[i])
+			break
+		}
+		if index := indexOfFieldKey(merged[:len(parentKeyVals)], keyVals[i]); index >= 0 {
+			merged[index+1] = keyVals[i+1]
+			continue
+		}
+		merged = append(merged, keyVals[i], keyVals[i+1])
+	}
+	return context.WithValue(ctx, fieldsContextKey, merged)
+}
+
+// indexOfFieldKey returns index of the string key within the key/values, -1 if not found or the key is not a string
+func indexOfFieldKey(keyVals []interface{}, key interface{}) int {
+	strKey, ok := key.(string)
+	if !ok {
+		return -1
+	}
+	for i := 0; i+1 < len(keyVals); i += 2 {
+		if existing, ok := keyVals[i].(string); ok && existing == strKey {
+			return i
+		}
+	}
+	return -1
+}
+
+// FieldsFromContext returns the key/values carried by the context
+func FieldsFromContext(ctx context.Context) []interface{} {
+	if ctx == nil {
+		return nil
+	}
+	keyVals, _ := ctx.Value(fieldsContextKey).([]interface{})
+	return keyVals
+}
+
+// ContextWithRequestId returns a copy of the context which carries the request ID
+func ContextWithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdContextKey, requestId)
+}
+
+// RequestIdFromContext returns the request ID carried by the context, or empty if none
+func RequestIdFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestId, _ := ctx.Value(requestIdContextKey).(string)
+	return requestId
+}
+
+// ContextWithTraceId returns a copy of the context which carries the trace ID
+func ContextWithTraceId(ctx context.Context, traceId string) context.Context {
+	return context.WithValue(ctx, traceIdContextKey, traceId)
+}
+
+// TraceIdFromContext returns the trace ID carried by the context, or empty if none
+func TraceIdFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	traceId, _ := ctx.Value(traceIdContextKey).(string)
+	return traceId
+}
+
+// InfoCtx logs at level Info using the logger carried by the context, with request ID, trace ID and the fields it carries.
+// It does nothing if the context does not carry any logger.
+func InfoCtx(ctx context.Context, msg string, keyVals ...interface{}) {
+	if logger := LoggerFromContext(ctx); logger != nil {
+		logger.Info(msg, contextKeyVals(ctx, keyVals)...)
+	}
+}
+
+// DebugCtx logs at level Debug using the logger carried by the context, with request ID, trace ID and the fields it carries.
+// It does nothing if the context does not carry any logger.
+func DebugCtx(ctx context.Context, msg string, keyVals ...interface{}) {
+	if logger := LoggerFromContext(ctx); logger != nil {
+		logger.Debug(msg, contextKeyVals(ctx, keyVals)...)
+	}
+}
+
+// ErrorCtx logs at level Error using the logger carried by the context, with request ID, trace ID and the fields it carries.
+// It does nothing if the context does not carry any logger.
+func ErrorCtx(ctx context.Context, msg string, keyVals ...interface{}) {
+	if logger := LoggerFromContext(ctx); logger != nil {
+		logger.Error(msg, contextKeyVals(ctx, keyVals)...)
+	}
+}
+
+// contextKeyVals returns request ID, trace ID and fields carried by the context, followed by the provided key/values
+func contextKeyVals(ctx context.Context, keyVals []interface{}) []interface{} {
+	contextFields := FieldsFromContext(ctx)
+	result := make([]interface{}, 0, 4+len(contextFields)+len(keyVals))
+	if requestId := RequestIdFromContext(ctx); len(requestId) > 0 {
+		result = append(result, CONTEXT_FIELD_REQUEST_ID, requestId)
+	}
+	if traceId := TraceIdFromContext(ctx); len(traceId) > 0 {
+		result = append(result, CONTEXT_FIELD_TRACE_ID, traceId)
+	}
+	result = append(result, contextFields...)
+	result = append(result, keyVals...)
+	return result
+}
+
+var (
+	_ Logger = &contextLogger{}
+)
+
+// contextLogger wraps a Logger, adds request ID, trace ID and fields carried by a context into every entry
+type contextLogger struct {
+	ctx    context.Context
+	logger Logger
+}
+
+// WithContext returns a Logger which adds request ID, trace ID and fields carried by the context into every entry,
+// useful to pass to components which accept a Logger but not a context.Context
+func WithContext(ctx context.Context, logger Logger) Logger {
+	return &contextLogger{
+		ctx:    ctx,
+		logger: logger,
+	}
+}
+
+// SetLogLevel implements Logger
+func (c *contextLogger) SetLogLevel(level string) error {
+	return c.logger.SetLogLevel(level)
+}
+
+// SetLogFormat implements Logger
+func (c *contextLogger) SetLogFormat(format string) error {
+	return c.logger.SetLogFormat(format)
+}
+
+// Info implements Logger
+func (c *contextLogger) Info(msg string, keyVals ...interface{}) {
+	c.logger.Info(msg, contextKeyVals(c.ctx, keyVals)...)
+}
+
+// Debug implements Logger
+func (c *contextLogger) Debug(msg string, keyVals ...interface{}) {
+	c.logger.Debug(msg, contextKeyVals(c.ctx, keyVals)...)
+}
+
+// Error implements Logger
+func (c *contextLogger) Error(msg string, keyVals ...interface{}) {
+	c.logger.Error(msg, contextKeyVals(c.ctx, keyVals)...)
+}
+
+// ApplyConfig implements Logger
+func (c *contextLogger) ApplyConfig(config logtypes.LoggingConfig) error {
+	return c.logger.ApplyConfig(config)
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"context"
+	"github.com/EscanBE/go-lib/logging/logtest"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"github.com/EscanBE/go-lib/test_utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestContextWithLogger(t *testing.T) {
+	require.Nil(t, LoggerFromContext(context.Background()))
+
+	logger := logtest.NewCapturingLogger()
+	ctx := ContextWithLogger(context.Background(), logger)
+	require.Equal(t, logger, LoggerFromContext(ctx))
+	childCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	require.Equal(t, logger, LoggerFromContext(childCtx), "must be inherited by children")
+}
+
+func TestContextWithFields(t *testing.T) {
+	require.Nil(t, FieldsFromContext(context.Background()))
+
+	parent := ContextWithFields(context.Background(), "a", 1)
+	child := ContextWithFields(parent, "b", 2)
+
+	require.Equal(t, []interface{}{"a", 1}, FieldsFromContext(parent), "parent must not be affected")
+	require.Equal(t, []interface{}{"a", 1, "b", 2}, FieldsFromContext(child))
+	require.Equal(t, child, ContextWithFields(child), "no key/values returns the same context")
+
+	replaced := ContextWithFields(child, "a", 3, "c", 4)
+	require.Equal(t, []interface{}{"a", 3, "b", 2, "c", 4}, FieldsFromContext(replaced), "carried key must be replaced in place")
+	require.Equal(t, []interface{}{"a", 1, "b", 2}, FieldsFromContext(child), "parent must not be affected")
+	require.Equal(t, []interface{}{"a", 1, "b", 2, "odd"}, FieldsFromContext(ContextWithFields(child, "odd")))
+}
+
+func TestContextWithRequestIdAndTraceId(t *testing.T) {
+	ctx := context.Background()
+	require.Empty(t, RequestIdFromContext(ctx))
+	require.Empty(t, TraceIdFromContext(ctx))
+
+	ctx = ContextWithTraceId(ContextWithRequestId(ctx, "req"), "trace")
+	require.Equal(t, "req", RequestIdFromContext(ctx))
+	require.Equal(t, "trace", TraceIdFromContext(ctx))
+}
+
+func TestInfoCtx_DebugCtx_ErrorCtx(t *testing.T) {
+	t.Run("without logger does nothing", func(t *testing.T) {
+		defer test_utils.DeferWantNoPanic(t)
+
+		InfoCtx(context.Background(), "info")
+		DebugCtx(context.Background(), "debug")
+		ErrorCtx(context.Background(), "error")
+	})
+
+	t.Run("adds request ID, trace ID and bound fields", func(t *testing.T) {
+		logger := logtest.NewCapturingLogger()
+		logger.DumpOnFailure(t)
+
+		ctx := ContextWithLogger(context.Background(), logger)
+		ctx = ContextWithRequestId(ctx, "req-1")
+		ctx = ContextWithTraceId(ctx, "trace-1")
+		ctx = ContextWithFields(ctx, "chat-id", 100)
+
+		InfoCtx(ctx, "info", "k", "v")
+		DebugCtx(ctx, "debug")
+		ErrorCtx(ctx, "error")
+
+		for _, level := range []string{logtypes.LOG_LEVEL_INFO, logtypes.LOG_LEVEL_DEBUG, logtypes.LOG_LEVEL_ERROR} {
+			logger.ExpectEntry(t, level, level, CONTEXT_FIELD_REQUEST_ID, "req-1", CONTEXT_FIELD_TRACE_ID, "trace-1", "chat-id", 100)
+		}
+		logger.ExpectInfoEntry(t, "info", "k", "v")
+	})
+
+	t.Run("without IDs", func(t *testing.T) {
+		logger := logtest.NewCapturingLogger()
+		InfoCtx(ContextWithLogger(context.Background(), logger), "info")
+
+		entries := logger.Entries()
+		require.Len(t, entries, 1)
+		require.Empty(t, entries[0].Fields)
+	})
+}
+
+func TestWithContext(t *testing.T) {
+	logger := logtest.NewCapturingLogger()
+	logger.DumpOnFailure(t)
+
+	ctx := ContextWithFields(ContextWithRequestId(context.Background(), "req-2"), "update-id", 5)
+	ctxLogger := WithContext(ctx, logger)
+
+	ctxLogger.Info("info")
+	ctxLogger.Debug("debug")
+	ctxLogger.Error("error", "k", "v")
+
+	logger.ExpectInfoEntry(t, "info", CONTEXT_FIELD_REQUEST_ID, "req-2", "update-id", 5)
+	logger.ExpectDebugEntry(t, "debug", CONTEXT_FIELD_REQUEST_ID, "req-2", "update-id", 5)
+	logger.ExpectErrorEntry(t, "error", CONTEXT_FIELD_REQUEST_ID, "req-2", "update-id", 5, "k", "v")
+
+	require.NoError(t, ctxLogger.SetLogLevel(logtypes.LOG_LEVEL_ERROR))
+	require.Equal(t, logtypes.LOG_LEVEL_ERROR, logger.GetLogLevel())
+	require.NoError(t, ctxLogger.SetLogFormat(logtypes.LOG_FORMAT_TEXT))
+	require.Equal(t, logtypes.LOG_FORMAT_TEXT, logger.GetLogFormat())
+	require.NoError(t, ctxLogger.ApplyConfig(logtypes.LoggingConfig{Level: logtypes.LOG_LEVEL_INFO}))
+	require.Equal(t, logtypes.LOG_LEVEL_INFO, logger.GetLogLevel())
+}
@@ -3,30 +3,37 @@ package logging
 import (
 	"fmt"
 	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"io"
 	"os"
 	"time"
 
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 )
 
 var (
-	_ Logger = &defaultLogger{}
+	_ Logger    = &defaultLogger{}
+	_ io.Closer = &defaultLogger{}
 )
 
 // defaultLogger represents the default logger for any kind of error
 type defaultLogger struct {
-	Logger zerolog.Logger
+	Logger      zerolog.Logger
+	format      string                // output format, json, text or logfmt
+	stdOut      io.Writer             // standard output, log entries are always written into it, regardless file outputs
+	fileOutputs []*RotatingFileWriter // additional file outputs, provided via LoggingConfig
+	options     entryOptions          // caller, stack trace, timestamp, static fields and sampling, provided via LoggingConfig
+	stopSummary func()                // stops the summary of entries dropped by sampling, nil if not started
 }
 
-// NewDefaultLogger builds a new defaultLogger instance
+// NewDefaultLogger builds a new defaultLogger instance.
+// The returned Logger also implements io.Closer, which closes the file outputs if any.
 func NewDefaultLogger() Logger {
-	zerolog.TimestampFunc = func() time.Time {
-		return time.Now().UTC()
-	}
 	result := &defaultLogger{
-		Logger: log.Logger,
+		format:  logtypes.LOG_FORMAT_DEFAULT,
+		stdOut:  os.Stderr,
+		options: defaultEntryOptions(),
 	}
+	result.rebuild()
 	_ = result.SetLogLevel(logtypes.LOG_LEVEL_DEFAULT)
 	return result
 }
@@ -50,29 +57,70 @@ func (d *defaultLogger) SetLogFormat(format string) error {
 		break
 
 	case logtypes.LOG_FORMAT_TEXT:
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+		break
+
+	case logtypes.LOG_FORMAT_LOGFMT:
 		break
 
 	default:
 		return fmt.Errorf("invalid logging format: %s", format)
 	}
 
+	d.format = format
+	d.rebuild()
 	return nil
 }
 
 // Info implements Logger
 func (d *defaultLogger) Info(msg string, keyVals ...interface{}) {
-	d.Logger.Info().Fields(getLogFields(keyVals...)).Msg(msg)
+	d.write(d.Logger.Info(), logtypes.LOG_LEVEL_INFO, msg, keyVals)
 }
 
 // Debug implements Logger
 func (d *defaultLogger) Debug(msg string, keyVals ...interface{}) {
-	d.Logger.Debug().Fields(getLogFields(keyVals...)).Msg(msg)
+	d.write(d.Logger.Debug(), logtypes.LOG_LEVEL_DEBUG, msg, keyVals)
 }
 
 // Error implements Logger
 func (d *defaultLogger) Error(msg string, keyVals ...interface{}) {
-	d.Logger.Error().Fields(getLogFields(keyVals...)).Msg(msg)
+	d.write(d.Logger.Error(), logtypes.LOG_LEVEL_ERROR, msg, keyVals)
+}
+
+// write sends the entry, unless it is dropped by sampling
+func (d *defaultLogger) write(event *zerolog.Event, level string, msg string, keyVals []interface{}) {
+	if event == nil {
+		// level disabled
+		return
+	}
+	if !d.options.sample(level, msg) {
+		return
+	}
+	d.send(event, level, msg, keyVals)
+}
+
+// writeSamplingSummary sends the summary of entries dropped by sampling, bypassing sampling
+func (d *defaultLogger) writeSamplingSummary(level, msg string, keyVals []interface{}) {
+	var event *zerolog.Event
+	switch level {
+	case logtypes.LOG_LEVEL_ERROR:
+		event = d.Logger.Error()
+	case logtypes.LOG_LEVEL_DEBUG:
+		event = d.Logger.Debug()
+	default:
+		event = d.Logger.Info()
+	}
+	if event == nil {
+		// level disabled
+		return
+	}
+	d.send(event, level, msg, keyVals)
+}
+
+// send fills the event with timestamp, redacted fields and message then sends it
+func (d *defaultLogger) send(event *zerolog.Event, level string, msg string, keyVals []interface{}) {
+	d.options.timestamp.appendTo(event, time.Now()).
+		Fields(d.options.buildFields(level, keyVals)).
+		Msg(scrubSecrets(msg))
 }
 
 // ApplyConfig implements Logger
@@ -81,28 +129,141 @@ func (d *defaultLogger) ApplyConfig(config logtypes.LoggingConfig) error {
 	if validationErr != nil {
 		return validationErr
 	}
+
+	// report the entries dropped by the previous sampling config, before the outputs are changed
+	d.stopSamplingSummary()
+
 	if len(config.Level) > 0 {
 		_ = d.SetLogLevel(config.Level) // shouldn't err, validated before
 	}
 	if len(config.Format) > 0 {
 		_ = d.SetLogFormat(config.Format) // shouldn't err, validated before
 	}
+
+	d.options = newEntryOptions(config)
+
+	fileOutputs := make([]*RotatingFileWriter, 0, len(config.FileOutputs))
+	for _, fileOutputConfig := range config.FileOutputs {
+		fileOutput, err := NewRotatingFileWriter(fileOutputConfig)
+		if err != nil {
+			for _, opened := range fileOutputs {
+				_ = opened.Close()
+			}
+			return err
+		}
+		fileOutputs = append(fileOutputs, fileOutput)
+	}
+
+	_ = d.closeFileOutputs()
+	d.fileOutputs = fileOutputs
+	d.rebuild()
+	d.stopSummary = d.options.startSamplingSummary(d.writeSamplingSummary)
 	return nil
 }
 
-func getLogFields(keyVals ...interface{}) map[string]interface{} {
+// Close implements io.Closer, reports the entries dropped by sampling then closes the file outputs if any,
+// log entries will only be written into the standard output afterward
+func (d *defaultLogger) Close() error {
+	d.stopSamplingSummary()
+	err := d.closeFileOutputs()
+	d.rebuild()
+	return err
+}
+
+// rebuild re-creates the underlying zerolog.Logger, based on the current format and outputs.
+// Timestamp is added by write, using the configured format and time zone.
+func (d *defaultLogger) rebuild() {
+	stdOut := d.formattedWriter(d.stdOut, true)
+
+	if len(d.fileOutputs) < 1 {
+		d.Logger = zerolog.New(stdOut)
+		return
+	}
+
+	writers := []io.Writer{stdOut}
+	for _, fileOutput := range d.fileOutputs {
+		writers = append(writers, d.formattedWriter(fileOutput, false))
+	}
+	d.Logger = zerolog.New(zerolog.MultiLevelWriter(writers...))
+}
+
+// formattedWriter wraps the output, to convert JSON produced by zerolog into the current format
+func (d *defaultLogger) formattedWriter(out io.Writer, colorized bool) io.Writer {
+	switch d.format {
+	case logtypes.LOG_FORMAT_TEXT:
+		consoleWriter := zerolog.ConsoleWriter{Out: out, NoColor: !colorized}
+		if d.options.timestamp.explicit {
+			// already formatted, do not let the console writer re-format it
+			consoleWriter.FormatTimestamp = func(i interface{}) string {
+				return stringifyValue(i)
+			}
+		}
+		return consoleWriter
+	case logtypes.LOG_FORMAT_LOGFMT:
+		return logfmtWriter{out: out}
+	default:
+		return out
+	}
+}
+
+// stopSamplingSummary stops the summary of entries dropped by sampling if started, the remaining dropped entries are reported
+func (d *defaultLogger) stopSamplingSummary() {
+	if d.stopSummary != nil {
+		d.stopSummary()
+		d.stopSummary = nil
+	}
+}
+
+// closeFileOutputs closes and releases all the file outputs
+func (d *defaultLogger) closeFileOutputs() error {
+	var err error
+	for _, fileOutput := range d.fileOutputs {
+		if errClose := fileOutput.Close(); errClose != nil && err == nil {
+			err = errClose
+		}
+	}
+	d.fileOutputs = nil
+	return err
+}
+
+// getLogFields converts the key/values pairs into fields.
+// In lenient mode, it never panic: the dangling value of an odd number of key/values will be put under the key `!BADKEY`
+// and non-string keys will be stringified.
+// In strict mode, it panics on malformed key/values.
+func getLogFields(strict bool, keyVals ...interface{}) map[string]interface{} {
 	if len(keyVals) < 1 {
 		return nil
 	}
 
-	if len(keyVals)%2 != 0 {
+	if len(keyVals)%2 != 0 && strict {
 		panic(fmt.Errorf("number of argument should be even"))
 	}
 
 	fields := make(map[string]interface{})
 	for i := 0; i < len(keyVals); i += 2 {
-		fields[keyVals[i].(string)] = keyVals[i+1]
+		if i+1 >= len(keyVals) {
+			fields[badKey] = keyVals[i]
+			break
+		}
+
+		key, isString := keyVals[i].(string)
+		if !isString {
+			if strict {
+				panic(fmt.Errorf("key must be string, got %T", keyVals[i]))
+			}
+			key = stringifyKey(keyVals[i])
+		}
+		fields[key] = keyVals[i+1]
 	}
 
 	return fields
 }
+
+// badKey is the key of the dangling value when the number of key/values is odd
+const badKey = "!BADKEY"
+
+// stringifyKey converts a non-string key into string.
+// fmt is used instead of calling String() or Error() directly, since it recovers from panics of typed-nil receivers and prints <nil>.
+func stringifyKey(key interface{}) string {
+	return fmt.Sprintf("%v", key)
+}
@@ -1,11 +1,18 @@
 package logging
 
 import (
+	"bytes"
 	logtypes "github.com/EscanBE/go-lib/logging/types"
 	"github.com/EscanBE/go-lib/test_utils"
 	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/url"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewDefaultLogger(t *testing.T) {
@@ -99,6 +106,11 @@ func Test_defaultLogger_SetLogFormat(t *testing.T) {
 			format:  logtypes.LOG_FORMAT_TEXT,
 			wantErr: false,
 		},
+		{
+			name:    "logfmt",
+			format:  logtypes.LOG_FORMAT_LOGFMT,
+			wantErr: false,
+		},
 		{
 			name:    "invalid",
 			format:  logtypes.LOG_FORMAT_DEFAULT + "-invalid",
@@ -178,12 +190,96 @@ func Test_defaultLogger_ApplyConfig(t *testing.T) {
 	}
 }
 
+func Test_defaultLogger_LogfmtFormat(t *testing.T) {
+	logger := NewDefaultLogger().(*defaultLogger)
+	stdOut := &bytes.Buffer{}
+	logger.stdOut = stdOut
+	require.NoError(t, logger.SetLogFormat(logtypes.LOG_FORMAT_LOGFMT))
+
+	logger.Info("hello world", "k", "v")
+	require.Contains(t, stdOut.String(), `level=info msg="hello world" k=v`)
+}
+
+func Test_defaultLogger_ApplyConfig_FileOutputs(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "json.log")
+	textPath := filepath.Join(dir, "text.log")
+
+	logger := NewDefaultLogger().(*defaultLogger)
+	stdOut := &bytes.Buffer{}
+	logger.stdOut = stdOut
+	defer func() {
+		_ = logger.Close()
+	}()
+
+	err := logger.ApplyConfig(logtypes.LoggingConfig{
+		Level:  logtypes.LOG_LEVEL_INFO,
+		Format: logtypes.LOG_FORMAT_JSON,
+		FileOutputs: []logtypes.LoggingFileOutputConfig{
+			{Path: jsonPath},
+		},
+	})
+	require.NoError(t, err)
+	logger.Info("json entry", "k", "v")
+
+	require.Contains(t, stdOut.String(), `"message":"json entry"`)
+	require.Contains(t, readFile(t, jsonPath), `"message":"json entry"`)
+	require.Contains(t, readFile(t, jsonPath), `"k":"v"`)
+
+	// re-apply closes the previous file outputs
+	err = logger.ApplyConfig(logtypes.LoggingConfig{
+		Format: logtypes.LOG_FORMAT_TEXT,
+		FileOutputs: []logtypes.LoggingFileOutputConfig{
+			{Path: textPath},
+		},
+	})
+	require.NoError(t, err)
+	logger.Info("text entry", "k", "v")
+
+	require.NotContains(t, readFile(t, jsonPath), "text entry")
+	textContent := readFile(t, textPath)
+	require.Contains(t, textContent, "text entry")
+	require.Contains(t, textContent, "k=v")
+	require.False(t, strings.Contains(textContent, "\x1b["), "file output must not be colorized")
+
+	// closed logger still writes into standard output
+	var closer io.Closer = logger
+	require.NoError(t, closer.Close())
+	stdOut.Reset()
+	logger.Info("after closed")
+	require.Contains(t, stdOut.String(), "after closed")
+	require.NotContains(t, readFile(t, textPath), "after closed")
+
+	t.Run("invalid file output", func(t *testing.T) {
+		err := NewDefaultLogger().ApplyConfig(logtypes.LoggingConfig{
+			FileOutputs: []logtypes.LoggingFileOutputConfig{
+				{Path: ""},
+			},
+		})
+		require.Error(t, err)
+	})
+}
+
+type testStringerKey struct{}
+
+func (testStringerKey) String() string {
+	return "stringer-key"
+}
+
+type testErrorKey struct {
+	msg string
+}
+
+func (e *testErrorKey) Error() string {
+	return e.msg
+}
+
 func Test_getLogFields(t *testing.T) {
 	tests := []struct {
-		name      string
-		input     []interface{}
-		want      map[string]interface{}
-		wantPanic bool
+		name            string
+		input           []interface{}
+		want            map[string]interface{}
+		wantStrictPanic bool
 	}{
 		{
 			name:  "success",
@@ -191,9 +287,28 @@ func Test_getLogFields(t *testing.T) {
 			want:  map[string]interface{}{"k": "v"},
 		},
 		{
-			name:      "key must be string",
-			input:     []interface{}{666, 999},
-			wantPanic: true,
+			name:            "non-string key will be stringified",
+			input:           []interface{}{666, 999},
+			want:            map[string]interface{}{"666": 999},
+			wantStrictPanic: true,
+		},
+		{
+			name:            "stringer key",
+			input:           []interface{}{testStringerKey{}, 1, nil, 2},
+			want:            map[string]interface{}{"stringer-key": 1, "<nil>": 2},
+			wantStrictPanic: true,
+		},
+		{
+			name:            "typed-nil stringer key",
+			input:           []interface{}{(*url.URL)(nil), 1},
+			want:            map[string]interface{}{"<nil>": 1},
+			wantStrictPanic: true,
+		},
+		{
+			name:            "typed-nil error key",
+			input:           []interface{}{(*testErrorKey)(nil), 1},
+			want:            map[string]interface{}{"<nil>": 1},
+			wantStrictPanic: true,
 		},
 		{
 			name:  "empty success return nil",
@@ -201,18 +316,174 @@ func Test_getLogFields(t *testing.T) {
 			want:  nil,
 		},
 		{
-			name:      "panic when number of args is not an even number",
-			input:     []interface{}{"1"},
-			wantPanic: true,
+			name:            "dangling value when number of args is not an even number",
+			input:           []interface{}{"1"},
+			want:            map[string]interface{}{badKey: "1"},
+			wantStrictPanic: true,
+		},
+		{
+			name:            "dangling value after valid pairs",
+			input:           []interface{}{"k", "v", "dangling"},
+			want:            map[string]interface{}{"k": "v", badKey: "dangling"},
+			wantStrictPanic: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			defer test_utils.DeferWantPanicDepends(t, tt.wantPanic)
+			t.Run("lenient", func(t *testing.T) {
+				defer test_utils.DeferWantNoPanic(t)
 
-			if got := getLogFields(tt.input...); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("getLogFields() = %v, want %v", got, tt.want)
-			}
+				if got := getLogFields(false, tt.input...); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("getLogFields() = %v, want %v", got, tt.want)
+				}
+			})
+			t.Run("strict", func(t *testing.T) {
+				defer test_utils.DeferWantPanicDepends(t, tt.wantStrictPanic)
+
+				got := getLogFields(true, tt.input...)
+				if !tt.wantStrictPanic && !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("getLogFields() = %v, want %v", got, tt.want)
+				}
+			})
 		})
 	}
 }
+
+func Test_defaultLogger_StrictKeyValues(t *testing.T) {
+	logger := NewDefaultLogger().(*defaultLogger)
+	logger.stdOut = io.Discard
+	logger.rebuild()
+
+	t.Run("lenient by default", func(t *testing.T) {
+		defer test_utils.DeferWantNoPanic(t)
+
+		logger.Info("odd", "k")
+		logger.Error("non-string key", 1, "v")
+	})
+
+	require.NoError(t, logger.ApplyConfig(logtypes.LoggingConfig{StrictKeyValues: true}))
+
+	t.Run("strict when configured", func(t *testing.T) {
+		defer test_utils.DeferWantPanic(t)
+
+		logger.Info("odd", "k")
+	})
+}
+
+func Test_defaultLogger_ApplyConfig_EntryOptions(t *testing.T) {
+	logger := NewDefaultLogger().(*defaultLogger)
+	stdOut := &bytes.Buffer{}
+	logger.stdOut = stdOut
+
+	require.NoError(t, logger.ApplyConfig(logtypes.LoggingConfig{
+		Level:             logtypes.LOG_LEVEL_INFO,
+		Format:            logtypes.LOG_FORMAT_JSON,
+		Caller:            true,
+		StackTraceOnError: true,
+		TimestampFormat:   logtypes.LOG_TIMESTAMP_FORMAT_UNIX,
+		StaticFields:      map[string]string{"service": "api"},
+	}))
+
+	logger.Info("info entry", "k", "v")
+	output := stdOut.String()
+	require.Contains(t, output, `"service":"api"`)
+	require.Contains(t, output, `"caller":"logging/default_logger_test.go:`)
+	require.Regexp(t, `"time":\d+`, output)
+	require.NotContains(t, output, `"stack"`)
+
+	stdOut.Reset()
+	logger.Error("error entry")
+	require.Contains(t, stdOut.String(), `"stack":["github.com/EscanBE/go-lib/logging.Test_defaultLogger_ApplyConfig_EntryOptions`)
+
+	t.Run("text format keeps the configured timestamp", func(t *testing.T) {
+		stdOut.Reset()
+		require.NoError(t, logger.ApplyConfig(logtypes.LoggingConfig{
+			Format:          logtypes.LOG_FORMAT_TEXT,
+			TimestampFormat: "2006-01-02 15:04:05",
+			TimeZone:        "Asia/Ho_Chi_Minh",
+		}))
+		logger.Info("text entry")
+		require.Regexp(t, `^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} `, stdOut.String())
+	})
+
+	t.Run("logfmt format keeps the configured timestamp", func(t *testing.T) {
+		stdOut.Reset()
+		require.NoError(t, logger.ApplyConfig(logtypes.LoggingConfig{
+			Format:          logtypes.LOG_FORMAT_LOGFMT,
+			TimestampFormat: logtypes.LOG_TIMESTAMP_FORMAT_UNIX_MS,
+		}))
+		logger.Info("logfmt entry")
+		require.Regexp(t, `^time=\d{13} level=info msg="logfmt entry"`, stdOut.String())
+	})
+
+	t.Run("sampling", func(t *testing.T) {
+		stdOut.Reset()
+		require.NoError(t, logger.ApplyConfig(logtypes.LoggingConfig{
+			Format: logtypes.LOG_FORMAT_JSON,
+			Sampling: logtypes.LoggingSamplingConfig{
+				Enabled: true,
+				Burst:   2,
+				Period:  time.Hour,
+			},
+		}))
+		for i := 0; i < 5; i++ {
+			logger.Info("sampled")
+		}
+		logger.Error("not sampled")
+		require.Equal(t, 2, strings.Count(stdOut.String(), `"message":"sampled"`))
+		require.Contains(t, stdOut.String(), "not sampled")
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		require.Error(t, logger.ApplyConfig(logtypes.LoggingConfig{
+			TimeZone: "Mars/Olympus_Mons",
+		}))
+	})
+}
+
+func Test_defaultLogger_SamplingSummary(t *testing.T) {
+	logger := NewDefaultLogger().(*defaultLogger)
+	stdOut := &bytes.Buffer{}
+	logger.stdOut = stdOut
+
+	require.NoError(t, logger.ApplyConfig(logtypes.LoggingConfig{
+		Level:  logtypes.LOG_LEVEL_INFO,
+		Format: logtypes.LOG_FORMAT_JSON,
+		Sampling: logtypes.LoggingSamplingConfig{
+			Enabled:         true,
+			PerMessage:      true,
+			Burst:           1,
+			Period:          time.Hour,
+			SummaryInterval: time.Hour,
+		},
+	}))
+
+	for i := 0; i < 10; i++ {
+		logger.Info("rpc failed", "tx", i)
+		logger.Info("block scanned", "height", i)
+	}
+	require.Equal(t, 1, strings.Count(stdOut.String(), "rpc failed"))
+	require.Equal(t, 1, strings.Count(stdOut.String(), "block scanned"))
+
+	// dropped entries are reported when closed
+	require.NoError(t, logger.Close())
+	require.Contains(t, stdOut.String(), `"message":"`+samplingSummaryMessage+`"`)
+	require.Contains(t, stdOut.String(), `"dropped":18`)
+	require.Contains(t, stdOut.String(), `"rpc failed":9`)
+
+	t.Run("re-apply config reports dropped entries", func(t *testing.T) {
+		stdOut.Reset()
+		config := logtypes.LoggingConfig{
+			Sampling: logtypes.LoggingSamplingConfig{
+				Enabled:    true,
+				Thereafter: 100,
+			},
+		}
+		require.NoError(t, logger.ApplyConfig(config))
+		logger.Info("a")
+		logger.Info("a")
+		require.NoError(t, logger.ApplyConfig(config))
+		require.Contains(t, stdOut.String(), `"dropped":1`)
+		require.NoError(t, logger.Close())
+	})
+}
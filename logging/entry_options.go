@@ -0,0 +1,213 @@
+package logging
+
+import (
+	"fmt"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"github.com/rs/zerolog"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxStackFrames is the maximum number of frames of the stack trace added into Error entries
+const maxStackFrames = 32
+
+// loggingPackagePath is the import path of this package, functions of it and its sub-packages, like the adapters,
+// are skipped when finding the caller outside the loggers
+var loggingPackagePath = reflect.TypeOf(entryOptions{}).PkgPath()
+
+// entryOptions holds the options of LoggingConfig which decorate every entry, shared by the loggers
+type entryOptions struct {
+	strictKeyValues   bool
+	caller            bool
+	stackTraceOnError bool
+	timestamp         timestampFormatter
+	staticFields      map[string]interface{}
+	sampler           *sampler // nil = no sampling
+	summaryInterval   time.Duration
+}
+
+// defaultEntryOptions returns the options which are used when no config was applied
+func defaultEntryOptions() entryOptions {
+	return entryOptions{
+		timestamp: newTimestampFormatter("", ""),
+	}
+}
+
+// newEntryOptions builds entryOptions from the config, the config must be validated before
+func newEntryOptions(config logtypes.LoggingConfig) entryOptions {
+	options := entryOptions{
+		strictKeyValues:   config.StrictKeyValues,
+		caller:            config.Caller,
+		stackTraceOnError: config.StackTraceOnError,
+		timestamp:         newTimestampFormatter(config.TimestampFormat, config.TimeZone),
+	}
+
+	if len(config.StaticFields) > 0 {
+		options.staticFields = make(map[string]interface{}, len(config.StaticFields))
+		for key, value := range config.StaticFields {
+			options.staticFields[key] = value
+		}
+	}
+
+	if config.Sampling.Enabled {
+		options.sampler = newSampler(config.Sampling)
+		options.summaryInterval = config.Sampling.SummaryInterval
+		if options.summaryInterval == 0 {
+			options.summaryInterval = logtypes.LOG_SAMPLING_SUMMARY_INTERVAL_DEFAULT
+		}
+	}
+
+	return options
+}
+
+// sample returns false if the entry should be dropped by sampling
+func (o entryOptions) sample(level, msg string) bool {
+	if o.sampler == nil {
+		return true
+	}
+	return o.sampler.sample(level, msg)
+}
+
+// startSamplingSummary reports the entries dropped by sampling periodically via the provided function, if sampling is enabled.
+// The returned stop function must be called when the options are no longer used, it reports the remaining dropped entries.
+func (o entryOptions) startSamplingSummary(report func(level, msg string, keyVals []interface{})) (stop func()) {
+	if o.sampler == nil {
+		return func() {}
+	}
+	return startSamplingSummary(o.sampler, o.summaryInterval, func(summary samplingSummary) {
+		report(summary.level, samplingSummaryMessage, summary.keyVals())
+	})
+}
+
+// buildFields converts the key/values into fields, adds static fields, caller and stack trace if enabled, then redacts them
+func (o entryOptions) buildFields(level string, keyVals []interface{}) map[string]interface{} {
+	fields := getLogFields(o.strictKeyValues, keyVals...)
+
+	withStack := o.stackTraceOnError && level == logtypes.LOG_LEVEL_ERROR
+	if len(o.staticFields) < 1 && !o.caller && !withStack {
+		return redactFields(fields)
+	}
+
+	merged := make(map[string]interface{}, len(o.staticFields)+len(fields)+2)
+	for key, value := range o.staticFields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value // key/values of the entry take precedence over static fields
+	}
+
+	if o.caller || withStack {
+		frames := externalCallerFrames(maxStackFrames)
+		if o.caller && len(frames) > 0 {
+			merged[logtypes.LOG_FIELD_CALLER] = shortCaller(frames[0])
+		}
+		if withStack {
+			stack := make([]string, len(frames))
+			for i, frame := range frames {
+				stack[i] = fmt.Sprintf("%s (%s:%d)", frame.Function, frame.File, frame.Line)
+			}
+			merged[logtypes.LOG_FIELD_STACK] = stack
+		}
+	}
+
+	return redactFields(merged)
+}
+
+// externalCallerFrames returns frames of the call stack, starting from the first frame outside the loggers of this package and its sub-packages
+func externalCallerFrames(max int) []runtime.Frame {
+	pcs := make([]uintptr, max+16)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var result []runtime.Frame
+	for {
+		frame, more := frames.Next()
+		isInternal := isLoggingPackageFunction(frame.Function) && !strings.HasSuffix(frame.File, "_test.go")
+		if (len(result) > 0 || !isInternal) && frame.Function != "runtime.goexit" {
+			result = append(result, frame)
+			if len(result) >= max {
+				break
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	return result
+}
+
+// isLoggingPackageFunction returns true if the function belongs to this package or its sub-packages
+func isLoggingPackageFunction(function string) bool {
+	return strings.HasPrefix(function, loggingPackagePath+".") || strings.HasPrefix(function, loggingPackagePath+"/")
+}
+
+// shortCaller returns the caller in format dir/file.go:line
+func shortCaller(frame runtime.Frame) string {
+	return filepath.Join(filepath.Base(filepath.Dir(frame.File)), filepath.Base(frame.File)) + ":" + strconv.Itoa(frame.Line)
+}
+
+// timestampFormatter formats timestamp of entries, using the configured format and time zone
+type timestampFormatter struct {
+	format   string // one of the predefined formats or a custom Go time layout
+	location *time.Location
+	explicit bool // format or time zone was configured
+}
+
+// newTimestampFormatter returns a timestampFormatter, empty format and time zone mean RFC3339 in UTC.
+// The format and time zone must be validated before.
+func newTimestampFormatter(format, timeZone string) timestampFormatter {
+	result := timestampFormatter{
+		format:   format,
+		location: time.UTC,
+		explicit: len(format) > 0 || len(timeZone) > 0,
+	}
+	if len(result.format) < 1 {
+		result.format = logtypes.LOG_TIMESTAMP_FORMAT_DEFAULT
+	}
+	if len(timeZone) > 0 {
+		if location, err := time.LoadLocation(timeZone); err == nil {
+			result.location = location
+		}
+	}
+	return result
+}
+
+// value returns the formatted timestamp, as int64 for Unix formats, otherwise string
+func (f timestampFormatter) value(t time.Time) interface{} {
+	switch f.format {
+	case logtypes.LOG_TIMESTAMP_FORMAT_UNIX:
+		return t.Unix()
+	case logtypes.LOG_TIMESTAMP_FORMAT_UNIX_MS:
+		return t.UnixNano() / int64(time.Millisecond)
+	case logtypes.LOG_TIMESTAMP_FORMAT_RFC3339:
+		return t.In(f.location).Format(time.RFC3339)
+	case logtypes.LOG_TIMESTAMP_FORMAT_RFC3339_NANO:
+		return t.In(f.location).Format(time.RFC3339Nano)
+	default:
+		return t.In(f.location).Format(f.format)
+	}
+}
+
+// string returns the formatted timestamp as string
+func (f timestampFormatter) string(t time.Time) string {
+	switch v := f.value(t).(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// appendTo adds the formatted timestamp into the event
+func (f timestampFormatter) appendTo(event *zerolog.Event, t time.Time) *zerolog.Event {
+	switch v := f.value(t).(type) {
+	case int64:
+		return event.Int64(logtypes.LOG_FIELD_TIME, v)
+	default:
+		return event.Str(logtypes.LOG_FIELD_TIME, fmt.Sprintf("%v", v))
+	}
+}
@@ -0,0 +1,182 @@
+package logging
+
+import (
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_timestampFormatter(t *testing.T) {
+	ts := time.Date(2023, 1, 2, 3, 4, 5, 678000000, time.UTC)
+
+	tests := []struct {
+		name     string
+		format   string
+		timeZone string
+		want     interface{}
+		explicit bool
+	}{
+		{
+			name: "default is RFC3339 in UTC",
+			want: "2023-01-02T03:04:05Z",
+		},
+		{
+			name:     "rfc3339 in time zone",
+			format:   logtypes.LOG_TIMESTAMP_FORMAT_RFC3339,
+			timeZone: "Asia/Ho_Chi_Minh",
+			want:     "2023-01-02T10:04:05+07:00",
+			explicit: true,
+		},
+		{
+			name:     "rfc3339nano",
+			format:   logtypes.LOG_TIMESTAMP_FORMAT_RFC3339_NANO,
+			want:     "2023-01-02T03:04:05.678Z",
+			explicit: true,
+		},
+		{
+			name:     "unix",
+			format:   logtypes.LOG_TIMESTAMP_FORMAT_UNIX,
+			want:     int64(1672628645),
+			explicit: true,
+		},
+		{
+			name:     "unix ms",
+			format:   logtypes.LOG_TIMESTAMP_FORMAT_UNIX_MS,
+			timeZone: "Asia/Ho_Chi_Minh",
+			want:     int64(1672628645678),
+			explicit: true,
+		},
+		{
+			name:     "custom layout",
+			format:   "2006-01-02 15:04:05.000",
+			want:     "2023-01-02 03:04:05.678",
+			explicit: true,
+		},
+		{
+			name:     "time zone only",
+			timeZone: "UTC",
+			want:     "2023-01-02T03:04:05Z",
+			explicit: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatter := newTimestampFormatter(tt.format, tt.timeZone)
+			require.Equal(t, tt.want, formatter.value(ts))
+			require.Equal(t, tt.explicit, formatter.explicit)
+			require.NotEmpty(t, formatter.string(ts))
+		})
+	}
+}
+
+func Test_entryOptions_sample(t *testing.T) {
+	t.Run("no sampling", func(t *testing.T) {
+		options := defaultEntryOptions()
+		for i := 0; i < 100; i++ {
+			require.True(t, options.sample(logtypes.LOG_LEVEL_INFO, "msg"))
+		}
+	})
+
+	t.Run("burst then 1 in N", func(t *testing.T) {
+		options := newEntryOptions(logtypes.LoggingConfig{
+			Sampling: logtypes.LoggingSamplingConfig{
+				Enabled:    true,
+				Burst:      3,
+				Period:     time.Hour,
+				Thereafter: 5,
+			},
+		})
+		var logged int
+		for i := 0; i < 23; i++ {
+			if options.sample(logtypes.LOG_LEVEL_INFO, "msg") {
+				logged++
+			}
+		}
+		require.Equal(t, 3+4, logged, "3 burst, then 1 in every 5 of the remaining 20")
+	})
+
+	t.Run("burst then drop", func(t *testing.T) {
+		options := newEntryOptions(logtypes.LoggingConfig{
+			Sampling: logtypes.LoggingSamplingConfig{
+				Enabled: true,
+				Burst:   2,
+				Period:  time.Hour,
+			},
+		})
+		var logged int
+		for i := 0; i < 10; i++ {
+			if options.sample(logtypes.LOG_LEVEL_DEBUG, "msg") {
+				logged++
+			}
+		}
+		require.Equal(t, 2, logged)
+	})
+
+	t.Run("errors are not sampled by default", func(t *testing.T) {
+		config := logtypes.LoggingConfig{
+			Sampling: logtypes.LoggingSamplingConfig{
+				Enabled:    true,
+				Thereafter: 1000,
+			},
+		}
+		options := newEntryOptions(config)
+		for i := 0; i < 10; i++ {
+			require.True(t, options.sample(logtypes.LOG_LEVEL_ERROR, "msg"))
+		}
+
+		config.Sampling.SampleErrors = true
+		options = newEntryOptions(config)
+		var logged int
+		for i := 0; i < 10; i++ {
+			if options.sample(logtypes.LOG_LEVEL_ERROR, "msg") {
+				logged++
+			}
+		}
+		require.Equal(t, 1, logged)
+	})
+}
+
+func Test_entryOptions_buildFields(t *testing.T) {
+	t.Run("static fields, entry key/values take precedence", func(t *testing.T) {
+		options := newEntryOptions(logtypes.LoggingConfig{
+			StaticFields: map[string]string{
+				"service": "api",
+				"version": "1.0",
+				"token":   "secret",
+			},
+		})
+		fields := options.buildFields(logtypes.LOG_LEVEL_INFO, []interface{}{"version", "override", "k", "v"})
+		require.Equal(t, map[string]interface{}{
+			"service": "api",
+			"version": "override",
+			"token":   logtypes.REDACTED_VALUE,
+			"k":       "v",
+		}, fields)
+	})
+
+	t.Run("caller", func(t *testing.T) {
+		options := newEntryOptions(logtypes.LoggingConfig{
+			Caller: true,
+		})
+		fields := options.buildFields(logtypes.LOG_LEVEL_INFO, nil)
+		require.Contains(t, fields[logtypes.LOG_FIELD_CALLER], "logging/entry_options_test.go:")
+		require.NotContains(t, fields, logtypes.LOG_FIELD_STACK)
+	})
+
+	t.Run("stack trace on error only", func(t *testing.T) {
+		options := newEntryOptions(logtypes.LoggingConfig{
+			StackTraceOnError: true,
+		})
+		require.Nil(t, options.buildFields(logtypes.LOG_LEVEL_INFO, nil))
+
+		fields := options.buildFields(logtypes.LOG_LEVEL_ERROR, nil)
+		stack, ok := fields[logtypes.LOG_FIELD_STACK].([]string)
+		require.True(t, ok)
+		require.NotEmpty(t, stack)
+		require.LessOrEqual(t, len(stack), maxStackFrames)
+		require.True(t, strings.Contains(stack[0], "Test_entryOptions_buildFields"), "first frame must be the caller, got %s", stack[0])
+		require.NotContains(t, fields, logtypes.LOG_FIELD_CALLER)
+	})
+}
@@ -0,0 +1,429 @@
+package logging
+
+import (
+	"fmt"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	_ Logger    = &fanOutLogger{}
+	_ io.Closer = &fanOutLogger{}
+)
+
+const (
+	// DefaultSinkBufferSize is the size of the queue of a sink when not provided
+	DefaultSinkBufferSize = 1024
+
+	// sinkDropReportInterval is the minimum interval between reports of entries dropped because the queue was full
+	sinkDropReportInterval = 10 * time.Second
+)
+
+// SinkFilter decides if an entry should be delivered to the sink, returns false to drop the entry
+type SinkFilter func(entry LogEntry) bool
+
+// SinkHandler delivers the entry to a destination which is not an io.Writer, like a Telegram chat
+type SinkHandler func(entry LogEntry) error
+
+// Sink describes a destination of the fan-out logger
+type Sink struct {
+	Name       string       // name of the sink, used when reporting failures
+	Writer     io.Writer    // formatted entries will be written into, required if Handler is not provided
+	Handler    SinkHandler  // receives the entries without formatting, takes precedence over Writer
+	Level      string       // minimum level of entries to be delivered, empty = all levels
+	Format     string       // json, text or logfmt, empty = format of the logger, which is json by default. Only used with Writer
+	Filters    []SinkFilter // entries will be delivered only when all filters accept
+	BufferSize int          // size of the queue which entries are delivered asynchronously via, 0 = DefaultSinkBufferSize, entries are dropped when the queue is full
+}
+
+// Validate performs validation on the Sink instance
+func (s Sink) Validate() error {
+	if s.Writer == nil && s.Handler == nil {
+		return fmt.Errorf("sink [%s] requires either writer or handler", s.Name)
+	}
+	if err := (logtypes.LoggingConfig{Level: s.Level, Format: s.Format}).Validate(); err != nil {
+		return fmt.Errorf("sink [%s]: %v", s.Name, err)
+	}
+	if s.BufferSize < 0 {
+		return fmt.Errorf("sink [%s]: invalid buffer size %d", s.Name, s.BufferSize)
+	}
+	return nil
+}
+
+// SinkErrorHandler receives failures of sinks
+type SinkErrorHandler func(sinkName string, err error)
+
+// fanOutLogger is a Logger which delivers each entry to multiple sinks,
+// each sink has its own minimum level, format and filters.
+// Every sink is delivered asynchronously by its own worker, so failure or slowness of a sink does not affect the others nor the caller.
+type fanOutLogger struct {
+	mu          sync.RWMutex
+	level       string
+	options     entryOptions
+	stopSummary func() // stops the summary of entries dropped by sampling, nil if not started
+	sinks       []*sinkWorker
+	now         func() time.Time
+}
+
+// sinkWorker delivers entries to a sink via a queue
+type sinkWorker struct {
+	// below fields are accessed atomically, keep them first for 64-bit alignment
+	dropped          uint64 // number of entries dropped because the queue was full
+	reportedDropped  uint64 // number of dropped entries which were reported
+	lastDropReportAt int64  // unix nano of the last report of dropped entries
+
+	mu            sync.RWMutex
+	sink          Sink
+	defaultFormat string // format of the logger, used when the sink does not have its own
+	timestamp     timestampFormatter
+	queue         chan LogEntry
+	done          chan struct{} // closed when all the queued entries were delivered
+	closed        bool
+	onError       SinkErrorHandler
+}
+
+// NewFanOutLogger builds a Logger which delivers each entry to all the provided sinks.
+// Default level is the same as the default logger, entries below it will not reach any sink.
+// The returned Logger also implements io.Closer, which flushes the sinks.
+func NewFanOutLogger(sinks ...Sink) (Logger, error) {
+	return NewFanOutLoggerWithErrorHandler(nil, sinks...)
+}
+
+// NewFanOutLoggerWithErrorHandler is the same as NewFanOutLogger
+// but failures of sinks will be reported to the provided handler instead of StdErr.
+func NewFanOutLoggerWithErrorHandler(onSinkError SinkErrorHandler, sinks ...Sink) (Logger, error) {
+	if len(sinks) < 1 {
+		return nil, fmt.Errorf("at least one sink is required")
+	}
+
+	for i, sink := range sinks {
+		if err := sink.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid sink at index %d: %v", i, err)
+		}
+	}
+
+	if onSinkError == nil {
+		onSinkError = func(sinkName string, err error) {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to deliver log entry to sink [%s]: %v\n", sinkName, err)
+		}
+	}
+
+	result := &fanOutLogger{
+		level:   logtypes.LOG_LEVEL_DEFAULT,
+		options: defaultEntryOptions(),
+		now:     time.Now,
+	}
+
+	for _, sink := range sinks {
+		bufferSize := sink.BufferSize
+		if bufferSize == 0 {
+			bufferSize = DefaultSinkBufferSize
+		}
+		worker := &sinkWorker{
+			sink:      sink,
+			timestamp: result.options.timestamp,
+			queue:     make(chan LogEntry, bufferSize),
+			done:      make(chan struct{}),
+			onError:   onSinkError,
+		}
+		go worker.run()
+		result.sinks = append(result.sinks, worker)
+	}
+
+	return result, nil
+}
+
+// SetLogLevel implements Logger, entries below this level will not be delivered to any sink
+func (f *fanOutLogger) SetLogLevel(level string) error {
+	if err := (logtypes.LoggingConfig{Level: level}).Validate(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.level = level
+	return nil
+}
+
+// SetLogFormat implements Logger, changes format of the sinks which do not have their own format
+func (f *fanOutLogger) SetLogFormat(format string) error {
+	if len(format) < 1 {
+		return fmt.Errorf("invalid logging format: %s", format)
+	}
+	if err := (logtypes.LoggingConfig{Format: format}).Validate(); err != nil {
+		return err
+	}
+	for _, worker := range f.sinks {
+		worker.mu.Lock()
+		worker.defaultFormat = format
+		worker.mu.Unlock()
+	}
+	return nil
+}
+
+// Info implements Logger
+func (f *fanOutLogger) Info(msg string, keyVals ...interface{}) {
+	f.log(logtypes.LOG_LEVEL_INFO, msg, keyVals)
+}
+
+// Debug implements Logger
+func (f *fanOutLogger) Debug(msg string, keyVals ...interface{}) {
+	f.log(logtypes.LOG_LEVEL_DEBUG, msg, keyVals)
+}
+
+// Error implements Logger
+func (f *fanOutLogger) Error(msg string, keyVals ...interface{}) {
+	f.log(logtypes.LOG_LEVEL_ERROR, msg, keyVals)
+}
+
+// ApplyConfig implements Logger. File outputs are not supported, use a sink with RotatingFileWriter instead.
+func (f *fanOutLogger) ApplyConfig(config logtypes.LoggingConfig) error {
+	validationErr := config.Validate()
+	if validationErr != nil {
+		return validationErr
+	}
+	if len(config.FileOutputs) > 0 {
+		return fmt.Errorf("file outputs are not supported by fan-out logger, use a sink with RotatingFileWriter instead")
+	}
+	if len(config.Level) > 0 {
+		_ = f.SetLogLevel(config.Level) // shouldn't err, validated before
+	}
+	if len(config.Format) > 0 {
+		_ = f.SetLogFormat(config.Format) // shouldn't err, validated before
+	}
+	// report the entries dropped by the previous sampling config
+	f.stopSamplingSummary()
+
+	options := newEntryOptions(config)
+	f.mu.Lock()
+	f.options = options
+	f.mu.Unlock()
+	for _, worker := range f.sinks {
+		worker.mu.Lock()
+		worker.timestamp = options.timestamp
+		worker.mu.Unlock()
+	}
+
+	stopSummary := options.startSamplingSummary(f.logSamplingSummary)
+	f.mu.Lock()
+	f.stopSummary = stopSummary
+	f.mu.Unlock()
+	return nil
+}
+
+// Close implements io.Closer, reports the entries dropped by sampling, flushes the sinks and stops all of them,
+// entries logged after closed will be dropped
+func (f *fanOutLogger) Close() error {
+	f.stopSamplingSummary()
+	for _, worker := range f.sinks {
+		worker.close()
+	}
+	return nil
+}
+
+// stopSamplingSummary stops the summary of entries dropped by sampling if started, the remaining dropped entries are reported
+func (f *fanOutLogger) stopSamplingSummary() {
+	f.mu.Lock()
+	stopSummary := f.stopSummary
+	f.stopSummary = nil
+	f.mu.Unlock()
+
+	if stopSummary != nil {
+		stopSummary()
+	}
+}
+
+// log builds the entry and delivers it to the sinks, unless it is dropped by sampling
+func (f *fanOutLogger) log(level, msg string, keyVals []interface{}) {
+	f.mu.RLock()
+	loggerLevel := f.level
+	options := f.options
+	f.mu.RUnlock()
+
+	if !isLevelEnabled(level, loggerLevel) {
+		return
+	}
+
+	if !options.sample(level, msg) {
+		return
+	}
+
+	f.deliver(options, level, msg, keyVals)
+}
+
+// logSamplingSummary delivers the summary of entries dropped by sampling to the sinks, bypassing sampling
+func (f *fanOutLogger) logSamplingSummary(level, msg string, keyVals []interface{}) {
+	f.mu.RLock()
+	loggerLevel := f.level
+	options := f.options
+	f.mu.RUnlock()
+
+	if !isLevelEnabled(level, loggerLevel) {
+		return
+	}
+
+	f.deliver(options, level, msg, keyVals)
+}
+
+// deliver builds the entry and delivers it to the sinks
+func (f *fanOutLogger) deliver(options entryOptions, level, msg string, keyVals []interface{}) {
+	entry := LogEntry{
+		Time:    f.now(),
+		Level:   level,
+		Message: scrubSecrets(msg),
+		Fields:  options.buildFields(level, keyVals),
+	}
+
+	for _, worker := range f.sinks {
+		worker.deliver(entry)
+	}
+}
+
+// deliver enqueues the entry for the sink if accepted, the entry is dropped when the queue is full
+func (w *sinkWorker) deliver(entry LogEntry) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return
+	}
+
+	if !isLevelEnabled(entry.Level, w.sink.Level) {
+		return
+	}
+
+	if !w.accept(entry) {
+		return
+	}
+
+	select {
+	case w.queue <- entry:
+	default:
+		atomic.AddUint64(&w.dropped, 1)
+		w.reportDropped(false)
+	}
+}
+
+// reportDropped reports the number of entries dropped since the last report,
+// at most once per sinkDropReportInterval unless forced, so a stuck sink does not flood the error handler
+func (w *sinkWorker) reportDropped(force bool) {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&w.lastDropReportAt)
+	if !force && last != 0 && now-last < int64(sinkDropReportInterval) {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&w.lastDropReportAt, last, now) {
+		return // reported by another goroutine
+	}
+
+	dropped := atomic.LoadUint64(&w.dropped)
+	reported := atomic.SwapUint64(&w.reportedDropped, dropped)
+	if dropped > reported {
+		w.reportError(fmt.Errorf("queue is full, dropped %d entries since the last report, %d in total", dropped-reported, dropped))
+	}
+}
+
+// accept returns true if all the filters accept the entry, a panic filter will be considered as rejected
+func (w *sinkWorker) accept(entry LogEntry) (accepted bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			accepted = false
+			w.reportError(fmt.Errorf("filter panic: %v", r))
+		}
+	}()
+
+	for _, filter := range w.sink.Filters {
+		if filter != nil && !filter(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// handle delivers the entry to the handler or writer, any failure or panic will be reported.
+// The lock is not held while delivering, so a stuck sink does not block changing the config.
+func (w *sinkWorker) handle(entry LogEntry) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.reportError(fmt.Errorf("panic: %v", r))
+		}
+	}()
+
+	w.mu.RLock()
+	sink := w.sink
+	format := w.defaultFormat
+	timestamp := w.timestamp
+	w.mu.RUnlock()
+	if len(sink.Format) > 0 {
+		format = sink.Format
+	}
+
+	if sink.Handler != nil {
+		if err := sink.Handler(entry); err != nil {
+			w.reportError(err)
+		}
+		return
+	}
+
+	bz, err := formatEntry(format, timestamp, entry)
+	if err != nil {
+		w.reportError(err)
+		return
+	}
+	if _, err := sink.Writer.Write(bz); err != nil {
+		w.reportError(err)
+	}
+}
+
+// run delivers entries from the queue until closed
+func (w *sinkWorker) run() {
+	for entry := range w.queue {
+		w.handle(entry)
+	}
+	close(w.done)
+}
+
+// close stops receiving new entries and waits until the queued entries are delivered
+func (w *sinkWorker) close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.queue)
+	<-w.done
+	w.reportDropped(true)
+}
+
+// reportError forwards the failure to the error handler, which must never break the logger
+func (w *sinkWorker) reportError(err error) {
+	defer func() {
+		_ = recover()
+	}()
+	w.onError(w.sink.Name, err)
+}
+
+// isLevelEnabled returns true if the level of entry is at or above the minimum level, empty minimum level enables all
+func isLevelEnabled(level, minimumLevel string) bool {
+	return levelOrder(level) >= levelOrder(minimumLevel)
+}
+
+// levelOrder returns the severity order of the level, unknown or empty level has the lowest order
+func levelOrder(level string) int {
+	switch level {
+	case logtypes.LOG_LEVEL_DEBUG:
+		return 1
+	case logtypes.LOG_LEVEL_INFO:
+		return 2
+	case logtypes.LOG_LEVEL_ERROR:
+		return 3
+	default:
+		return 0
+	}
+}
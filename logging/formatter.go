@@ -0,0 +1,228 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// reserved field names, same as zerolog uses
+const (
+	fieldNameTime    = logtypes.LOG_FIELD_TIME
+	fieldNameLevel   = logtypes.LOG_FIELD_LEVEL
+	fieldNameMessage = logtypes.LOG_FIELD_MESSAGE
+)
+
+// LogEntry is a log entry which will be formatted or delivered to sinks.
+// The same entry is shared between sinks, so it must be treated as read-only.
+type LogEntry struct {
+	Time    time.Time
+	Level   string
+	Message string
+	Fields  map[string]interface{}
+}
+
+// formatEntry formats the entry using the provided format and timestamp format, output ends with a new line
+func formatEntry(format string, timestamp timestampFormatter, entry LogEntry) ([]byte, error) {
+	switch format {
+	case logtypes.LOG_FORMAT_JSON, "":
+		return formatJson(timestamp.value(entry.Time), entry)
+	case logtypes.LOG_FORMAT_TEXT:
+		return formatText(timestamp.string(entry.Time), entry), nil
+	case logtypes.LOG_FORMAT_LOGFMT:
+		return formatLogfmt(timestamp.string(entry.Time), entry), nil
+	default:
+		return nil, fmt.Errorf("invalid logging format: %s", format)
+	}
+}
+
+// formatJson formats the entry as a single line JSON object
+func formatJson(timestamp interface{}, entry LogEntry) ([]byte, error) {
+	object := make(map[string]interface{}, len(entry.Fields)+3)
+	for key, value := range entry.Fields {
+		object[key] = jsonSafeValue(value)
+	}
+	object[fieldNameTime] = timestamp
+	object[fieldNameLevel] = entry.Level
+	object[fieldNameMessage] = entry.Message
+
+	bz, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	return append(bz, '\n'), nil
+}
+
+// formatText formats the entry in human-readable form: <time> <LVL> <message> key=value...
+func formatText(timestamp string, entry LogEntry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(timestamp)
+	buf.WriteByte(' ')
+	buf.WriteString(shortLevel(entry.Level))
+	buf.WriteByte(' ')
+	buf.WriteString(entry.Message)
+	for _, key := range sortedKeys(entry.Fields) {
+		buf.WriteByte(' ')
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(stringifyValue(entry.Fields[key])))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// formatLogfmt formats the entry in logfmt: time=<time> level=<level> msg=<message> key=value...
+func formatLogfmt(timestamp string, entry LogEntry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("time=")
+	buf.WriteString(logfmtValue(timestamp))
+	buf.WriteString(" level=")
+	buf.WriteString(logfmtValue(entry.Level))
+	buf.WriteString(" msg=")
+	buf.WriteString(logfmtValue(entry.Message))
+	for _, key := range sortedKeys(entry.Fields) {
+		buf.WriteByte(' ')
+		buf.WriteString(logfmtKey(key))
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(stringifyValue(entry.Fields[key])))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// shortLevel returns 3 characters upper case of the level, like zerolog console writer does
+func shortLevel(level string) string {
+	switch level {
+	case logtypes.LOG_LEVEL_DEBUG:
+		return "DBG"
+	case logtypes.LOG_LEVEL_INFO:
+		return "INF"
+	case logtypes.LOG_LEVEL_ERROR:
+		return "ERR"
+	default:
+		return strings.ToUpper(level)
+	}
+}
+
+// logfmtKey removes characters which are not allowed in logfmt keys
+func logfmtKey(key string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, key)
+	if len(sanitized) < 1 {
+		return "_"
+	}
+	return sanitized
+}
+
+// logfmtValue quotes the value if needed
+func logfmtValue(value string) string {
+	if len(value) < 1 {
+		return `""`
+	}
+	for _, r := range value {
+		if r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
+
+// stringifyValue converts a field value into string
+func stringifyValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "<nil>"
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// jsonSafeValue converts values which encoding/json can not represent properly, like errors
+func jsonSafeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case []byte:
+		return string(v)
+	case json.Marshaler:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	default:
+		if _, err := json.Marshal(v); err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return v
+	}
+}
+
+// sortedKeys returns keys of the fields, sorted
+func sortedKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var (
+	_ io.Writer = logfmtWriter{}
+)
+
+// logfmtWriter converts JSON lines, produced by zerolog, into logfmt. The timestamp was already formatted, it is kept as is.
+type logfmtWriter struct {
+	out io.Writer
+}
+
+// Write implements io.Writer
+func (w logfmtWriter) Write(p []byte) (n int, err error) {
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		// not a JSON, write as is
+		return w.out.Write(p)
+	}
+
+	entry := LogEntry{
+		Fields: object,
+	}
+	var timestamp string
+	if timeValue, ok := object[fieldNameTime]; ok {
+		timestamp = stringifyValue(timeValue)
+		delete(object, fieldNameTime)
+	}
+	if level, ok := object[fieldNameLevel].(string); ok {
+		entry.Level = level
+		delete(object, fieldNameLevel)
+	}
+	if message, ok := object[fieldNameMessage].(string); ok {
+		entry.Message = message
+		delete(object, fieldNameMessage)
+	}
+
+	if _, err := w.out.Write(formatLogfmt(timestamp, entry)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func Test_formatEntry(t *testing.T) {
+	entry := LogEntry{
+		Time:    time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		Level:   logtypes.LOG_LEVEL_INFO,
+		Message: "hello world",
+		Fields: map[string]interface{}{
+			"b":     "with space",
+			"a":     1,
+			"error": fmt.Errorf("failed"),
+			"empty": "",
+		},
+	}
+
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			format: logtypes.LOG_FORMAT_JSON,
+			want:   `{"a":1,"b":"with space","empty":"","error":"failed","level":"info","message":"hello world","time":"2023-01-02T03:04:05Z"}` + "\n",
+		},
+		{
+			format: "",
+			want:   `{"a":1,"b":"with space","empty":"","error":"failed","level":"info","message":"hello world","time":"2023-01-02T03:04:05Z"}` + "\n",
+		},
+		{
+			format: logtypes.LOG_FORMAT_TEXT,
+			want:   `2023-01-02T03:04:05Z INF hello world a=1 b="with space" empty="" error=failed` + "\n",
+		},
+		{
+			format: logtypes.LOG_FORMAT_LOGFMT,
+			want:   `time=2023-01-02T03:04:05Z level=info msg="hello world" a=1 b="with space" empty="" error=failed` + "\n",
+		},
+		{
+			format:  "invalid",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := formatEntry(tt.format, newTimestampFormatter("", ""), entry)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func Test_logfmtValue(t *testing.T) {
+	require.Equal(t, `""`, logfmtValue(""))
+	require.Equal(t, `abc`, logfmtValue("abc"))
+	require.Equal(t, `"a b"`, logfmtValue("a b"))
+	require.Equal(t, `"a=b"`, logfmtValue("a=b"))
+	require.Equal(t, `"a\"b"`, logfmtValue(`a"b`))
+	require.Equal(t, `"a\nb"`, logfmtValue("a\nb"))
+}
+
+func Test_logfmtKey(t *testing.T) {
+	require.Equal(t, "_", logfmtKey(""))
+	require.Equal(t, "chat-id", logfmtKey("chat-id"))
+	require.Equal(t, "a_b_c", logfmtKey("a b=c"))
+}
+
+func Test_logfmtWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := logfmtWriter{out: out}
+
+	input := []byte(`{"level":"error","time":"2023-01-02T03:04:05Z","message":"failed","height":100,"error":"timeout"}` + "\n")
+	n, err := w.Write(input)
+	require.NoError(t, err)
+	require.Equal(t, len(input), n)
+	require.Equal(t, `time=2023-01-02T03:04:05Z level=error msg=failed error=timeout height=100`+"\n", out.String())
+
+	out.Reset()
+	_, err = w.Write([]byte("not a json\n"))
+	require.NoError(t, err)
+	require.Equal(t, "not a json\n", out.String())
+}
+
+func Test_formatEntry_TimestampFormat(t *testing.T) {
+	entry := LogEntry{
+		Time:    time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		Level:   logtypes.LOG_LEVEL_INFO,
+		Message: "hello",
+	}
+
+	got, err := formatEntry(logtypes.LOG_FORMAT_JSON, newTimestampFormatter(logtypes.LOG_TIMESTAMP_FORMAT_UNIX, ""), entry)
+	require.NoError(t, err)
+	require.Equal(t, `{"level":"info","message":"hello","time":1672628645}`+"\n", string(got))
+
+	got, err = formatEntry(logtypes.LOG_FORMAT_LOGFMT, newTimestampFormatter("2006-01-02 15:04:05", "Asia/Ho_Chi_Minh"), entry)
+	require.NoError(t, err)
+	require.Equal(t, `time="2023-01-02 10:04:05" level=info msg=hello`+"\n", string(got))
+}
@@ -0,0 +1,278 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	_ http.Handler = &LevelController{}
+)
+
+// levelCycle is the order of levels which LevelController.CycleLevel goes through
+var levelCycle = []string{logtypes.LOG_LEVEL_DEBUG, logtypes.LOG_LEVEL_INFO, logtypes.LOG_LEVEL_ERROR}
+
+// LevelController changes level of a running logger without restart, via method calls, signals or HTTP.
+// When revert timeout is set, any level other than the base level will be reverted to the base level after the timeout,
+// so a forgotten debug level does not flood the log.
+// It is safe for concurrent use.
+type LevelController struct {
+	mu          sync.Mutex
+	logger      Logger
+	baseLevel   string        // level which will be reverted to
+	level       string        // current level
+	revertAfter time.Duration // 0 = never revert
+	revertTimer *time.Timer
+	revertAt    time.Time
+}
+
+// LevelControllerState is the state of LevelController, returned by the HTTP handler
+type LevelControllerState struct {
+	Level     string     `json:"level"`
+	BaseLevel string     `json:"base-level"`
+	RevertAt  *time.Time `json:"revert-at,omitempty"`
+}
+
+// NewLevelController applies the base level to the logger and returns a LevelController instance to control it.
+// Set revertAfter to 0 to disable automatic revert.
+func NewLevelController(logger Logger, baseLevel string, revertAfter time.Duration) (*LevelController, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger is required")
+	}
+	if len(baseLevel) < 1 {
+		baseLevel = logtypes.LOG_LEVEL_DEFAULT
+	}
+	if revertAfter < 0 {
+		return nil, fmt.Errorf("invalid revert timeout %s", revertAfter)
+	}
+	if err := logger.SetLogLevel(baseLevel); err != nil {
+		return nil, err
+	}
+	return &LevelController{
+		logger:      logger,
+		baseLevel:   baseLevel,
+		level:       baseLevel,
+		revertAfter: revertAfter,
+	}, nil
+}
+
+// GetLevel returns the current level
+func (c *LevelController) GetLevel() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.level
+}
+
+// GetState returns the current level, base level and the time it will be reverted if any
+func (c *LevelController) GetState() LevelControllerState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state := LevelControllerState{
+		Level:     c.level,
+		BaseLevel: c.baseLevel,
+	}
+	if c.revertTimer != nil {
+		revertAt := c.revertAt
+		state.RevertAt = &revertAt
+	}
+	return state
+}
+
+// SetLevel changes level of the logger, it will be reverted to the base level after the revert timeout if any
+func (c *LevelController) SetLevel(level string) error {
+	if len(level) < 1 {
+		return fmt.Errorf("level is required")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.setLevel(level)
+}
+
+// Revert changes level of the logger back to the base level
+func (c *LevelController) Revert() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.setLevel(c.baseLevel)
+}
+
+// ToggleDebug switches to debug level, or back to the base level if the current level is debug
+func (c *LevelController) ToggleDebug() (newLevel string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	newLevel = logtypes.LOG_LEVEL_DEBUG
+	if c.level == logtypes.LOG_LEVEL_DEBUG {
+		newLevel = c.baseLevel
+		if newLevel == logtypes.LOG_LEVEL_DEBUG {
+			newLevel = logtypes.LOG_LEVEL_INFO
+		}
+	}
+	return newLevel, c.setLevel(newLevel)
+}
+
+// CycleLevel switches to the next level in order: debug > info > error > debug
+func (c *LevelController) CycleLevel() (newLevel string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	newLevel = levelCycle[0]
+	for i, level := range levelCycle {
+		if level == c.level {
+			newLevel = levelCycle[(i+1)%len(levelCycle)]
+			break
+		}
+	}
+	return newLevel, c.setLevel(newLevel)
+}
+
+// Close stops the pending revert if any, the current level is kept
+func (c *LevelController) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopRevertTimer()
+}
+
+// ListenSignals toggles debug level when receives SIGUSR1 and cycles levels when receives SIGUSR2,
+// until the returned stop function is called
+func (c *LevelController) ListenSignals() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	stopChan := make(chan struct{})
+	var wg sync.WaitGroup
+
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stopChan:
+				return
+			case sig := <-signals:
+				var err error
+				if sig == syscall.SIGUSR1 {
+					_, err = c.ToggleDebug()
+				} else {
+					_, err = c.CycleLevel()
+				}
+				if err != nil {
+					_, _ = fmt.Fprintf(os.Stderr, "failed to change log level on signal %v: %v\n", sig, err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(stopChan)
+			wg.Wait()
+		})
+	}
+}
+
+// ServeHTTP implements http.Handler.
+// GET returns the current state as JSON.
+// PUT or POST changes the level, provided via query `?level=debug`, JSON body `{"level":"debug"}` or plain text body.
+func (c *LevelController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// return state
+	case http.MethodPut, http.MethodPost:
+		level, err := readLevelFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.SetLevel(level); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(c.GetState())
+}
+
+// setLevel applies the level and schedules a revert if needed, must be called with lock held
+func (c *LevelController) setLevel(level string) error {
+	if err := (logtypes.LoggingConfig{Level: level}).Validate(); err != nil {
+		return err
+	}
+	if err := c.logger.SetLogLevel(level); err != nil {
+		return err
+	}
+	c.level = level
+
+	c.stopRevertTimer()
+	if level != c.baseLevel && c.revertAfter > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(c.revertAfter, func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.revertTimer != timer {
+				// superseded by another change
+				return
+			}
+			c.revertTimer = nil
+			if err := c.logger.SetLogLevel(c.baseLevel); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "failed to revert log level to %s: %v\n", c.baseLevel, err)
+				return
+			}
+			c.level = c.baseLevel
+		})
+		c.revertTimer = timer
+		c.revertAt = time.Now().Add(c.revertAfter)
+	}
+	return nil
+}
+
+// stopRevertTimer cancels the pending revert if any, must be called with lock held
+func (c *LevelController) stopRevertTimer() {
+	if c.revertTimer != nil {
+		c.revertTimer.Stop()
+		c.revertTimer = nil
+	}
+}
+
+// readLevelFromRequest reads the level from query, JSON body or plain text body
+func readLevelFromRequest(r *http.Request) (string, error) {
+	if level := r.URL.Query().Get("level"); len(level) > 0 {
+		return level, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body: %v", err)
+	}
+	content := strings.TrimSpace(string(body))
+	if len(content) < 1 {
+		return "", fmt.Errorf("level is required")
+	}
+
+	if strings.HasPrefix(content, "{") {
+		var state LevelControllerState
+		if err := json.Unmarshal([]byte(content), &state); err != nil {
+			return "", fmt.Errorf("invalid JSON body: %v", err)
+		}
+		if len(state.Level) < 1 {
+			return "", fmt.Errorf("level is required")
+		}
+		return state.Level, nil
+	}
+
+	return content, nil
+}
@@ -0,0 +1,176 @@
+package logging
+
+import (
+	"github.com/EscanBE/go-lib/logging/logtest"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNewLevelController(t *testing.T) {
+	_, err := NewLevelController(nil, logtypes.LOG_LEVEL_INFO, 0)
+	require.Error(t, err)
+
+	_, err = NewLevelController(logtest.NewCapturingLogger(), "invalid", 0)
+	require.Error(t, err)
+
+	_, err = NewLevelController(logtest.NewCapturingLogger(), logtypes.LOG_LEVEL_INFO, -time.Second)
+	require.Error(t, err)
+
+	logger := logtest.NewCapturingLogger()
+	c, err := NewLevelController(logger, "", 0)
+	require.NoError(t, err)
+	require.Equal(t, logtypes.LOG_LEVEL_DEFAULT, c.GetLevel())
+	require.Equal(t, logtypes.LOG_LEVEL_DEFAULT, logger.GetLogLevel(), "base level must be applied")
+}
+
+func TestLevelController_SetLevel(t *testing.T) {
+	logger := logtest.NewCapturingLogger()
+	c, err := NewLevelController(logger, logtypes.LOG_LEVEL_INFO, 0)
+	require.NoError(t, err)
+
+	require.Error(t, c.SetLevel(""))
+	require.Error(t, c.SetLevel("invalid"))
+	require.Equal(t, logtypes.LOG_LEVEL_INFO, c.GetLevel())
+
+	require.NoError(t, c.SetLevel(logtypes.LOG_LEVEL_DEBUG))
+	require.Equal(t, logtypes.LOG_LEVEL_DEBUG, c.GetLevel())
+	require.Equal(t, logtypes.LOG_LEVEL_DEBUG, logger.GetLogLevel())
+	require.Nil(t, c.GetState().RevertAt, "no revert when timeout is disabled")
+
+	require.NoError(t, c.Revert())
+	require.Equal(t, logtypes.LOG_LEVEL_INFO, logger.GetLogLevel())
+}
+
+func TestLevelController_AutoRevert(t *testing.T) {
+	logger := logtest.NewCapturingLogger()
+	c, err := NewLevelController(logger, logtypes.LOG_LEVEL_INFO, 100*time.Millisecond)
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.SetLevel(logtypes.LOG_LEVEL_DEBUG))
+	require.NotNil(t, c.GetState().RevertAt)
+
+	require.Eventually(t, func() bool {
+		return logger.GetLogLevel() == logtypes.LOG_LEVEL_INFO && c.GetLevel() == logtypes.LOG_LEVEL_INFO
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Nil(t, c.GetState().RevertAt)
+
+	t.Run("setting base level cancels revert", func(t *testing.T) {
+		require.NoError(t, c.SetLevel(logtypes.LOG_LEVEL_ERROR))
+		require.NoError(t, c.SetLevel(logtypes.LOG_LEVEL_INFO))
+		require.Nil(t, c.GetState().RevertAt)
+	})
+
+	t.Run("close cancels revert", func(t *testing.T) {
+		require.NoError(t, c.SetLevel(logtypes.LOG_LEVEL_DEBUG))
+		c.Close()
+		time.Sleep(200 * time.Millisecond)
+		require.Equal(t, logtypes.LOG_LEVEL_DEBUG, logger.GetLogLevel())
+	})
+}
+
+func TestLevelController_ToggleDebug(t *testing.T) {
+	c, err := NewLevelController(logtest.NewCapturingLogger(), logtypes.LOG_LEVEL_ERROR, 0)
+	require.NoError(t, err)
+
+	level, err := c.ToggleDebug()
+	require.NoError(t, err)
+	require.Equal(t, logtypes.LOG_LEVEL_DEBUG, level)
+
+	level, err = c.ToggleDebug()
+	require.NoError(t, err)
+	require.Equal(t, logtypes.LOG_LEVEL_ERROR, level, "toggle back to base level")
+
+	c, err = NewLevelController(logtest.NewCapturingLogger(), logtypes.LOG_LEVEL_DEBUG, 0)
+	require.NoError(t, err)
+	level, err = c.ToggleDebug()
+	require.NoError(t, err)
+	require.Equal(t, logtypes.LOG_LEVEL_INFO, level, "base level is debug, toggle to info")
+}
+
+func TestLevelController_CycleLevel(t *testing.T) {
+	c, err := NewLevelController(logtest.NewCapturingLogger(), logtypes.LOG_LEVEL_INFO, 0)
+	require.NoError(t, err)
+
+	var levels []string
+	for i := 0; i < 4; i++ {
+		level, err := c.CycleLevel()
+		require.NoError(t, err)
+		levels = append(levels, level)
+	}
+	require.Equal(t, []string{
+		logtypes.LOG_LEVEL_ERROR,
+		logtypes.LOG_LEVEL_DEBUG,
+		logtypes.LOG_LEVEL_INFO,
+		logtypes.LOG_LEVEL_ERROR,
+	}, levels)
+}
+
+func TestLevelController_ListenSignals(t *testing.T) {
+	logger := logtest.NewCapturingLogger()
+	c, err := NewLevelController(logger, logtypes.LOG_LEVEL_INFO, 0)
+	require.NoError(t, err)
+
+	stop := c.ListenSignals()
+	defer stop()
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	require.Eventually(t, func() bool {
+		return logger.GetLogLevel() == logtypes.LOG_LEVEL_DEBUG
+	}, 3*time.Second, 10*time.Millisecond, "SIGUSR1 toggles debug")
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+	require.Eventually(t, func() bool {
+		return logger.GetLogLevel() == logtypes.LOG_LEVEL_INFO
+	}, 3*time.Second, 10*time.Millisecond, "SIGUSR2 cycles to the next level")
+
+	stop()
+	stop() // stop twice should be fine
+}
+
+func TestLevelController_ServeHTTP(t *testing.T) {
+	logger := logtest.NewCapturingLogger()
+	c, err := NewLevelController(logger, logtypes.LOG_LEVEL_INFO, time.Hour)
+	require.NoError(t, err)
+	defer c.Close()
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		c.ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return recorder
+	}
+
+	resp := serve(http.MethodGet, "/log-level", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `{"level":"info","base-level":"info"}`, resp.Body.String())
+
+	resp = serve(http.MethodPut, "/log-level?level=debug", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Contains(t, resp.Body.String(), `"level":"debug"`)
+	require.Contains(t, resp.Body.String(), `"revert-at"`)
+	require.Equal(t, logtypes.LOG_LEVEL_DEBUG, logger.GetLogLevel())
+
+	resp = serve(http.MethodPut, "/log-level", `{"level":"error"}`)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, logtypes.LOG_LEVEL_ERROR, logger.GetLogLevel())
+
+	resp = serve(http.MethodPost, "/log-level", "info\n")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, logtypes.LOG_LEVEL_INFO, logger.GetLogLevel())
+
+	for _, body := range []string{"", "invalid", `{"level":""}`, `{"level":`} {
+		resp = serve(http.MethodPut, "/log-level", body)
+		require.Equalf(t, http.StatusBadRequest, resp.Code, "body: %s", body)
+	}
+	require.Equal(t, logtypes.LOG_LEVEL_INFO, logger.GetLogLevel())
+
+	resp = serve(http.MethodDelete, "/log-level", "")
+	require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+}
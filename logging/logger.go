@@ -7,7 +7,7 @@ type Logger interface {
 	// SetLogLevel changes the log level, valid values are: info, error and debug
 	SetLogLevel(level string) error
 
-	// SetLogFormat changes the log format, valid values are: json and text
+	// SetLogFormat changes the log format, valid values are: json, text and logfmt
 	SetLogFormat(format string) error
 
 	// Info does log the input message at level Info
@@ -0,0 +1,273 @@
+// Package logtest provides a Logger which records entries in memory, with assertion helpers, for tests of code which logs.
+package logtest
+
+import (
+	"fmt"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// CapturedLogEntry is a log entry which was recorded by CapturingLogger
+type CapturedLogEntry struct {
+	Level   string
+	Message string
+	Fields  map[string]interface{}
+}
+
+// String returns a human-readable form of the entry, fields are sorted by key
+func (e CapturedLogEntry) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[%s] %s", e.Level, e.Message))
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sb.WriteString(fmt.Sprintf(" %s=%v", key, e.Fields[key]))
+	}
+	return sb.String()
+}
+
+// HasField returns true if the entry contains a field with provided key and value.
+// Values are considered equal when they are deeply equal or have the same string representation,
+// so `int64(1)` matches `1`.
+func (e CapturedLogEntry) HasField(key string, value interface{}) bool {
+	actual, found := e.Fields[key]
+	if !found {
+		return false
+	}
+	return reflect.DeepEqual(actual, value) || fmt.Sprintf("%v", actual) == fmt.Sprintf("%v", value)
+}
+
+// CapturingLogger is an in-memory implementation of logging.Logger, it records every entry so tests can assert them.
+// It is safe for concurrent use.
+type CapturingLogger struct {
+	mu      sync.RWMutex
+	level   string
+	format  string
+	entries []CapturedLogEntry
+}
+
+// NewCapturingLogger returns a new CapturingLogger instance, which records entries of all levels
+func NewCapturingLogger() *CapturingLogger {
+	return &CapturingLogger{
+		level:  logtypes.LOG_LEVEL_DEBUG,
+		format: logtypes.LOG_FORMAT_DEFAULT,
+	}
+}
+
+// SetLogLevel implements logging.Logger, entries below the level will not be recorded
+func (l *CapturingLogger) SetLogLevel(level string) error {
+	if err := (logtypes.LoggingConfig{Level: level}).Validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+	return nil
+}
+
+// SetLogFormat implements logging.Logger, format is recorded but has no effect
+func (l *CapturingLogger) SetLogFormat(format string) error {
+	if len(format) < 1 {
+		return fmt.Errorf("invalid logging format: %s", format)
+	}
+	if err := (logtypes.LoggingConfig{Format: format}).Validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.format = format
+	return nil
+}
+
+// Info implements logging.Logger
+func (l *CapturingLogger) Info(msg string, keyVals ...interface{}) {
+	l.record(logtypes.LOG_LEVEL_INFO, msg, keyVals)
+}
+
+// Debug implements logging.Logger
+func (l *CapturingLogger) Debug(msg string, keyVals ...interface{}) {
+	l.record(logtypes.LOG_LEVEL_DEBUG, msg, keyVals)
+}
+
+// Error implements logging.Logger
+func (l *CapturingLogger) Error(msg string, keyVals ...interface{}) {
+	l.record(logtypes.LOG_LEVEL_ERROR, msg, keyVals)
+}
+
+// ApplyConfig implements logging.Logger
+func (l *CapturingLogger) ApplyConfig(config logtypes.LoggingConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if len(config.Level) > 0 {
+		_ = l.SetLogLevel(config.Level)
+	}
+	if len(config.Format) > 0 {
+		_ = l.SetLogFormat(config.Format)
+	}
+	return nil
+}
+
+// GetLogLevel returns the current log level
+func (l *CapturingLogger) GetLogLevel() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.level
+}
+
+// GetLogFormat returns the current log format
+func (l *CapturingLogger) GetLogFormat() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.format
+}
+
+// Entries returns a copy of the recorded entries, in recorded order
+func (l *CapturingLogger) Entries() []CapturedLogEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	result := make([]CapturedLogEntry, len(l.entries))
+	copy(result, l.entries)
+	return result
+}
+
+// Reset removes all the recorded entries
+func (l *CapturingLogger) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+}
+
+// FindEntries returns the recorded entries which match level (any level if empty),
+// message contains the provided text and contains all provided fields
+func (l *CapturingLogger) FindEntries(level, msgContains string, keyVals ...interface{}) []CapturedLogEntry {
+	wantFields := capturedLogFields(keyVals)
+	var result []CapturedLogEntry
+	for _, entry := range l.Entries() {
+		if len(level) > 0 && entry.Level != level {
+			continue
+		}
+		if !strings.Contains(entry.Message, msgContains) {
+			continue
+		}
+		matched := true
+		for key, value := range wantFields {
+			if !entry.HasField(key, value) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// ExpectEntry notify error and return `false` if no entry matches level, message and fields, see FindEntries
+func (l *CapturingLogger) ExpectEntry(t *testing.T, level, msgContains string, keyVals ...interface{}) bool {
+	if len(l.FindEntries(level, msgContains, keyVals...)) > 0 {
+		return true
+	}
+	t.Errorf("want %s entry contains [%s] with fields %v but not found, captured log:\n%s", level, msgContains, keyVals, l.Dump())
+	return false
+}
+
+// ExpectErrorEntry notify error and return `false` if no Error entry matches message and fields
+func (l *CapturingLogger) ExpectErrorEntry(t *testing.T, msgContains string, keyVals ...interface{}) bool {
+	return l.ExpectEntry(t, logtypes.LOG_LEVEL_ERROR, msgContains, keyVals...)
+}
+
+// ExpectInfoEntry notify error and return `false` if no Info entry matches message and fields
+func (l *CapturingLogger) ExpectInfoEntry(t *testing.T, msgContains string, keyVals ...interface{}) bool {
+	return l.ExpectEntry(t, logtypes.LOG_LEVEL_INFO, msgContains, keyVals...)
+}
+
+// ExpectDebugEntry notify error and return `false` if no Debug entry matches message and fields
+func (l *CapturingLogger) ExpectDebugEntry(t *testing.T, msgContains string, keyVals ...interface{}) bool {
+	return l.ExpectEntry(t, logtypes.LOG_LEVEL_DEBUG, msgContains, keyVals...)
+}
+
+// ExpectNoEntry notify error and return `false` if any entry matches level, message and fields
+func (l *CapturingLogger) ExpectNoEntry(t *testing.T, level, msgContains string, keyVals ...interface{}) bool {
+	found := l.FindEntries(level, msgContains, keyVals...)
+	if len(found) < 1 {
+		return true
+	}
+	t.Errorf("want no %s entry contains [%s] with fields %v but found %d, captured log:\n%s", level, msgContains, keyVals, len(found), l.Dump())
+	return false
+}
+
+// Dump returns all the recorded entries as text, one entry per line
+func (l *CapturingLogger) Dump() string {
+	entries := l.Entries()
+	if len(entries) < 1 {
+		return "(no entry)"
+	}
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = entry.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DumpOnFailure registers a cleanup function which prints the captured log if the test failed
+func (l *CapturingLogger) DumpOnFailure(t *testing.T) {
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Logf("captured log:\n%s", l.Dump())
+		}
+	})
+}
+
+// record appends the entry if level is enabled
+func (l *CapturingLogger) record(level, msg string, keyVals []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if capturedLogLevelOrder(level) < capturedLogLevelOrder(l.level) {
+		return
+	}
+	l.entries = append(l.entries, CapturedLogEntry{
+		Level:   level,
+		Message: msg,
+		Fields:  capturedLogFields(keyVals),
+	})
+}
+
+// capturedLogLevelOrder returns the severity order of the level, empty level enables all levels
+func capturedLogLevelOrder(level string) int {
+	switch level {
+	case logtypes.LOG_LEVEL_DEBUG:
+		return 1
+	case logtypes.LOG_LEVEL_INFO:
+		return 2
+	case logtypes.LOG_LEVEL_ERROR:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// capturedLogFields converts key/values into fields, leniently like the logging package does
+func capturedLogFields(keyVals []interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for i := 0; i < len(keyVals); i += 2 {
+		if i+1 >= len(keyVals) {
+			fields["!BADKEY"] = keyVals[i]
+			break
+		}
+		key, isString := keyVals[i].(string)
+		if !isString {
+			key = fmt.Sprintf("%v", keyVals[i])
+		}
+		fields[key] = keyVals[i+1]
+	}
+	return fields
+}
@@ -0,0 +1,98 @@
+package logtest
+
+import (
+	"fmt"
+	"github.com/EscanBE/go-lib/logging"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"github.com/EscanBE/go-lib/test_utils"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+var _ logging.Logger = &CapturingLogger{}
+
+func TestCapturingLogger(t *testing.T) {
+	logger := NewCapturingLogger()
+	logger.DumpOnFailure(t)
+
+	logger.Debug("debug message", "k", "v")
+	logger.Info("info message", "count", 2)
+	logger.Error("failed to send message", "chat-id", int64(123), "error", fmt.Errorf("timeout"))
+
+	require.Len(t, logger.Entries(), 3)
+	require.True(t, logger.ExpectDebugEntry(t, "debug", "k", "v"))
+	require.True(t, logger.ExpectInfoEntry(t, "info", "count", 2))
+	require.True(t, logger.ExpectErrorEntry(t, "failed to send", "chat-id", 123, "error", "timeout"))
+	require.True(t, logger.ExpectNoEntry(t, logtypes.LOG_LEVEL_ERROR, "debug message"))
+
+	require.Empty(t, logger.FindEntries(logtypes.LOG_LEVEL_ERROR, "failed", "chat-id", 456))
+	require.Empty(t, logger.FindEntries(logtypes.LOG_LEVEL_INFO, "failed"))
+	require.Len(t, logger.FindEntries("", "message"), 3, "empty level matches any level")
+
+	require.Contains(t, logger.Dump(), "[error] failed to send message chat-id=123 error=timeout")
+
+	logger.Reset()
+	require.Empty(t, logger.Entries())
+	require.Equal(t, "(no entry)", logger.Dump())
+}
+
+func TestCapturingLogger_SetLogLevel(t *testing.T) {
+	logger := NewCapturingLogger()
+	require.Error(t, logger.SetLogLevel("invalid"))
+	require.NoError(t, logger.SetLogLevel(logtypes.LOG_LEVEL_INFO))
+	require.Equal(t, logtypes.LOG_LEVEL_INFO, logger.GetLogLevel())
+
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Error("error")
+
+	entries := logger.Entries()
+	require.Len(t, entries, 2, "debug must be ignored")
+	require.Equal(t, logtypes.LOG_LEVEL_INFO, entries[0].Level)
+	require.Equal(t, logtypes.LOG_LEVEL_ERROR, entries[1].Level)
+}
+
+func TestCapturingLogger_ApplyConfig(t *testing.T) {
+	logger := NewCapturingLogger()
+	require.Error(t, logger.ApplyConfig(logtypes.LoggingConfig{Format: "invalid"}))
+	require.Error(t, logger.SetLogFormat(""))
+	require.NoError(t, logger.ApplyConfig(logtypes.LoggingConfig{
+		Level:  logtypes.LOG_LEVEL_ERROR,
+		Format: logtypes.LOG_FORMAT_TEXT,
+	}))
+	require.Equal(t, logtypes.LOG_LEVEL_ERROR, logger.GetLogLevel())
+	require.Equal(t, logtypes.LOG_FORMAT_TEXT, logger.GetLogFormat())
+}
+
+func TestCapturingLogger_MalformedKeyValues(t *testing.T) {
+	defer test_utils.DeferWantNoPanic(t)
+
+	logger := NewCapturingLogger()
+	logger.Info("odd", "k", "v", "dangling")
+	logger.Info("non-string key", 1, "v")
+
+	require.True(t, logger.ExpectInfoEntry(t, "odd", "k", "v", "!BADKEY", "dangling"))
+	require.True(t, logger.ExpectInfoEntry(t, "non-string key", "1", "v"))
+}
+
+func TestCapturingLogger_Concurrent(t *testing.T) {
+	logger := NewCapturingLogger()
+
+	const goroutines = 10
+	const perGoroutine = 100
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				logger.Info("concurrent", "goroutine", i, "index", j)
+				_ = logger.FindEntries(logtypes.LOG_LEVEL_INFO, "concurrent", "goroutine", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	require.Len(t, logger.Entries(), goroutines*perGoroutine)
+}
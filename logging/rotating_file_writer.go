@@ -0,0 +1,376 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	_ io.WriteCloser = &RotatingFileWriter{}
+)
+
+// backupTimeFormat is the layout of timestamp which will be appended into name of the rotated files
+const backupTimeFormat = "20060102T150405.000"
+
+// RotatingFileWriter is an io.WriteCloser which writes into a file and rotates it by size and/or day,
+// rotated files can be compressed and the number of them can be limited.
+type RotatingFileWriter struct {
+	mu           sync.Mutex
+	config       logtypes.LoggingFileOutputConfig
+	maxSizeBytes int64            // rotate when file size exceeds, 0 = disabled
+	now          func() time.Time // source of time, replaceable for testing purpose
+	file         *os.File         // current opening file, nil when not opened yet
+	size         int64            // size of the current opening file
+	day          string           // day (yyyy-mm-dd) which the current opening file belongs to
+	closed       bool             // closed state, writer can not be used anymore after closed
+	sighupChan   chan os.Signal   // receives SIGHUP when ReopenOnSighup was enabled
+	stopChan     chan struct{}    // closed when writer closed, to stop listening SIGHUP
+	sighupWg     sync.WaitGroup   // wait for SIGHUP listener to be stopped
+}
+
+// NewRotatingFileWriter opens (or creates) the file at provided path and returns a RotatingFileWriter instance.
+// If ReopenOnSighup was enabled, the file will be reopened each time the process receives SIGHUP,
+// notice that SIGHUP will no longer terminate the process in that case.
+func NewRotatingFileWriter(config logtypes.LoggingFileOutputConfig) (*RotatingFileWriter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	w := &RotatingFileWriter{
+		config:       config,
+		maxSizeBytes: int64(config.MaxSizeMb) * 1024 * 1024,
+		now:          time.Now,
+	}
+
+	if err := w.openFile(); err != nil {
+		return nil, err
+	}
+
+	if config.ReopenOnSighup {
+		w.sighupChan = make(chan os.Signal, 1)
+		w.stopChan = make(chan struct{})
+		signal.Notify(w.sighupChan, syscall.SIGHUP)
+		w.sighupWg.Add(1)
+		go w.listenSighup()
+	}
+
+	return w, nil
+}
+
+// Write implements io.Writer, rotates the file before writing if needed
+func (w *RotatingFileWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, fmt.Errorf("file writer %s had been closed", w.config.Path)
+	}
+
+	if w.file == nil {
+		if err = w.openFile(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.shouldRotate(int64(len(p))) {
+		if err = w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the current file, moves it to a backup file and opens a new one
+func (w *RotatingFileWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return fmt.Errorf("file writer %s had been closed", w.config.Path)
+	}
+
+	return w.rotate()
+}
+
+// Reopen closes and reopens the file at the configured path,
+// used when the file was moved by an external tool like logrotate
+func (w *RotatingFileWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return fmt.Errorf("file writer %s had been closed", w.config.Path)
+	}
+
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+
+	return w.openFile()
+}
+
+// Close implements io.Closer, closes the file and stops listening SIGHUP
+func (w *RotatingFileWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	err := w.closeFile()
+	w.mu.Unlock()
+
+	if w.stopChan != nil {
+		signal.Stop(w.sighupChan)
+		close(w.stopChan)
+		w.sighupWg.Wait()
+	}
+
+	return err
+}
+
+// listenSighup reopens the file each time receives SIGHUP, until writer closed
+func (w *RotatingFileWriter) listenSighup() {
+	defer w.sighupWg.Done()
+	for {
+		select {
+		case <-w.stopChan:
+			return
+		case <-w.sighupChan:
+			if err := w.Reopen(); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "failed to reopen log file %s: %v\n", w.config.Path, err)
+			}
+		}
+	}
+}
+
+// shouldRotate returns true if the current file must be rotated before writing the next bytes
+func (w *RotatingFileWriter) shouldRotate(nextWriteSize int64) bool {
+	if w.config.RotateDaily && w.day != dayOf(w.now()) {
+		return true
+	}
+	if w.maxSizeBytes > 0 && w.size > 0 && w.size+nextWriteSize > w.maxSizeBytes {
+		return true
+	}
+	return false
+}
+
+// openFile opens the file at configured path for appending, creates it and the parent directories if not exists
+func (w *RotatingFileWriter) openFile() error {
+	if err := os.MkdirAll(filepath.Dir(w.config.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for log file %s: %v", w.config.Path, err)
+	}
+
+	file, err := os.OpenFile(w.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %v", w.config.Path, err)
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to stat log file %s: %v", w.config.Path, err)
+	}
+
+	w.file = file
+	w.size = fileInfo.Size()
+	if w.size > 0 {
+		w.day = dayOf(fileInfo.ModTime())
+	} else {
+		w.day = dayOf(w.now())
+	}
+
+	return nil
+}
+
+// closeFile closes the current opening file if any
+func (w *RotatingFileWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	w.size = 0
+	return err
+}
+
+// rotate moves the current file to a backup file, compresses it if needed, removes the outdated backups and opens a new file
+func (w *RotatingFileWriter) rotate() error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+
+	backupPath := w.nextBackupPath()
+	if err := os.Rename(w.config.Path, backupPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate log file %s: %v", w.config.Path, err)
+	}
+
+	if w.config.Compress {
+		if err := compressFile(backupPath); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to compress rotated log file %s: %v\n", backupPath, err)
+		}
+	}
+
+	if w.config.MaxBackups > 0 {
+		if err := w.removeOutdatedBackups(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to remove outdated rotated log files of %s: %v\n", w.config.Path, err)
+		}
+	}
+
+	return w.openFile()
+}
+
+// nextBackupPath returns a non-existing path which the current file will be moved to,
+// sequence is used to distinguish backups rotated within the same millisecond.
+// Format: <dir>/<name>-<timestamp>[-<sequence>]<ext>
+func (w *RotatingFileWriter) nextBackupPath() string {
+	dir, prefix, ext := w.splitPath()
+	timestamp := w.now().UTC().Format(backupTimeFormat)
+
+	sequence := 0
+	if backups, err := w.listBackups(); err == nil {
+		for _, b := range backups {
+			if b.timestamp == timestamp && b.sequence >= sequence {
+				sequence = b.sequence + 1
+			}
+		}
+	}
+
+	var name string
+	if sequence == 0 {
+		name = fmt.Sprintf("%s%s%s", prefix, timestamp, ext)
+	} else {
+		name = fmt.Sprintf("%s%s-%d%s", prefix, timestamp, sequence, ext)
+	}
+	return filepath.Join(dir, name)
+}
+
+// removeOutdatedBackups removes the oldest backups, keeps at most MaxBackups files
+func (w *RotatingFileWriter) removeOutdatedBackups() error {
+	backups, err := w.listBackups()
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > w.config.MaxBackups {
+		if err := os.Remove(backups[0].path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// rotatedBackup holds information of a rotated file
+type rotatedBackup struct {
+	path      string
+	timestamp string
+	sequence  int
+}
+
+// listBackups returns the rotated files, sorted from the oldest to the newest
+func (w *RotatingFileWriter) listBackups() ([]rotatedBackup, error) {
+	dir, prefix, ext := w.splitPath()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []rotatedBackup
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".gz")
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		timestamp, sequenceStr, hasSequence := strings.Cut(suffix, "-")
+		if _, err := time.Parse(backupTimeFormat, timestamp); err != nil {
+			continue
+		}
+		sequence := 0
+		if hasSequence {
+			sequence, err = strconv.Atoi(sequenceStr)
+			if err != nil {
+				continue
+			}
+		}
+		backups = append(backups, rotatedBackup{
+			path:      filepath.Join(dir, entry.Name()),
+			timestamp: timestamp,
+			sequence:  sequence,
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].timestamp != backups[j].timestamp {
+			return backups[i].timestamp < backups[j].timestamp
+		}
+		return backups[i].sequence < backups[j].sequence
+	})
+
+	return backups, nil
+}
+
+// splitPath returns directory, backup file name prefix and extension of the configured path.
+// Eg: /var/log/app.log => /var/log, app-, .log
+func (w *RotatingFileWriter) splitPath() (dir, prefix, ext string) {
+	dir = filepath.Dir(w.config.Path)
+	base := filepath.Base(w.config.Path)
+	ext = filepath.Ext(base)
+	prefix = strings.TrimSuffix(base, ext) + "-"
+	return
+}
+
+// compressFile gzip the file at provided path into <path>.gz and removes the original file
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if errClose := dst.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		_ = os.Remove(path + ".gz")
+		return err
+	}
+
+	_ = src.Close()
+	return os.Remove(path)
+}
+
+// dayOf returns the day (UTC) of the provided time, in format yyyy-mm-dd
+func dayOf(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
@@ -0,0 +1,220 @@
+package logging
+
+import (
+	"compress/gzip"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNewRotatingFileWriter(t *testing.T) {
+	t.Run("create file and parent directories", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sub", "dir", "app.log")
+		w, err := NewRotatingFileWriter(logtypes.LoggingFileOutputConfig{Path: path})
+		require.NoError(t, err)
+		defer func() {
+			_ = w.Close()
+		}()
+		require.FileExists(t, path)
+	})
+
+	t.Run("append to existing file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		require.NoError(t, os.WriteFile(path, []byte("existing\n"), 0o644))
+
+		w, err := NewRotatingFileWriter(logtypes.LoggingFileOutputConfig{Path: path})
+		require.NoError(t, err)
+		_, err = w.Write([]byte("new\n"))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		require.Equal(t, "existing\nnew\n", readFile(t, path))
+	})
+
+	t.Run("reject invalid config", func(t *testing.T) {
+		_, err := NewRotatingFileWriter(logtypes.LoggingFileOutputConfig{})
+		require.Error(t, err)
+	})
+}
+
+func TestRotatingFileWriter_RotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	w, err := NewRotatingFileWriter(logtypes.LoggingFileOutputConfig{Path: path})
+	require.NoError(t, err)
+	defer func() {
+		_ = w.Close()
+	}()
+
+	w.maxSizeBytes = 10
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	w.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n"} {
+		_, err = w.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	backups, err := w.listBackups()
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	require.Equal(t, "line-1\n", readFile(t, backups[0].path))
+	require.Equal(t, "line-2\n", readFile(t, backups[1].path))
+	require.Equal(t, "line-3\n", readFile(t, path))
+}
+
+func TestRotatingFileWriter_RotateDaily(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	now := time.Now().UTC()
+	w, err := NewRotatingFileWriter(logtypes.LoggingFileOutputConfig{Path: path, RotateDaily: true})
+	require.NoError(t, err)
+	defer func() {
+		_ = w.Close()
+	}()
+	w.now = func() time.Time {
+		return now
+	}
+
+	_, err = w.Write([]byte("today\n"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("still today\n"))
+	require.NoError(t, err)
+
+	backups, err := w.listBackups()
+	require.NoError(t, err)
+	require.Empty(t, backups)
+
+	now = now.Add(24 * time.Hour)
+	_, err = w.Write([]byte("tomorrow\n"))
+	require.NoError(t, err)
+
+	backups, err = w.listBackups()
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	require.Equal(t, "today\nstill today\n", readFile(t, backups[0].path))
+	require.Equal(t, "tomorrow\n", readFile(t, path))
+}
+
+func TestRotatingFileWriter_MaxBackupsAndCompress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	w, err := NewRotatingFileWriter(logtypes.LoggingFileOutputConfig{
+		Path:       path,
+		MaxBackups: 2,
+		Compress:   true,
+	})
+	require.NoError(t, err)
+	defer func() {
+		_ = w.Close()
+	}()
+
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	w.now = func() time.Time {
+		return now // same timestamp, backups must be distinguished by sequence
+	}
+
+	for _, content := range []string{"1", "2", "3", "4"} {
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, w.Rotate())
+	}
+
+	backups, err := w.listBackups()
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	for i, want := range []string{"3", "4"} {
+		require.True(t, strings.HasSuffix(backups[i].path, ".gz"), "backup must be compressed")
+		require.Equal(t, want, readGzipFile(t, backups[i].path))
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 3, "2 backups + current file")
+}
+
+func TestRotatingFileWriter_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	movedPath := filepath.Join(dir, "app.log.1")
+
+	w, err := NewRotatingFileWriter(logtypes.LoggingFileOutputConfig{Path: path})
+	require.NoError(t, err)
+	defer func() {
+		_ = w.Close()
+	}()
+
+	_, err = w.Write([]byte("before\n"))
+	require.NoError(t, err)
+
+	require.NoError(t, os.Rename(path, movedPath)) // simulate logrotate
+	require.NoError(t, w.Reopen())
+
+	_, err = w.Write([]byte("after\n"))
+	require.NoError(t, err)
+
+	require.Equal(t, "before\n", readFile(t, movedPath))
+	require.Equal(t, "after\n", readFile(t, path))
+}
+
+func TestRotatingFileWriter_ReopenOnSighup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	movedPath := filepath.Join(dir, "app.log.1")
+
+	w, err := NewRotatingFileWriter(logtypes.LoggingFileOutputConfig{Path: path, ReopenOnSighup: true})
+	require.NoError(t, err)
+	defer func() {
+		_ = w.Close()
+	}()
+
+	require.NoError(t, os.Rename(path, movedPath))
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, 3*time.Second, 10*time.Millisecond, "file must be re-created after SIGHUP")
+}
+
+func TestRotatingFileWriter_Close(t *testing.T) {
+	w, err := NewRotatingFileWriter(logtypes.LoggingFileOutputConfig{
+		Path:           filepath.Join(t.TempDir(), "app.log"),
+		ReopenOnSighup: true,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, w.Close())
+	require.NoError(t, w.Close(), "close twice should not error")
+
+	_, err = w.Write([]byte("x"))
+	require.Error(t, err)
+	require.Error(t, w.Rotate())
+	require.Error(t, w.Reopen())
+}
+
+func readFile(t *testing.T, path string) string {
+	bz, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(bz)
+}
+
+func readGzipFile(t *testing.T, path string) string {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	bz, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	return string(bz)
+}
@@ -0,0 +1,238 @@
+package logging
+
+import (
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSampledKeys is the maximum number of message keys which have their own counters,
+	// messages beyond it share a single counter, so a flood of unique messages can not exhaust memory
+	maxSampledKeys = 10_000
+
+	// maxSummaryMessages is the maximum number of distinct messages reported in the summary of dropped entries
+	maxSummaryMessages = 10
+
+	// overflowSampleKey is the key of the counter shared by messages beyond maxSampledKeys
+	overflowSampleKey = "\x00overflow"
+)
+
+// sampler drops entries of hot paths, following LoggingSamplingConfig, and keeps track of the dropped entries.
+// It is safe for concurrent use.
+type sampler struct {
+	mu     sync.Mutex
+	config logtypes.LoggingSamplingConfig
+	now    func() time.Time
+
+	counters    map[string]*sampleCounter // per message key, or a single key when sampling is not per message
+	windowStart time.Time                 // start of the current window of the limit across all messages
+	windowCount int                       // number of entries passed in the current window of the limit
+
+	droppedTotal    uint64
+	droppedMessages map[string]uint64 // number of dropped entries by message, up to maxSummaryMessages messages
+	droppedLevel    string            // highest level of the dropped entries
+}
+
+// sampleCounter counts the entries of a message key within the current window
+type sampleCounter struct {
+	windowStart time.Time
+	count       uint64
+}
+
+// samplingSummary reports the entries dropped since the previous summary
+type samplingSummary struct {
+	dropped  uint64
+	level    string            // highest level of the dropped entries
+	messages map[string]uint64 // number of dropped entries by message, up to maxSummaryMessages messages
+}
+
+// newSampler returns a sampler, the config must be validated before
+func newSampler(config logtypes.LoggingSamplingConfig) *sampler {
+	return &sampler{
+		config:          config,
+		now:             time.Now,
+		counters:        make(map[string]*sampleCounter),
+		droppedMessages: make(map[string]uint64),
+	}
+}
+
+// sample returns false if the entry should be dropped, the dropped entry is counted for the summary.
+// Error entries are never sampled unless SampleErrors is enabled.
+func (s *sampler) sample(level, msg string) bool {
+	if level == logtypes.LOG_LEVEL_ERROR && !s.config.SampleErrors {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.samplePerKey(msg, now) && s.withinLimit(now) {
+		return true
+	}
+
+	s.recordDropped(level, msg)
+	return false
+}
+
+// samplePerKey applies the rule: first Burst entries per Period, then 1 in every Thereafter entries, to the message key.
+// Always returns true when neither Burst nor Thereafter is set.
+func (s *sampler) samplePerKey(msg string, now time.Time) bool {
+	burst := uint64(s.config.Burst)
+	thereafter := uint64(s.config.Thereafter)
+	if burst == 0 && thereafter == 0 {
+		return true
+	}
+
+	counter := s.counterOf(msg, now)
+	if counter.windowStart.IsZero() || (s.config.Period > 0 && now.Sub(counter.windowStart) >= s.config.Period) {
+		counter.windowStart = now
+		counter.count = 0
+	}
+	counter.count++
+
+	if counter.count <= burst {
+		return true
+	}
+	return thereafter > 0 && (counter.count-burst-1)%thereafter == 0
+}
+
+// withinLimit returns false if the number of entries in the current window across all messages reached MaxPerPeriod
+func (s *sampler) withinLimit(now time.Time) bool {
+	if s.config.MaxPerPeriod < 1 {
+		return true
+	}
+
+	if s.windowStart.IsZero() || now.Sub(s.windowStart) >= s.config.Period {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	if s.windowCount >= s.config.MaxPerPeriod {
+		return false
+	}
+	s.windowCount++
+	return true
+}
+
+// counterOf returns the counter of the message key, creates one if not exists
+func (s *sampler) counterOf(msg string, now time.Time) *sampleCounter {
+	key := ""
+	if s.config.PerMessage {
+		key = msg
+	}
+
+	if counter, found := s.counters[key]; found {
+		return counter
+	}
+
+	if len(s.counters) >= maxSampledKeys {
+		s.pruneCounters(now)
+		if len(s.counters) >= maxSampledKeys {
+			key = overflowSampleKey
+			if counter, found := s.counters[key]; found {
+				return counter
+			}
+		}
+	}
+
+	counter := &sampleCounter{}
+	s.counters[key] = counter
+	return counter
+}
+
+// pruneCounters removes the counters which window ended
+func (s *sampler) pruneCounters(now time.Time) {
+	if s.config.Period <= 0 {
+		return
+	}
+	for key, counter := range s.counters {
+		if now.Sub(counter.windowStart) >= s.config.Period {
+			delete(s.counters, key)
+		}
+	}
+}
+
+// recordDropped counts the dropped entry for the summary
+func (s *sampler) recordDropped(level, msg string) {
+	s.droppedTotal++
+	if levelOrder(level) > levelOrder(s.droppedLevel) {
+		s.droppedLevel = level
+	}
+	if _, found := s.droppedMessages[msg]; found || len(s.droppedMessages) < maxSummaryMessages {
+		s.droppedMessages[msg]++
+	}
+}
+
+// takeSummary returns the summary of entries dropped since the previous call and resets it,
+// returns false if nothing was dropped
+func (s *sampler) takeSummary() (samplingSummary, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.droppedTotal < 1 {
+		return samplingSummary{}, false
+	}
+
+	summary := samplingSummary{
+		dropped:  s.droppedTotal,
+		level:    s.droppedLevel,
+		messages: s.droppedMessages,
+	}
+
+	s.droppedTotal = 0
+	s.droppedLevel = ""
+	s.droppedMessages = make(map[string]uint64)
+
+	return summary, true
+}
+
+// keyVals returns the summary as key/values of a log entry
+func (s samplingSummary) keyVals() []interface{} {
+	messages := make(map[string]interface{}, len(s.messages))
+	for msg, dropped := range s.messages {
+		messages[msg] = dropped
+	}
+	return []interface{}{
+		"dropped", s.dropped,
+		"messages", messages,
+	}
+}
+
+// samplingSummaryMessage is the message of the summary entry
+const samplingSummaryMessage = "log entries were dropped by sampling"
+
+// startSamplingSummary reports the dropped entries periodically, via the provided function which must bypass sampling.
+// The returned stop function stops reporting and reports the remaining dropped entries, it is safe to be called multiple times.
+func startSamplingSummary(s *sampler, interval time.Duration, report func(summary samplingSummary)) (stop func()) {
+	flush := func() {
+		if summary, ok := s.takeSummary(); ok {
+			report(summary)
+		}
+	}
+
+	stopChan := make(chan struct{})
+	doneChan := make(chan struct{})
+	go func() {
+		defer close(doneChan)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopChan:
+				return
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopChan)
+			<-doneChan
+			flush()
+		})
+	}
+}
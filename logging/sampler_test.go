@@ -0,0 +1,200 @@
+package logging
+
+import (
+	"fmt"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestSampler returns a sampler with a clock which can be moved forward
+func newTestSampler(config logtypes.LoggingSamplingConfig) (*sampler, func(d time.Duration)) {
+	config.Enabled = true
+	s := newSampler(config)
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.now = func() time.Time {
+		return now
+	}
+	return s, func(d time.Duration) {
+		now = now.Add(d)
+	}
+}
+
+// countSampled returns number of entries passed the sampler
+func countSampled(s *sampler, level, msg string, times int) int {
+	var passed int
+	for i := 0; i < times; i++ {
+		if s.sample(level, msg) {
+			passed++
+		}
+	}
+	return passed
+}
+
+func Test_sampler_PerMessage(t *testing.T) {
+	s, _ := newTestSampler(logtypes.LoggingSamplingConfig{
+		PerMessage: true,
+		Burst:      2,
+		Period:     time.Minute,
+		Thereafter: 10,
+	})
+
+	require.Equal(t, 2+1, countSampled(s, logtypes.LOG_LEVEL_INFO, "rpc failed", 12))
+	require.Equal(t, 2+1, countSampled(s, logtypes.LOG_LEVEL_INFO, "tx processed", 12), "other messages have their own counters")
+	require.Equal(t, 1, countSampled(s, logtypes.LOG_LEVEL_INFO, "rpc failed", 10), "1 in every 10 after the burst")
+
+	summary, ok := s.takeSummary()
+	require.True(t, ok)
+	require.Equal(t, uint64(9+9+9), summary.dropped)
+	require.Equal(t, map[string]uint64{"rpc failed": 18, "tx processed": 9}, summary.messages)
+	require.Equal(t, logtypes.LOG_LEVEL_INFO, summary.level)
+
+	_, ok = s.takeSummary()
+	require.False(t, ok, "summary must be reset")
+}
+
+func Test_sampler_SharedCounter(t *testing.T) {
+	s, _ := newTestSampler(logtypes.LoggingSamplingConfig{
+		Burst:  3,
+		Period: time.Minute,
+	})
+
+	require.Equal(t, 3, countSampled(s, logtypes.LOG_LEVEL_INFO, "a", 2)+countSampled(s, logtypes.LOG_LEVEL_INFO, "b", 2))
+}
+
+func Test_sampler_BurstWindow(t *testing.T) {
+	s, advance := newTestSampler(logtypes.LoggingSamplingConfig{
+		PerMessage: true,
+		Burst:      5,
+		Period:     time.Second,
+	})
+
+	require.Equal(t, 5, countSampled(s, logtypes.LOG_LEVEL_INFO, "msg", 100))
+	advance(500 * time.Millisecond)
+	require.Equal(t, 0, countSampled(s, logtypes.LOG_LEVEL_INFO, "msg", 100), "same window")
+	advance(500 * time.Millisecond)
+	require.Equal(t, 5, countSampled(s, logtypes.LOG_LEVEL_INFO, "msg", 100), "new window")
+}
+
+func Test_sampler_MaxPerPeriod(t *testing.T) {
+	s, advance := newTestSampler(logtypes.LoggingSamplingConfig{
+		PerMessage:   true,
+		Burst:        100,
+		Period:       time.Second,
+		MaxPerPeriod: 10,
+	})
+
+	require.Equal(t, 6, countSampled(s, logtypes.LOG_LEVEL_INFO, "a", 6))
+	require.Equal(t, 4, countSampled(s, logtypes.LOG_LEVEL_DEBUG, "b", 6), "limit is across all messages")
+	advance(time.Second)
+	require.Equal(t, 10, countSampled(s, logtypes.LOG_LEVEL_INFO, "c", 20))
+
+	summary, ok := s.takeSummary()
+	require.True(t, ok)
+	require.Equal(t, uint64(2+10), summary.dropped)
+	require.Equal(t, logtypes.LOG_LEVEL_INFO, summary.level, "highest level of dropped entries")
+
+	t.Run("limit only", func(t *testing.T) {
+		s, _ := newTestSampler(logtypes.LoggingSamplingConfig{
+			Period:       time.Second,
+			MaxPerPeriod: 3,
+		})
+		require.Equal(t, 3, countSampled(s, logtypes.LOG_LEVEL_INFO, "a", 10))
+	})
+}
+
+func Test_sampler_Errors(t *testing.T) {
+	s, _ := newTestSampler(logtypes.LoggingSamplingConfig{
+		Thereafter: 100,
+	})
+	require.Equal(t, 10, countSampled(s, logtypes.LOG_LEVEL_ERROR, "failed", 10), "errors are not sampled by default")
+	_, ok := s.takeSummary()
+	require.False(t, ok)
+
+	s, _ = newTestSampler(logtypes.LoggingSamplingConfig{
+		Thereafter:   100,
+		SampleErrors: true,
+	})
+	require.Equal(t, 1, countSampled(s, logtypes.LOG_LEVEL_ERROR, "failed", 10))
+	summary, ok := s.takeSummary()
+	require.True(t, ok)
+	require.Equal(t, logtypes.LOG_LEVEL_ERROR, summary.level)
+}
+
+func Test_sampler_Limits(t *testing.T) {
+	s, advance := newTestSampler(logtypes.LoggingSamplingConfig{
+		PerMessage: true,
+		Burst:      1,
+		Period:     time.Second,
+	})
+
+	for i := 0; i < maxSampledKeys; i++ {
+		require.True(t, s.sample(logtypes.LOG_LEVEL_INFO, fmt.Sprintf("unique %d", i)))
+	}
+	require.Len(t, s.counters, maxSampledKeys)
+
+	// beyond the limit, messages share a counter
+	require.True(t, s.sample(logtypes.LOG_LEVEL_INFO, "overflow 1"))
+	require.False(t, s.sample(logtypes.LOG_LEVEL_INFO, "overflow 2"))
+	require.Len(t, s.counters, maxSampledKeys+1)
+
+	// expired counters are pruned
+	advance(time.Second)
+	require.True(t, s.sample(logtypes.LOG_LEVEL_INFO, "after pruned"))
+	require.Len(t, s.counters, 1, "overflow counter is pruned as well")
+
+	summary, ok := s.takeSummary()
+	require.True(t, ok)
+	require.Equal(t, uint64(1), summary.dropped)
+
+	for i := 0; i < maxSummaryMessages*2; i++ {
+		msg := fmt.Sprintf("dropped %d", i)
+		require.True(t, s.sample(logtypes.LOG_LEVEL_INFO, msg))
+		require.False(t, s.sample(logtypes.LOG_LEVEL_INFO, msg))
+	}
+	summary, ok = s.takeSummary()
+	require.True(t, ok)
+	require.Equal(t, uint64(maxSummaryMessages*2), summary.dropped, "total must count all messages")
+	require.Len(t, summary.messages, maxSummaryMessages)
+}
+
+func Test_startSamplingSummary(t *testing.T) {
+	s, _ := newTestSampler(logtypes.LoggingSamplingConfig{
+		Thereafter: 1000,
+	})
+
+	var mu sync.Mutex
+	var summaries []samplingSummary
+	stop := startSamplingSummary(s, 10*time.Millisecond, func(summary samplingSummary) {
+		mu.Lock()
+		defer mu.Unlock()
+		summaries = append(summaries, summary)
+	})
+	countOfSummaries := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(summaries)
+	}
+
+	require.Equal(t, 1, countSampled(s, logtypes.LOG_LEVEL_INFO, "msg", 5))
+	require.Eventually(t, func() bool {
+		return countOfSummaries() == 1
+	}, 2*time.Second, 5*time.Millisecond)
+
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 1, countOfSummaries(), "nothing dropped, nothing reported")
+
+	require.Equal(t, 0, countSampled(s, logtypes.LOG_LEVEL_INFO, "msg", 3))
+	stop()
+	stop() // stop twice should be fine
+	require.Equal(t, 2, countOfSummaries(), "remaining dropped entries must be reported when stopped")
+
+	require.Equal(t, uint64(4), summaries[0].dropped)
+	require.Equal(t, uint64(3), summaries[1].dropped)
+	require.Equal(t, []interface{}{
+		"dropped", uint64(3),
+		"messages", map[string]interface{}{"msg": uint64(3)},
+	}, summaries[1].keyVals())
+}
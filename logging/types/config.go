@@ -1,12 +1,59 @@
 package types
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // LoggingConfig will be used to apply logging config, it also provides utilities
 type LoggingConfig struct {
-	Level          string `mapstructure:"level"`
-	Format         string `mapstructure:"format"`
-	EnableProfiler bool   `mapstructure:"profiler"`
+	Level          string                    `mapstructure:"level"`
+	Format         string                    `mapstructure:"format"`
+	EnableProfiler bool                      `mapstructure:"profiler"`
+	FileOutputs    []LoggingFileOutputConfig `mapstructure:"file-outputs"`
+	// panic on malformed key/values (odd number, non-string keys), should only be enabled in tests.
+	// By default, the logger is lenient and never panic.
+	StrictKeyValues bool `mapstructure:"strict-key-values"`
+	// add file:line of the caller into every entry
+	Caller bool `mapstructure:"caller"`
+	// add stack trace of the caller into every Error entry
+	StackTraceOnError bool `mapstructure:"stack-trace-on-error"`
+	// rfc3339 (default), rfc3339nano, unix, unixms or a custom Go time layout like 2006-01-02 15:04:05.000
+	TimestampFormat string `mapstructure:"timestamp-format"`
+	// UTC (default), Local or an IANA time zone name like Asia/Ho_Chi_Minh
+	TimeZone string `mapstructure:"time-zone"`
+	// fields which will be added into every entry, like service name and version
+	StaticFields map[string]string     `mapstructure:"static-fields"`
+	Sampling     LoggingSamplingConfig `mapstructure:"sampling"`
+}
+
+// LoggingSamplingConfig holds configuration of sampling, to reduce the volume of entries when the logger is flooded.
+// Within each period, the first Burst entries are logged, then only 1 in every Thereafter entries,
+// counted per message when PerMessage is enabled, otherwise across all messages.
+// MaxPerPeriod limits the number of entries per period across all messages, on top of that.
+// Error entries are never sampled unless SampleErrors is enabled.
+// The number of dropped entries is reported periodically, so nothing disappears silently.
+type LoggingSamplingConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	PerMessage      bool          `mapstructure:"per-message"`      // count Burst and Thereafter per message instead of across all messages
+	Burst           int           `mapstructure:"burst"`            // number of entries logged per period before sampling, 0 = sampling from the first entry
+	Period          time.Duration `mapstructure:"period"`           // length of the window, required when burst or max-per-period is set
+	Thereafter      int           `mapstructure:"thereafter"`       // after the burst, log 1 in every N entries, 0 = drop all
+	MaxPerPeriod    int           `mapstructure:"max-per-period"`   // maximum number of entries per period across all messages, 0 = unlimited
+	SummaryInterval time.Duration `mapstructure:"summary-interval"` // interval of the summary of dropped entries, default 1 minute
+	SampleErrors    bool          `mapstructure:"sample-errors"`    // also sample Error entries
+}
+
+// LoggingFileOutputConfig holds configuration of a file output, log entries will be written into the file at Path,
+// besides the standard output of the logger
+type LoggingFileOutputConfig struct {
+	Path           string `mapstructure:"path"`
+	MaxSizeMb      int    `mapstructure:"max-size-mb"`      // rotate when the file exceeds this size, 0 = no size based rotation
+	RotateDaily    bool   `mapstructure:"rotate-daily"`     // rotate when the day changes
+	MaxBackups     int    `mapstructure:"max-backups"`      // number of rotated files to keep, 0 = keep all
+	Compress       bool   `mapstructure:"compress"`         // gzip the rotated files
+	ReopenOnSighup bool   `mapstructure:"reopen-on-sighup"` // reopen the file when receiving SIGHUP, for logrotate compatibility
 }
 
 // Validate performs validation on the LoggingConfig instance
@@ -29,9 +76,119 @@ func (c LoggingConfig) Validate() error {
 		// OK
 	} else if c.Format == LOG_FORMAT_JSON {
 		// OK
+	} else if c.Format == LOG_FORMAT_LOGFMT {
+		// OK
 	} else {
 		return fmt.Errorf("invalid log format %s", c.Format)
 	}
 
+	uniquePaths := make(map[string]bool)
+	for i, fileOutput := range c.FileOutputs {
+		if err := fileOutput.Validate(); err != nil {
+			return fmt.Errorf("invalid file output at index %d: %v", i, err)
+		}
+		if uniquePaths[fileOutput.Path] {
+			return fmt.Errorf("duplicated file output path %s", fileOutput.Path)
+		}
+		uniquePaths[fileOutput.Path] = true
+	}
+
+	if err := validateTimestampFormat(c.TimestampFormat); err != nil {
+		return err
+	}
+
+	if len(c.TimeZone) > 0 {
+		if _, err := time.LoadLocation(c.TimeZone); err != nil {
+			return fmt.Errorf("invalid log time zone %s: %v", c.TimeZone, err)
+		}
+	}
+
+	for key := range c.StaticFields {
+		if len(strings.TrimSpace(key)) < 1 {
+			return fmt.Errorf("static field key must not be empty")
+		}
+		if IsReservedLogFieldName(key) {
+			return fmt.Errorf("static field key %s is reserved", key)
+		}
+	}
+
+	if err := c.Sampling.Validate(); err != nil {
+		return fmt.Errorf("invalid sampling config: %v", err)
+	}
+
 	return nil
 }
+
+// Validate performs validation on the LoggingSamplingConfig instance
+func (c LoggingSamplingConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Burst < 0 {
+		return fmt.Errorf("invalid burst %d", c.Burst)
+	}
+	if c.Period < 0 {
+		return fmt.Errorf("invalid period %s", c.Period)
+	}
+	if c.Burst > 0 && c.Period == 0 {
+		return fmt.Errorf("period is required when burst is set")
+	}
+	if c.Thereafter < 0 {
+		return fmt.Errorf("invalid thereafter %d", c.Thereafter)
+	}
+	if c.MaxPerPeriod < 0 {
+		return fmt.Errorf("invalid max-per-period %d", c.MaxPerPeriod)
+	}
+	if c.MaxPerPeriod > 0 && c.Period == 0 {
+		return fmt.Errorf("period is required when max-per-period is set")
+	}
+	if c.Burst == 0 && c.Thereafter == 0 && c.MaxPerPeriod == 0 {
+		return fmt.Errorf("either burst, thereafter or max-per-period is required, otherwise all entries will be dropped")
+	}
+	if c.SummaryInterval < 0 {
+		return fmt.Errorf("invalid summary-interval %s", c.SummaryInterval)
+	}
+	return nil
+}
+
+// validateTimestampFormat returns error if the format is neither a predefined format nor a valid Go time layout
+func validateTimestampFormat(format string) error {
+	switch format {
+	case "", LOG_TIMESTAMP_FORMAT_RFC3339, LOG_TIMESTAMP_FORMAT_RFC3339_NANO, LOG_TIMESTAMP_FORMAT_UNIX, LOG_TIMESTAMP_FORMAT_UNIX_MS:
+		return nil
+	}
+
+	// a layout without any layout element will always produce the same output
+	sample := time.Date(2001, 2, 3, 4, 5, 6, 7, time.UTC)
+	if sample.Format(format) == format {
+		return fmt.Errorf("invalid log timestamp format %s", format)
+	}
+	return nil
+}
+
+// Validate performs validation on the LoggingFileOutputConfig instance
+func (c LoggingFileOutputConfig) Validate() error {
+	if len(strings.TrimSpace(c.Path)) < 1 {
+		return fmt.Errorf("missing file output path")
+	}
+	if c.MaxSizeMb < 0 {
+		return fmt.Errorf("invalid file output max-size-mb %d", c.MaxSizeMb)
+	}
+	if c.MaxBackups < 0 {
+		return fmt.Errorf("invalid file output max-backups %d", c.MaxBackups)
+	}
+	if c.ReopenOnSighup && (c.MaxSizeMb > 0 || c.RotateDaily) {
+		return fmt.Errorf("reopen-on-sighup is designed for external rotation, can not be combined with max-size-mb or rotate-daily")
+	}
+	return nil
+}
+
+// IsReservedLogFieldName returns true if the field name is reserved by the logger
+func IsReservedLogFieldName(name string) bool {
+	switch name {
+	case LOG_FIELD_TIME, LOG_FIELD_LEVEL, LOG_FIELD_MESSAGE, LOG_FIELD_CALLER, LOG_FIELD_STACK:
+		return true
+	default:
+		return false
+	}
+}
@@ -4,11 +4,12 @@ import (
 	"fmt"
 	"github.com/EscanBE/go-lib/test_utils"
 	"testing"
+	"time"
 )
 
 func TestLoggingConfig_Validate(t *testing.T) {
 	for _, level := range []string{LOG_LEVEL_DEBUG, LOG_LEVEL_INFO, LOG_LEVEL_ERROR} {
-		for _, format := range []string{LOG_FORMAT_JSON, LOG_FORMAT_TEXT} {
+		for _, format := range []string{LOG_FORMAT_JSON, LOG_FORMAT_TEXT, LOG_FORMAT_LOGFMT} {
 			t.Run(fmt.Sprintf("L=%s-F=%s", level, format), func(t *testing.T) {
 				c := LoggingConfig{
 					Level:  level,
@@ -69,3 +70,212 @@ func TestLoggingConfig_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestLoggingConfig_Validate_FileOutputs(t *testing.T) {
+	tests := []struct {
+		name               string
+		fileOutputs        []LoggingFileOutputConfig
+		wantErrMsgContains string
+	}{
+		{
+			name: "success",
+			fileOutputs: []LoggingFileOutputConfig{
+				{Path: "/var/log/app.log", MaxSizeMb: 100, RotateDaily: true, MaxBackups: 7, Compress: true},
+				{Path: "/var/log/app-2.log", ReopenOnSighup: true},
+			},
+		},
+		{
+			name:        "empty ok",
+			fileOutputs: nil,
+		},
+		{
+			name: "missing path",
+			fileOutputs: []LoggingFileOutputConfig{
+				{Path: " "},
+			},
+			wantErrMsgContains: "path",
+		},
+		{
+			name: "negative max size",
+			fileOutputs: []LoggingFileOutputConfig{
+				{Path: "/var/log/app.log", MaxSizeMb: -1},
+			},
+			wantErrMsgContains: "max-size-mb",
+		},
+		{
+			name: "negative max backups",
+			fileOutputs: []LoggingFileOutputConfig{
+				{Path: "/var/log/app.log", MaxBackups: -1},
+			},
+			wantErrMsgContains: "max-backups",
+		},
+		{
+			name: "reopen on SIGHUP can not be combined with rotation",
+			fileOutputs: []LoggingFileOutputConfig{
+				{Path: "/var/log/app.log", ReopenOnSighup: true, RotateDaily: true},
+			},
+			wantErrMsgContains: "reopen-on-sighup",
+		},
+		{
+			name: "duplicated path",
+			fileOutputs: []LoggingFileOutputConfig{
+				{Path: "/var/log/app.log"},
+				{Path: "/var/log/app.log"},
+			},
+			wantErrMsgContains: "duplicated",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := LoggingConfig{
+				FileOutputs: tt.fileOutputs,
+			}
+			err := c.Validate()
+			if !test_utils.WantErrorContainsStringIfNonEmptyOtherWiseNoError(t, err, tt.wantErrMsgContains) {
+				return
+			}
+		})
+	}
+}
+
+func TestLoggingConfig_Validate_EntryOptions(t *testing.T) {
+	tests := []struct {
+		name               string
+		config             LoggingConfig
+		wantErrMsgContains string
+	}{
+		{
+			name: "success",
+			config: LoggingConfig{
+				Caller:            true,
+				StackTraceOnError: true,
+				TimestampFormat:   LOG_TIMESTAMP_FORMAT_UNIX_MS,
+				TimeZone:          "Asia/Ho_Chi_Minh",
+				StaticFields:      map[string]string{"service": "api", "version": "1.0"},
+				Sampling: LoggingSamplingConfig{
+					Enabled:    true,
+					Burst:      100,
+					Period:     time.Second,
+					Thereafter: 10,
+				},
+			},
+		},
+		{
+			name: "predefined timestamp formats",
+			config: LoggingConfig{
+				TimestampFormat: LOG_TIMESTAMP_FORMAT_RFC3339_NANO,
+			},
+		},
+		{
+			name: "custom timestamp layout",
+			config: LoggingConfig{
+				TimestampFormat: "2006-01-02 15:04:05.000",
+				TimeZone:        "Local",
+			},
+		},
+		{
+			name: "invalid timestamp layout",
+			config: LoggingConfig{
+				TimestampFormat: "yyyy-MM-dd",
+			},
+			wantErrMsgContains: "timestamp format",
+		},
+		{
+			name: "invalid time zone",
+			config: LoggingConfig{
+				TimeZone: "Mars/Olympus_Mons",
+			},
+			wantErrMsgContains: "time zone",
+		},
+		{
+			name: "empty static field key",
+			config: LoggingConfig{
+				StaticFields: map[string]string{" ": "value"},
+			},
+			wantErrMsgContains: "empty",
+		},
+		{
+			name: "reserved static field key",
+			config: LoggingConfig{
+				StaticFields: map[string]string{LOG_FIELD_LEVEL: "value"},
+			},
+			wantErrMsgContains: "reserved",
+		},
+		{
+			name: "disabled sampling is not validated",
+			config: LoggingConfig{
+				Sampling: LoggingSamplingConfig{Burst: -1},
+			},
+		},
+		{
+			name: "sampling negative burst",
+			config: LoggingConfig{
+				Sampling: LoggingSamplingConfig{Enabled: true, Burst: -1, Thereafter: 1},
+			},
+			wantErrMsgContains: "burst",
+		},
+		{
+			name: "sampling burst without period",
+			config: LoggingConfig{
+				Sampling: LoggingSamplingConfig{Enabled: true, Burst: 10},
+			},
+			wantErrMsgContains: "period",
+		},
+		{
+			name: "sampling negative period",
+			config: LoggingConfig{
+				Sampling: LoggingSamplingConfig{Enabled: true, Period: -time.Second, Thereafter: 1},
+			},
+			wantErrMsgContains: "period",
+		},
+		{
+			name: "sampling negative thereafter",
+			config: LoggingConfig{
+				Sampling: LoggingSamplingConfig{Enabled: true, Thereafter: -1},
+			},
+			wantErrMsgContains: "thereafter",
+		},
+		{
+			name: "sampling max per period only",
+			config: LoggingConfig{
+				Sampling: LoggingSamplingConfig{Enabled: true, Period: time.Second, MaxPerPeriod: 100},
+			},
+		},
+		{
+			name: "sampling negative max per period",
+			config: LoggingConfig{
+				Sampling: LoggingSamplingConfig{Enabled: true, Period: time.Second, MaxPerPeriod: -1, Thereafter: 1},
+			},
+			wantErrMsgContains: "max-per-period",
+		},
+		{
+			name: "sampling max per period without period",
+			config: LoggingConfig{
+				Sampling: LoggingSamplingConfig{Enabled: true, MaxPerPeriod: 100},
+			},
+			wantErrMsgContains: "period",
+		},
+		{
+			name: "sampling negative summary interval",
+			config: LoggingConfig{
+				Sampling: LoggingSamplingConfig{Enabled: true, Thereafter: 1, SummaryInterval: -time.Second},
+			},
+			wantErrMsgContains: "summary-interval",
+		},
+		{
+			name: "sampling drops everything",
+			config: LoggingConfig{
+				Sampling: LoggingSamplingConfig{Enabled: true},
+			},
+			wantErrMsgContains: "dropped",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if !test_utils.WantErrorContainsStringIfNonEmptyOtherWiseNoError(t, err, tt.wantErrMsgContains) {
+				return
+			}
+		})
+	}
+}
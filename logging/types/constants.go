@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 //goland:noinspection GoSnakeCaseUsage,GoUnusedConst
 const (
 	// log level
@@ -24,6 +26,64 @@ const (
 	// LOG_FORMAT_JSON is constant for output log with json format of logger
 	LOG_FORMAT_JSON = "json"
 
+	// LOG_FORMAT_LOGFMT is constant for output log with logfmt (key=value) format of logger
+	LOG_FORMAT_LOGFMT = "logfmt"
+
 	// LOG_FORMAT_DEFAULT is constant for default output log format of logger (json)
 	LOG_FORMAT_DEFAULT = LOG_FORMAT_JSON
 )
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// REDACTED_VALUE is the placeholder which will be logged instead of the secret values
+	REDACTED_VALUE = "[REDACTED]"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// timestamp format
+
+	// LOG_TIMESTAMP_FORMAT_RFC3339 is constant for timestamp format RFC3339, like 2006-01-02T15:04:05Z07:00
+	LOG_TIMESTAMP_FORMAT_RFC3339 = "rfc3339"
+
+	// LOG_TIMESTAMP_FORMAT_RFC3339_NANO is constant for timestamp format RFC3339 with nanoseconds
+	LOG_TIMESTAMP_FORMAT_RFC3339_NANO = "rfc3339nano"
+
+	// LOG_TIMESTAMP_FORMAT_UNIX is constant for timestamp format Unix seconds
+	LOG_TIMESTAMP_FORMAT_UNIX = "unix"
+
+	// LOG_TIMESTAMP_FORMAT_UNIX_MS is constant for timestamp format Unix milliseconds
+	LOG_TIMESTAMP_FORMAT_UNIX_MS = "unixms"
+
+	// LOG_TIMESTAMP_FORMAT_DEFAULT is constant for default timestamp format of logger (rfc3339)
+	LOG_TIMESTAMP_FORMAT_DEFAULT = LOG_TIMESTAMP_FORMAT_RFC3339
+
+	// LOG_TIME_ZONE_DEFAULT is constant for default time zone of timestamp (UTC)
+	LOG_TIME_ZONE_DEFAULT = "UTC"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// reserved field names
+
+	// LOG_FIELD_TIME is the field name of timestamp
+	LOG_FIELD_TIME = "time"
+
+	// LOG_FIELD_LEVEL is the field name of level
+	LOG_FIELD_LEVEL = "level"
+
+	// LOG_FIELD_MESSAGE is the field name of message
+	LOG_FIELD_MESSAGE = "message"
+
+	// LOG_FIELD_CALLER is the field name of caller file:line, added when caller is enabled
+	LOG_FIELD_CALLER = "caller"
+
+	// LOG_FIELD_STACK is the field name of stack trace, added into Error entries when stack-trace-on-error is enabled
+	LOG_FIELD_STACK = "stack"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// LOG_SAMPLING_SUMMARY_INTERVAL_DEFAULT is constant for default interval of the summary of entries dropped by sampling
+	LOG_SAMPLING_SUMMARY_INTERVAL_DEFAULT = time.Minute
+)
@@ -0,0 +1,178 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// LOG_ENV_PREFIX_DEFAULT is the default prefix of environment variables, used by LoggingConfig.ApplyEnvOverrides
+	LOG_ENV_PREFIX_DEFAULT = "LOG_"
+)
+
+// ApplyEnvOverrides overrides the config by the environment variables which are set, using the provided prefix (default: LOG_).
+// Supported variables, with the default prefix:
+//   - LOG_LEVEL, LOG_FORMAT, LOG_PROFILER, LOG_STRICT_KEY_VALUES
+//   - LOG_CALLER, LOG_STACK_TRACE_ON_ERROR, LOG_TIMESTAMP_FORMAT, LOG_TIME_ZONE
+//   - LOG_STATIC_FIELDS, in format `key1=value1,key2=value2`, merged into the existing static fields
+//   - LOG_SAMPLING_ENABLED, LOG_SAMPLING_PER_MESSAGE, LOG_SAMPLING_BURST, LOG_SAMPLING_PERIOD (Go duration like 1s), LOG_SAMPLING_THEREAFTER
+//   - LOG_SAMPLING_MAX_PER_PERIOD, LOG_SAMPLING_SUMMARY_INTERVAL (Go duration), LOG_SAMPLING_SAMPLE_ERRORS
+//   - LOG_FILE_OUTPUT_PATH, replaces the file outputs by a single one at the path, empty value removes all the file outputs
+//   - LOG_FILE_OUTPUT_MAX_SIZE_MB, LOG_FILE_OUTPUT_ROTATE_DAILY, LOG_FILE_OUTPUT_MAX_BACKUPS, LOG_FILE_OUTPUT_COMPRESS
+//     and LOG_FILE_OUTPUT_REOPEN_ON_SIGHUP, applied to every file output
+//
+// The result is not validated, call Validate afterward.
+func (c *LoggingConfig) ApplyEnvOverrides(prefix string) error {
+	if len(prefix) < 1 {
+		prefix = LOG_ENV_PREFIX_DEFAULT
+	}
+
+	env := envReader{
+		prefix: prefix,
+	}
+
+	env.readString("LEVEL", &c.Level)
+	env.readString("FORMAT", &c.Format)
+	env.readBool("PROFILER", &c.EnableProfiler)
+	env.readBool("STRICT_KEY_VALUES", &c.StrictKeyValues)
+	env.readBool("CALLER", &c.Caller)
+	env.readBool("STACK_TRACE_ON_ERROR", &c.StackTraceOnError)
+	env.readString("TIMESTAMP_FORMAT", &c.TimestampFormat)
+	env.readString("TIME_ZONE", &c.TimeZone)
+	env.readStaticFields("STATIC_FIELDS", &c.StaticFields)
+	env.readBool("SAMPLING_ENABLED", &c.Sampling.Enabled)
+	env.readBool("SAMPLING_PER_MESSAGE", &c.Sampling.PerMessage)
+	env.readInt("SAMPLING_BURST", &c.Sampling.Burst)
+	env.readDuration("SAMPLING_PERIOD", &c.Sampling.Period)
+	env.readInt("SAMPLING_THEREAFTER", &c.Sampling.Thereafter)
+	env.readInt("SAMPLING_MAX_PER_PERIOD", &c.Sampling.MaxPerPeriod)
+	env.readDuration("SAMPLING_SUMMARY_INTERVAL", &c.Sampling.SummaryInterval)
+	env.readBool("SAMPLING_SAMPLE_ERRORS", &c.Sampling.SampleErrors)
+	env.readFileOutputs("FILE_OUTPUT_", &c.FileOutputs)
+
+	return env.err
+}
+
+// envReader reads environment variables with a prefix, keeps the first failure
+type envReader struct {
+	prefix string
+	err    error
+}
+
+// lookup returns the trimmed value of the environment variable, found is false when not set
+func (r *envReader) lookup(name string) (key, value string, found bool) {
+	key = r.prefix + name
+	value, found = os.LookupEnv(key)
+	return key, strings.TrimSpace(value), found
+}
+
+// setErr keeps the first failure
+func (r *envReader) setErr(key, value string, err error) {
+	if r.err == nil {
+		r.err = fmt.Errorf("invalid value [%s] of environment variable %s: %v", value, key, err)
+	}
+}
+
+func (r *envReader) readString(name string, target *string) {
+	if _, value, found := r.lookup(name); found {
+		*target = value
+	}
+}
+
+func (r *envReader) readBool(name string, target *bool) {
+	key, value, found := r.lookup(name)
+	if !found {
+		return
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		r.setErr(key, value, err)
+		return
+	}
+	*target = parsed
+}
+
+func (r *envReader) readInt(name string, target *int) {
+	key, value, found := r.lookup(name)
+	if !found {
+		return
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		r.setErr(key, value, err)
+		return
+	}
+	*target = parsed
+}
+
+func (r *envReader) readDuration(name string, target *time.Duration) {
+	key, value, found := r.lookup(name)
+	if !found {
+		return
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		r.setErr(key, value, err)
+		return
+	}
+	*target = parsed
+}
+
+func (r *envReader) readStaticFields(name string, target *map[string]string) {
+	key, value, found := r.lookup(name)
+	if !found || len(value) < 1 {
+		return
+	}
+
+	// copy, the existing map might be shared with other configs
+	fields := make(map[string]string, len(*target))
+	for k, v := range *target {
+		fields[k] = v
+	}
+	for _, pair := range strings.Split(value, ",") {
+		if len(strings.TrimSpace(pair)) < 1 {
+			continue
+		}
+		spl := strings.SplitN(pair, "=", 2)
+		if len(spl) != 2 || len(strings.TrimSpace(spl[0])) < 1 {
+			r.setErr(key, value, fmt.Errorf("expect format key1=value1,key2=value2"))
+			return
+		}
+		fields[strings.TrimSpace(spl[0])] = strings.TrimSpace(spl[1])
+	}
+
+	*target = fields
+}
+
+func (r *envReader) readFileOutputs(namePrefix string, target *[]LoggingFileOutputConfig) {
+	// copy, the existing slice might be shared with other configs
+	fileOutputs := append([]LoggingFileOutputConfig(nil), *target...)
+	if _, path, found := r.lookup(namePrefix + "PATH"); found {
+		fileOutputs = nil
+		if len(path) > 0 {
+			fileOutputs = []LoggingFileOutputConfig{{Path: path}}
+		}
+	}
+
+	if len(fileOutputs) < 1 {
+		// still read, so invalid values are reported
+		r.readFileOutput(namePrefix, &LoggingFileOutputConfig{})
+	}
+	for i := range fileOutputs {
+		r.readFileOutput(namePrefix, &fileOutputs[i])
+	}
+
+	*target = fileOutputs
+}
+
+func (r *envReader) readFileOutput(namePrefix string, target *LoggingFileOutputConfig) {
+	r.readInt(namePrefix+"MAX_SIZE_MB", &target.MaxSizeMb)
+	r.readBool(namePrefix+"ROTATE_DAILY", &target.RotateDaily)
+	r.readInt(namePrefix+"MAX_BACKUPS", &target.MaxBackups)
+	r.readBool(namePrefix+"COMPRESS", &target.Compress)
+	r.readBool(namePrefix+"REOPEN_ON_SIGHUP", &target.ReopenOnSighup)
+}
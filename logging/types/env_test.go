@@ -0,0 +1,143 @@
+package types
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLoggingConfig_ApplyEnvOverrides(t *testing.T) {
+	t.Run("nothing set, nothing changed", func(t *testing.T) {
+		config := LoggingConfig{
+			Level:  LOG_LEVEL_ERROR,
+			Format: LOG_FORMAT_TEXT,
+		}
+		require.NoError(t, config.ApplyEnvOverrides("TEST_NOT_SET_"))
+		require.Equal(t, LoggingConfig{
+			Level:  LOG_LEVEL_ERROR,
+			Format: LOG_FORMAT_TEXT,
+		}, config)
+	})
+
+	t.Run("default prefix", func(t *testing.T) {
+		t.Setenv("LOG_LEVEL", "debug")
+		t.Setenv("LOG_FORMAT", " logfmt ")
+
+		config := LoggingConfig{
+			Level: LOG_LEVEL_ERROR,
+		}
+		require.NoError(t, config.ApplyEnvOverrides(""))
+		require.Equal(t, LOG_LEVEL_DEBUG, config.Level)
+		require.Equal(t, LOG_FORMAT_LOGFMT, config.Format)
+	})
+
+	t.Run("all options", func(t *testing.T) {
+		t.Setenv("APP_LOG_LEVEL", "info")
+		t.Setenv("APP_LOG_FORMAT", "json")
+		t.Setenv("APP_LOG_PROFILER", "true")
+		t.Setenv("APP_LOG_STRICT_KEY_VALUES", "1")
+		t.Setenv("APP_LOG_CALLER", "true")
+		t.Setenv("APP_LOG_STACK_TRACE_ON_ERROR", "true")
+		t.Setenv("APP_LOG_TIMESTAMP_FORMAT", "unixms")
+		t.Setenv("APP_LOG_TIME_ZONE", "Asia/Ho_Chi_Minh")
+		t.Setenv("APP_LOG_STATIC_FIELDS", "service=api, version = 1.0,,")
+		t.Setenv("APP_LOG_SAMPLING_ENABLED", "true")
+		t.Setenv("APP_LOG_SAMPLING_BURST", "100")
+		t.Setenv("APP_LOG_SAMPLING_PERIOD", "1s")
+		t.Setenv("APP_LOG_SAMPLING_THEREAFTER", "10")
+		t.Setenv("APP_LOG_SAMPLING_SAMPLE_ERRORS", "false")
+		t.Setenv("APP_LOG_SAMPLING_PER_MESSAGE", "true")
+		t.Setenv("APP_LOG_SAMPLING_MAX_PER_PERIOD", "1000")
+		t.Setenv("APP_LOG_SAMPLING_SUMMARY_INTERVAL", "30s")
+		t.Setenv("APP_LOG_FILE_OUTPUT_PATH", "/var/log/app.log")
+		t.Setenv("APP_LOG_FILE_OUTPUT_MAX_SIZE_MB", "100")
+		t.Setenv("APP_LOG_FILE_OUTPUT_ROTATE_DAILY", "true")
+		t.Setenv("APP_LOG_FILE_OUTPUT_MAX_BACKUPS", "7")
+		t.Setenv("APP_LOG_FILE_OUTPUT_COMPRESS", "true")
+
+		staticFields := map[string]string{"service": "worker", "region": "sg"}
+		config := LoggingConfig{
+			StaticFields: staticFields,
+			Sampling: LoggingSamplingConfig{
+				SampleErrors: true,
+			},
+		}
+		require.NoError(t, config.ApplyEnvOverrides("APP_LOG_"))
+		require.NoError(t, config.Validate())
+		require.Equal(t, LoggingConfig{
+			Level:             LOG_LEVEL_INFO,
+			Format:            LOG_FORMAT_JSON,
+			EnableProfiler:    true,
+			StrictKeyValues:   true,
+			Caller:            true,
+			StackTraceOnError: true,
+			TimestampFormat:   LOG_TIMESTAMP_FORMAT_UNIX_MS,
+			TimeZone:          "Asia/Ho_Chi_Minh",
+			StaticFields:      map[string]string{"service": "api", "version": "1.0", "region": "sg"},
+			Sampling: LoggingSamplingConfig{
+				Enabled:         true,
+				PerMessage:      true,
+				Burst:           100,
+				Period:          time.Second,
+				Thereafter:      10,
+				MaxPerPeriod:    1000,
+				SummaryInterval: 30 * time.Second,
+			},
+			FileOutputs: []LoggingFileOutputConfig{
+				{Path: "/var/log/app.log", MaxSizeMb: 100, RotateDaily: true, MaxBackups: 7, Compress: true},
+			},
+		}, config)
+		require.Equal(t, "worker", staticFields["service"], "original map must not be modified")
+	})
+
+	t.Run("file outputs", func(t *testing.T) {
+		fileOutputs := []LoggingFileOutputConfig{
+			{Path: "/var/log/app.log", MaxBackups: 3},
+			{Path: "/var/log/app-2.log"},
+		}
+
+		t.Setenv("APP_LOG_FILE_OUTPUT_MAX_BACKUPS", "7")
+		config := LoggingConfig{FileOutputs: fileOutputs}
+		require.NoError(t, config.ApplyEnvOverrides("APP_LOG_"))
+		require.Equal(t, []LoggingFileOutputConfig{
+			{Path: "/var/log/app.log", MaxBackups: 7},
+			{Path: "/var/log/app-2.log", MaxBackups: 7},
+		}, config.FileOutputs, "settings must be applied to every file output")
+		require.Equal(t, 3, fileOutputs[0].MaxBackups, "original slice must not be modified")
+
+		t.Setenv("APP_LOG_FILE_OUTPUT_REOPEN_ON_SIGHUP", "true")
+		t.Setenv("APP_LOG_FILE_OUTPUT_PATH", "/var/log/other.log")
+		config = LoggingConfig{FileOutputs: fileOutputs}
+		require.NoError(t, config.ApplyEnvOverrides("APP_LOG_"))
+		require.Equal(t, []LoggingFileOutputConfig{
+			{Path: "/var/log/other.log", MaxBackups: 7, ReopenOnSighup: true},
+		}, config.FileOutputs, "path must replace the file outputs")
+
+		t.Setenv("APP_LOG_FILE_OUTPUT_PATH", "")
+		config = LoggingConfig{FileOutputs: fileOutputs}
+		require.NoError(t, config.ApplyEnvOverrides("APP_LOG_"))
+		require.Empty(t, config.FileOutputs, "empty path must remove the file outputs")
+	})
+
+	tests := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{name: "invalid bool", key: "TEST_LOG_CALLER", value: "yes please"},
+		{name: "invalid int", key: "TEST_LOG_SAMPLING_BURST", value: "1.5"},
+		{name: "invalid duration", key: "TEST_LOG_SAMPLING_PERIOD", value: "1"},
+		{name: "invalid static fields", key: "TEST_LOG_STATIC_FIELDS", value: "service"},
+		{name: "static field without key", key: "TEST_LOG_STATIC_FIELDS", value: "=api"},
+		{name: "invalid file output setting without file output", key: "TEST_LOG_FILE_OUTPUT_MAX_BACKUPS", value: "many"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			config := LoggingConfig{}
+			err := config.ApplyEnvOverrides("TEST_LOG_")
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.key)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"context"
 	"fmt"
 	"github.com/EscanBE/go-lib/logging"
 	"github.com/EscanBE/go-lib/types"
@@ -34,6 +35,11 @@ func (b *TelegramBot) WithLogger(logger logging.Logger) *TelegramBot {
 	return b
 }
 
+// GetLogger returns the logger which was injected via WithLogger, or nil if none
+func (b *TelegramBot) GetLogger() logging.Logger {
+	return b.logger
+}
+
 // EnableDebug enables debugging mode of bot
 func (b *TelegramBot) EnableDebug(enable bool) *TelegramBot {
 	b.bot.Debug = enable
@@ -83,39 +89,49 @@ func (b *TelegramBot) SendMessageToMultipleChats(msgContent string, chatIds []in
 
 	chatIds = utils.GetUniqueElements(chatIds...)
 
+	maxAttempts := 0 // until the per-user duration passed
+	if perUserDuration == nil {
+		maxAttempts = 1
+	}
+	var chatId int64
+	retryExecutor, err := utils.NewRetryExecutor(utils.RetryPolicy{
+		Backoff:      utils.RetryBackoffLinear,
+		InitialDelay: 300 * time.Millisecond,
+		MaxAttempts:  maxAttempts,
+		OnAttempt: func(attempt utils.RetryAttempt) {
+			if attempt.Err == nil {
+				return
+			}
+			b.logError(
+				"failed to send Telegram message to user",
+				append(extraLogTags, "chat-id", chatId, "attempt", attempt.Number, "error", attempt.Err.Error()),
+			)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
 	cntSent := 0
 	errors := make(map[string]bool)
-	for _, chatId := range chatIds {
-		var cancellationToken *types.CancellationToken
+	for _, chatId = range chatIds {
+		var cancellationToken types.CancellationToken
 		if perUserDuration == nil {
-			cancellationToken = nil
+			cancellationToken = types.NewCancellationTokenSource().GetCancellationToken()
 		} else {
-			token := types.NewCancellationTokenSourceWithTimeoutDuration(*perUserDuration).GetCancellationToken()
-			cancellationToken = &token
+			cancellationToken = types.NewCancellationTokenSourceWithTimeoutDuration(*perUserDuration).GetCancellationToken()
 		}
 
-		for {
-			msg := tgbotapi.NewMessage(chatId, msgContent)
-			_, err := b.bot.Send(msg)
-
-			if err != nil {
-				b.logError(
-					"failed to send Telegram message to user",
-					append(extraLogTags, "chat-id", chatId, "error", err.Error()),
-				)
-
-				errors[fmt.Sprintf("\"%s\"", err.Error())] = true
-
-				time.Sleep(300 * time.Millisecond)
-
-				if cancellationToken == nil || cancellationToken.IsExpired() {
-					break
-				}
-			} else {
-				cntSent++
-				time.Sleep(100 * time.Millisecond)
-				break
-			}
+		attemptErrors, err := retryExecutor.Do(cancellationToken, func(_ context.Context, _ int) error {
+			_, err := b.bot.Send(tgbotapi.NewMessage(chatId, msgContent))
+			return err
+		})
+		for _, attemptErr := range attemptErrors {
+			errors[fmt.Sprintf("\"%s\"", attemptErr.Error())] = true
+		}
+		if err == nil {
+			cntSent++
+			time.Sleep(100 * time.Millisecond)
 		}
 	}
 
@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"fmt"
+	"github.com/EscanBE/go-lib/logging/logtest"
+	"github.com/EscanBE/go-lib/test_utils"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTelegramBot_WithLogger(t *testing.T) {
+	logger := logtest.NewCapturingLogger()
+	logger.DumpOnFailure(t)
+
+	b := (&TelegramBot{}).WithLogger(logger)
+	if b.logger != logger {
+		t.Errorf("WithLogger() did not inject the logger")
+		return
+	}
+
+	b.logDebug("debug message", []interface{}{"chat-id", int64(1)})
+	b.logInfo("info message", []interface{}{"chat-id", int64(2)})
+	b.logError("failed to send Telegram message to user", []interface{}{"chat-id", int64(3), "error", "timeout"})
+
+	logger.ExpectDebugEntry(t, "debug message", "chat-id", 1)
+	logger.ExpectInfoEntry(t, "info message", "chat-id", 2)
+	logger.ExpectErrorEntry(t, "failed to send", "chat-id", 3, "error", "timeout")
+}
+
+func TestTelegramBot_logWithoutLogger(t *testing.T) {
+	defer test_utils.DeferWantNoPanic(t)
+
+	b := &TelegramBot{}
+	b.logDebug("debug", nil)
+	b.logInfo("info", nil)
+	b.logError("error", nil)
+}
+
+func TestTelegramBot_SendMessageToMultipleChats_InvalidInput(t *testing.T) {
+	b := &TelegramBot{}
+
+	err := b.SendMessageToMultipleChats("", []int64{1}, nil)
+	test_utils.WantErrorContainsStringIfNonEmptyOtherWiseNoError(t, err, "content is empty")
+
+	err = b.SendMessageToMultipleChats("hello", nil, nil)
+	test_utils.WantErrorContainsStringIfNonEmptyOtherWiseNoError(t, err, "chat ID list is empty")
+}
+
+// newTestTelegramBot returns a bot which talks to a fake Telegram API server,
+// sending message to a chat fails as many times as configured for the chat, negative means always fail
+func newTestTelegramBot(t *testing.T, failures map[int64]int) (*TelegramBot, func(chatId int64) int) {
+	var mu sync.Mutex
+	attempts := make(map[int64]int)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getMe"):
+			_, _ = fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"bot","username":"bot"}}`)
+		case strings.HasSuffix(r.URL.Path, "/sendMessage"):
+			var chatId int64
+			_, _ = fmt.Sscan(r.FormValue("chat_id"), &chatId)
+
+			mu.Lock()
+			attempts[chatId]++
+			fail := failures[chatId] < 0 || attempts[chatId] <= failures[chatId]
+			mu.Unlock()
+
+			if fail {
+				_, _ = fmt.Fprintf(w, `{"ok":false,"error_code":500,"description":"failed to send to %d"}`, chatId)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":%d,"type":"private"}}}`, chatId)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	api, err := tgbotapi.NewBotAPIWithClient("token", server.URL+"/bot%s/%s", server.Client())
+	require.NoError(t, err)
+
+	return &TelegramBot{bot: api}, func(chatId int64) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts[chatId]
+	}
+}
+
+func TestTelegramBot_SendMessageToMultipleChats(t *testing.T) {
+	t.Run("retry until per-user duration passed", func(t *testing.T) {
+		b, attempts := newTestTelegramBot(t, map[int64]int{2: 1, 3: -1})
+		logger := logtest.NewCapturingLogger()
+		b.WithLogger(logger)
+
+		perUserDuration := 700 * time.Millisecond
+		err := b.SendMessageToMultipleChats("hello", []int64{1, 2, 3, 2}, &perUserDuration, "tag", "value")
+		test_utils.WantErrorContainsStringIfNonEmptyOtherWiseNoError(t, err, "sent 2/3")
+		require.Contains(t, err.Error(), "failed to send to 2")
+		require.Contains(t, err.Error(), "failed to send to 3")
+
+		require.Equal(t, 1, attempts(1))
+		require.Equal(t, 2, attempts(2), "must succeed on retry")
+		require.GreaterOrEqual(t, attempts(3), 2, "must retry until the per-user duration passed")
+
+		logger.ExpectErrorEntry(t, "failed to send Telegram message to user", "chat-id", 2, "attempt", 1, "tag", "value")
+		logger.ExpectErrorEntry(t, "failed to send Telegram message to user", "chat-id", 3, "attempt", 2)
+		logger.ExpectErrorEntry(t, "failed to send Telegram message to multiple chats", "sent", 2, "count-total", 3)
+	})
+
+	t.Run("zero per-user duration still attempts once", func(t *testing.T) {
+		b, attempts := newTestTelegramBot(t, map[int64]int{2: 1})
+
+		perUserDuration := time.Duration(0)
+		err := b.SendMessageToMultipleChats("hello", []int64{1, 2}, &perUserDuration)
+		test_utils.WantErrorContainsStringIfNonEmptyOtherWiseNoError(t, err, "sent 1/2")
+		require.Equal(t, 1, attempts(1))
+		require.Equal(t, 1, attempts(2), "must not retry after the per-user duration passed")
+	})
+
+	t.Run("no retry without per-user duration", func(t *testing.T) {
+		b, attempts := newTestTelegramBot(t, map[int64]int{2: 1})
+
+		err := b.SendMessageToMultipleChats("hello", []int64{1, 2}, nil)
+		test_utils.WantErrorContainsStringIfNonEmptyOtherWiseNoError(t, err, "sent 1/2")
+		require.Equal(t, 1, attempts(2))
+	})
+
+	t.Run("all sent", func(t *testing.T) {
+		b, _ := newTestTelegramBot(t, nil)
+		logger := logtest.NewCapturingLogger()
+		b.WithLogger(logger)
+
+		require.NoError(t, b.SendMessageToMultipleChats("hello", []int64{1, 2}, nil))
+		logger.ExpectInfoEntry(t, "successfully sent Telegram message to multiple chats", "count-total", 2)
+	})
+}
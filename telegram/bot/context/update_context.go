@@ -1,23 +1,73 @@
 package context
 
 import (
+	gocontext "context"
+	"github.com/EscanBE/go-lib/logging"
 	"github.com/EscanBE/go-lib/telegram/bot"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// LOG_FIELD_UPDATE_ID is the field name of Telegram update ID, carried by context of each update
+//
+//goland:noinspection GoSnakeCaseUsage
+const LOG_FIELD_UPDATE_ID = "update-id"
+
 // TelegramUpdateContext hold update context when received an update, this struct provides some utilities
 type TelegramUpdateContext struct {
 	bot      bot.TelegramBot
 	update   tgbotapi.Update
 	username string
+	ctx      gocontext.Context
 }
 
 // NewTelegramUpdateContext wraps the new update thus can perform some utilities
 func NewTelegramUpdateContext(update tgbotapi.Update, bot bot.TelegramBot) *TelegramUpdateContext {
-	return &TelegramUpdateContext{
+	result := &TelegramUpdateContext{
 		bot:    bot,
 		update: update,
 	}
+	return result.WithContext(gocontext.Background())
+}
+
+// HandleUpdates calls the handler for each update received from the channel, one at a time, until the channel closed or the parent context done.
+// Context of each update is derived from the parent context and carries the logger of the bot and the update ID field.
+func HandleUpdates(parent gocontext.Context, updates tgbotapi.UpdatesChannel, bot bot.TelegramBot, handler func(ctx *TelegramUpdateContext)) {
+	if parent == nil {
+		parent = gocontext.Background()
+	}
+	for {
+		select {
+		case <-parent.Done():
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			handler(NewTelegramUpdateContext(update, bot).WithContext(parent))
+		}
+	}
+}
+
+// WithContext binds the update to a copy of the parent context, which carries the logger of the bot
+// and the update ID field, so context-aware log functions can correlate log lines of the same update.
+// The update ID field of the parent context, if any, is replaced.
+func (ctx *TelegramUpdateContext) WithContext(parent gocontext.Context) *TelegramUpdateContext {
+	if parent == nil {
+		parent = gocontext.Background()
+	}
+	if logger := ctx.bot.GetLogger(); logger != nil && logging.LoggerFromContext(parent) == nil {
+		parent = logging.ContextWithLogger(parent, logger)
+	}
+	ctx.ctx = logging.ContextWithFields(parent, LOG_FIELD_UPDATE_ID, ctx.update.UpdateID)
+	return ctx
+}
+
+// Context returns the context.Context of the update, carries the logger of the bot and the update ID field
+func (ctx TelegramUpdateContext) Context() gocontext.Context {
+	if ctx.ctx == nil {
+		return ctx.WithContext(gocontext.Background()).ctx
+	}
+	return ctx.ctx
 }
 
 // WithUsername set the input username to the context. Because username does not include within the update instance thus manual provision is needed
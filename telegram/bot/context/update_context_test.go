@@ -1,7 +1,10 @@
 package context
 
 import (
+	gocontext "context"
 	"fmt"
+	"github.com/EscanBE/go-lib/logging"
+	"github.com/EscanBE/go-lib/logging/logtest"
 	"github.com/EscanBE/go-lib/telegram/bot"
 	"github.com/EscanBE/go-lib/utils"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -272,3 +275,95 @@ func TestTelegramUpdateContext_GetCommandArg(t *testing.T) {
 		})
 	}
 }
+
+func TestTelegramUpdateContext_Context(t *testing.T) {
+	t.Run("carries update ID and bot logger", func(t *testing.T) {
+		logger := logtest.NewCapturingLogger()
+		logger.DumpOnFailure(t)
+		tBot := (&bot.TelegramBot{}).WithLogger(logger)
+		update := tgbotapi.Update{UpdateID: rand.Int()}
+
+		ctx := NewTelegramUpdateContext(update, *tBot).Context()
+		if ctx == nil {
+			t.Errorf("expect context")
+			return
+		}
+		if logging.LoggerFromContext(ctx) != logger {
+			t.Errorf("expect context carries bot logger")
+			return
+		}
+
+		logging.InfoCtx(ctx, "handling update", "command", "help")
+		logger.ExpectInfoEntry(t, "handling update", LOG_FIELD_UPDATE_ID, update.UpdateID, "command", "help")
+	})
+
+	t.Run("without logger", func(t *testing.T) {
+		ctx := NewTelegramUpdateContext(tgbotapi.Update{UpdateID: 1}, bot.TelegramBot{}).Context()
+		if logging.LoggerFromContext(ctx) != nil {
+			t.Errorf("expect no logger")
+			return
+		}
+		if fields := logging.FieldsFromContext(ctx); len(fields) != 2 || fields[0] != LOG_FIELD_UPDATE_ID || fields[1] != 1 {
+			t.Errorf("expect update ID field, got %v", fields)
+		}
+	})
+
+	t.Run("with parent context", func(t *testing.T) {
+		parentLogger := logtest.NewCapturingLogger()
+		botLogger := logtest.NewCapturingLogger()
+		tBot := (&bot.TelegramBot{}).WithLogger(botLogger)
+		parent := logging.ContextWithRequestId(logging.ContextWithLogger(gocontext.Background(), parentLogger), "req-1")
+
+		ctx := NewTelegramUpdateContext(tgbotapi.Update{UpdateID: 2}, *tBot).WithContext(parent).Context()
+		logging.ErrorCtx(ctx, "failed")
+
+		parentLogger.ExpectErrorEntry(t, "failed", LOG_FIELD_UPDATE_ID, 2, logging.CONTEXT_FIELD_REQUEST_ID, "req-1")
+		botLogger.ExpectNoEntry(t, "", "failed")
+	})
+
+	t.Run("re-wrap does not duplicate update ID", func(t *testing.T) {
+		updateCtx := NewTelegramUpdateContext(tgbotapi.Update{UpdateID: 3}, bot.TelegramBot{})
+		ctx := updateCtx.WithContext(updateCtx.Context()).Context()
+		if fields := logging.FieldsFromContext(ctx); len(fields) != 2 || fields[0] != LOG_FIELD_UPDATE_ID || fields[1] != 3 {
+			t.Errorf("expect update ID field once, got %v", fields)
+		}
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		if (TelegramUpdateContext{}).Context() == nil {
+			t.Errorf("expect context")
+		}
+	})
+}
+
+func TestHandleUpdates(t *testing.T) {
+	logger := logtest.NewCapturingLogger()
+	tBot := (&bot.TelegramBot{}).WithLogger(logger)
+	parent := logging.ContextWithRequestId(gocontext.Background(), "req-1")
+
+	updates := make(chan tgbotapi.Update, 2)
+	updates <- tgbotapi.Update{UpdateID: 1}
+	updates <- tgbotapi.Update{UpdateID: 2}
+	close(updates)
+
+	var handled []int
+	HandleUpdates(parent, updates, *tBot, func(ctx *TelegramUpdateContext) {
+		handled = append(handled, ctx.ExposeUpdate().UpdateID)
+		logging.InfoCtx(ctx.Context(), "handling update")
+	})
+
+	if len(handled) != 2 || handled[0] != 1 || handled[1] != 2 {
+		t.Errorf("expect all updates handled in order, got %v", handled)
+		return
+	}
+	logger.ExpectInfoEntry(t, "handling update", LOG_FIELD_UPDATE_ID, 1, logging.CONTEXT_FIELD_REQUEST_ID, "req-1")
+	logger.ExpectInfoEntry(t, "handling update", LOG_FIELD_UPDATE_ID, 2, logging.CONTEXT_FIELD_REQUEST_ID, "req-1")
+
+	t.Run("stops when parent context done", func(t *testing.T) {
+		ctx, cancel := gocontext.WithCancel(gocontext.Background())
+		cancel()
+		HandleUpdates(ctx, make(chan tgbotapi.Update), bot.TelegramBot{}, func(*TelegramUpdateContext) {
+			t.Errorf("expect no update handled")
+		})
+	})
+}
@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"fmt"
+	"github.com/EscanBE/go-lib/logging"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxAlertMessageLength is the maximum number of characters of a Telegram message
+const maxAlertMessageLength = 4096
+
+// NewAlertLogSink returns a logging.Sink which delivers Error entries as messages to the provided chats.
+// Entries are delivered asynchronously so a slow or broken Telegram API does not block the other sinks.
+// The sink does not use the logger of the bot, so it is safe to be a sink of that logger.
+func (b *TelegramBot) NewAlertLogSink(chatIds []int64) logging.Sink {
+	return logging.Sink{
+		Name:       "telegram",
+		Level:      logtypes.LOG_LEVEL_ERROR,
+		BufferSize: 100,
+		Handler: func(entry logging.LogEntry) error {
+			msgContent := formatAlertMessage(entry)
+			var failed []string
+			for _, chatId := range chatIds {
+				if _, err := b.bot.Send(tgbotapi.NewMessage(chatId, msgContent)); err != nil {
+					failed = append(failed, fmt.Sprintf("%d: %v", chatId, err))
+				}
+			}
+			if len(failed) > 0 {
+				return fmt.Errorf("failed to send alert to %d/%d chats: [%s]", len(failed), len(chatIds), strings.Join(failed, ", "))
+			}
+			return nil
+		},
+	}
+}
+
+// formatAlertMessage renders the entry as a Telegram message, one field per line
+func formatAlertMessage(entry logging.LogEntry) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[%s] %s\n", strings.ToUpper(entry.Level), entry.Message))
+	sb.WriteString(entry.Time.UTC().Format(time.RFC3339))
+
+	keys := make([]string, 0, len(entry.Fields))
+	for key := range entry.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sb.WriteString(fmt.Sprintf("\n%s: %v", key, entry.Fields[key]))
+	}
+
+	return truncateMessage(sb.String())
+}
+
+// truncateMessage cuts the message to fit the maximum length of a Telegram message, counted in characters
+func truncateMessage(msgContent string) string {
+	return truncateToLength(msgContent, maxAlertMessageLength)
+}
+
+// truncateToLength truncates the content to the maximum number of characters, ending with "..." if truncated
+func truncateToLength(content string, maxLength int) string {
+	runes := []rune(content)
+	if len(runes) <= maxLength {
+		return content
+	}
+	if maxLength < 3 {
+		return string(runes[:maxLength])
+	}
+	return string(runes[:maxLength-3]) + "..."
+}
@@ -0,0 +1,41 @@
+package bot
+
+import (
+	"fmt"
+	"github.com/EscanBE/go-lib/logging"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestTelegramBot_NewAlertLogSink(t *testing.T) {
+	sink := (&TelegramBot{}).NewAlertLogSink([]int64{1, 2})
+	require.NoError(t, sink.Validate())
+	require.Equal(t, logtypes.LOG_LEVEL_ERROR, sink.Level)
+	require.NotNil(t, sink.Handler)
+	require.Positive(t, sink.BufferSize, "must be asynchronous")
+}
+
+func Test_formatAlertMessage(t *testing.T) {
+	entry := logging.LogEntry{
+		Time:    time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		Level:   logtypes.LOG_LEVEL_ERROR,
+		Message: "failed to fetch block",
+		Fields: map[string]interface{}{
+			"height": 100,
+			"error":  fmt.Errorf("timeout"),
+		},
+	}
+	require.Equal(t, "[ERROR] failed to fetch block\n2023-01-02T03:04:05Z\nerror: timeout\nheight: 100", formatAlertMessage(entry))
+
+	t.Run("long message will be truncated", func(t *testing.T) {
+		entry.Message = strings.Repeat("ă", maxAlertMessageLength)
+		msgContent := formatAlertMessage(entry)
+		require.Equal(t, maxAlertMessageLength, utf8.RuneCountInString(msgContent))
+		require.True(t, utf8.ValidString(msgContent))
+		require.True(t, strings.HasSuffix(msgContent, "..."))
+	})
+}
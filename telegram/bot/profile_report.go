@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"fmt"
+	"github.com/EscanBE/go-lib/utils"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	_ utils.ProfileReportSink = &profileReportSink{}
+)
+
+// SendProfileReport renders the profile report to be read on small screens and delivers it to the provided chats
+func (b *TelegramBot) SendProfileReport(report *utils.ProfileReport, chatIds []int64) error {
+	if report == nil {
+		return fmt.Errorf("profile report is nil")
+	}
+	return b.SendMessageToMultipleChats(FormatProfileReport(report), chatIds, nil)
+}
+
+// FormatProfileReport renders the profile report as a compact tree, one record per line without column padding,
+// so it can be read on small screens. Long reports are truncated to fit a Telegram message.
+func FormatProfileReport(report *utils.ProfileReport) string {
+	if report == nil {
+		return ""
+	}
+
+	status := "OK"
+	if report.AnyError() {
+		status = "ERR"
+	}
+
+	var sb strings.Builder
+	writeProfileReportTree(&sb, report, status, nil)
+	return truncateMessage(sb.String())
+}
+
+// NewProfileReportSink returns a utils.ProfileReportSink which delivers the alerts as messages to the provided chats
+func (b *TelegramBot) NewProfileReportSink(chatIds []int64) (utils.ProfileReportSink, error) {
+	if len(chatIds) < 1 {
+		return nil, fmt.Errorf("input chat ID list is empty")
+	}
+	return &profileReportSink{
+		bot:     b,
+		chatIds: chatIds,
+	}, nil
+}
+
+// profileReportSink implements utils.ProfileReportSink, delivers the alerts as Telegram messages
+type profileReportSink struct {
+	bot     *TelegramBot
+	chatIds []int64
+}
+
+// ReportProfile implements utils.ProfileReportSink
+func (s *profileReportSink) ReportProfile(alert *utils.ProfileAlert) error {
+	if alert == nil || alert.Report == nil {
+		return fmt.Errorf("profile alert is nil")
+	}
+	return s.bot.SendMessageToMultipleChats(FormatProfileAlert(alert), s.chatIds, nil)
+}
+
+// FormatProfileAlert renders the alert: the header line, the reasons, the slowest path, then the profile tree with records
+// of the slowest path marked by "*" instead of "-". Long alerts are fit into a Telegram message by truncating the tree only.
+func FormatProfileAlert(alert *utils.ProfileAlert) string {
+	if alert == nil || alert.Report == nil {
+		return ""
+	}
+
+	status := "SLOW"
+	if alert.AnyError() {
+		status = "ERR"
+	}
+	highlighted := make(map[*utils.ProfileReport]bool, len(alert.SlowestPath))
+	for _, node := range alert.SlowestPath {
+		highlighted[node] = true
+	}
+
+	var head strings.Builder
+	writeProfileReportHeader(&head, alert.Report, status)
+	for _, reason := range alert.Reasons {
+		head.WriteString(fmt.Sprintf("\n! %s", reason))
+	}
+	if len(alert.SlowestPath) > 0 {
+		head.WriteString(fmt.Sprintf("\nSlowest: %s", alert.SlowestPathText()))
+	}
+
+	var tree strings.Builder
+	if len(alert.Report.Children) > 0 {
+		tree.WriteString("\n")
+	}
+	for _, child := range alert.Report.Children {
+		writeProfileReportNode(&tree, child, 1, highlighted)
+	}
+
+	headLength := utf8.RuneCountInString(head.String())
+	if headLength >= maxAlertMessageLength {
+		return truncateMessage(head.String())
+	}
+	return head.String() + truncateToLength(tree.String(), maxAlertMessageLength-headLength)
+}
+
+// writeProfileReportTree writes the header line of the root, then its descendants
+func writeProfileReportTree(sb *strings.Builder, report *utils.ProfileReport, status string, highlighted map[*utils.ProfileReport]bool) {
+	writeProfileReportHeader(sb, report, status)
+	for _, child := range report.Children {
+		writeProfileReportNode(sb, child, 1, highlighted)
+	}
+}
+
+// writeProfileReportHeader writes the header line of the root
+func writeProfileReportHeader(sb *strings.Builder, report *utils.ProfileReport, status string) {
+	if len(report.ConstDesc) > 0 {
+		sb.WriteString(fmt.Sprintf("[%s] %s: %s", status, report.ConstDesc, report.Desc))
+	} else {
+		sb.WriteString(fmt.Sprintf("[%s] %s", status, report.Desc))
+	}
+	sb.WriteString(fmt.Sprintf(" - %s%s", utils.FormatDurationAutoUnit(report.Duration), formatProfileReportDetails(report)))
+}
+
+// writeProfileReportNode writes the record and its descendants, indented by depth, highlighted records are marked by "*"
+func writeProfileReportNode(sb *strings.Builder, node *utils.ProfileReport, depth int, highlighted map[*utils.ProfileReport]bool) {
+	sb.WriteString("\n")
+	sb.WriteString(strings.Repeat("  ", depth-1))
+	if highlighted[node] {
+		sb.WriteString("* ")
+	} else {
+		sb.WriteString("- ")
+	}
+	sb.WriteString(node.Desc)
+	sb.WriteString(fmt.Sprintf(": %s%s", utils.FormatDurationAutoUnit(node.Duration), formatProfileReportDetails(node)))
+	if node.Parallel {
+		sb.WriteString(" ||")
+	}
+	if node.Err {
+		sb.WriteString(" ERR")
+	}
+
+	for _, child := range node.Children {
+		writeProfileReportNode(sb, child, depth+1, highlighted)
+	}
+}
+
+// formatProfileReportDetails returns the captured memory usage if any,
+// then wall-clock and sum of execution time of the children, if any
+func formatProfileReportDetails(node *utils.ProfileReport) string {
+	var details string
+	if node.Memory != nil {
+		details = fmt.Sprintf(" [%s, %d objs, goroutines %d > %d]",
+			utils.FormatBytesAutoUnit(node.Memory.AllocBytes), node.Memory.AllocObjects,
+			node.Memory.GoroutinesStart, node.Memory.GoroutinesEnd,
+		)
+	}
+	if len(node.Children) < 1 {
+		return details
+	}
+	return details + fmt.Sprintf(" (%d children, wall %s, sum %s)",
+		len(node.Children), utils.FormatDurationAutoUnit(node.ChildrenWallClock), utils.FormatDurationAutoUnit(node.ChildrenSum),
+	)
+}
@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"github.com/EscanBE/go-lib/utils"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestFormatProfileReport(t *testing.T) {
+	require.Empty(t, FormatProfileReport(nil))
+
+	report := &utils.ProfileReport{
+		Desc:              "scan block 100",
+		ConstDesc:         "scanner",
+		Duration:          400 * time.Millisecond,
+		ChildrenWallClock: 400 * time.Millisecond,
+		ChildrenSum:       550 * time.Millisecond,
+		Children: []*utils.ProfileReport{
+			{Desc: "fetch", Level: 1, Duration: 850 * time.Microsecond},
+			{
+				Desc:              "process txs",
+				Level:             1,
+				Duration:          300 * time.Millisecond,
+				ChildrenWallClock: 300 * time.Millisecond,
+				ChildrenSum:       1450 * time.Millisecond,
+				Children: []*utils.ProfileReport{
+					{Desc: "tx 1", Level: 2, Duration: 300 * time.Millisecond, Parallel: true, Err: true},
+					{Desc: "tx 2", Level: 2, Duration: 1150 * time.Millisecond, Parallel: true},
+				},
+			},
+		},
+	}
+
+	require.Equal(t, `[ERR] scanner: scan block 100 - 400ms (2 children, wall 400ms, sum 550ms)
+- fetch: 850µs
+- process txs: 300ms (2 children, wall 300ms, sum 1.45s)
+  - tx 1: 300ms || ERR
+  - tx 2: 1.15s ||`, FormatProfileReport(report))
+
+	require.Equal(t, "[OK] single - 1ms", FormatProfileReport(&utils.ProfileReport{Desc: "single", Duration: time.Millisecond}))
+
+	require.Equal(t, `[OK] memory - 2ms [1.5MiB, 120 objs, goroutines 4 > 6] (1 children, wall 1ms, sum 1ms)
+- alloc: 1ms [512KiB, 20 objs, goroutines 4 > 4]`, FormatProfileReport(&utils.ProfileReport{
+		Desc:              "memory",
+		Duration:          2 * time.Millisecond,
+		Memory:            &utils.ProfileMemoryReport{AllocBytes: 1536 * 1024, AllocObjects: 120, GoroutinesStart: 4, GoroutinesEnd: 6},
+		ChildrenWallClock: time.Millisecond,
+		ChildrenSum:       time.Millisecond,
+		Children: []*utils.ProfileReport{
+			{
+				Desc:     "alloc",
+				Level:    1,
+				Duration: time.Millisecond,
+				Memory:   &utils.ProfileMemoryReport{AllocBytes: 512 * 1024, AllocObjects: 20, GoroutinesStart: 4, GoroutinesEnd: 4},
+			},
+		},
+	}))
+
+	t.Run("long report will be truncated", func(t *testing.T) {
+		report := &utils.ProfileReport{Desc: "master"}
+		for i := 0; i < 1000; i++ {
+			report.Children = append(report.Children, &utils.ProfileReport{Desc: strings.Repeat("ă", 10), Level: 1})
+		}
+		msgContent := FormatProfileReport(report)
+		require.Equal(t, maxAlertMessageLength, utf8.RuneCountInString(msgContent))
+		require.True(t, utf8.ValidString(msgContent))
+	})
+}
+
+func TestTelegramBot_SendProfileReport(t *testing.T) {
+	require.Error(t, (&TelegramBot{}).SendProfileReport(nil, []int64{1}))
+	require.Error(t, (&TelegramBot{}).SendProfileReport(&utils.ProfileReport{Desc: "x"}, nil), "chat list is required")
+}
+
+func TestFormatProfileAlert(t *testing.T) {
+	require.Empty(t, FormatProfileAlert(nil))
+	require.Empty(t, FormatProfileAlert(&utils.ProfileAlert{}))
+
+	report := &utils.ProfileReport{
+		Desc:              "scan block 100",
+		ConstDesc:         "scanner",
+		Duration:          3 * time.Second,
+		ChildrenWallClock: 3 * time.Second,
+		ChildrenSum:       3 * time.Second,
+		Children: []*utils.ProfileReport{
+			{Desc: "fetch", Level: 1, Duration: 500 * time.Millisecond},
+			{Desc: "process", Level: 1, Duration: 2500 * time.Millisecond, Err: true},
+		},
+	}
+
+	sink := &capturingSink{}
+	reporter, err := utils.NewProfileReporter(utils.ProfileReportPolicy{RootThreshold: 2 * time.Second, OnError: true}, sink)
+	require.NoError(t, err)
+
+	require.Equal(t, `[ERR] scanner: scan block 100 - 3s (2 children, wall 3s, sum 3s)
+! scan block 100 took 3s, exceeded threshold 2s
+! scan block 100 > process finalized with error
+Slowest: scan block 100 > process (2.5s)
+
+- fetch: 500ms
+* process: 2.5s ERR`, FormatProfileAlert(reporter.Evaluate(report)))
+
+	report.Children[1].Err = false
+	require.True(t, strings.HasPrefix(FormatProfileAlert(reporter.Evaluate(report)), "[SLOW] scanner: scan block 100 - 3s"))
+
+	t.Run("long alert keeps the reasons and the slowest path", func(t *testing.T) {
+		report := &utils.ProfileReport{Desc: "master", Duration: 3 * time.Second}
+		for i := 0; i < 1000; i++ {
+			report.Children = append(report.Children, &utils.ProfileReport{Desc: strings.Repeat("ă", 10), Level: 1, Duration: time.Millisecond})
+		}
+		report.Children = append(report.Children, &utils.ProfileReport{Desc: "slowest", Level: 1, Duration: 2 * time.Second})
+
+		msgContent := FormatProfileAlert(reporter.Evaluate(report))
+		require.Equal(t, maxAlertMessageLength, utf8.RuneCountInString(msgContent))
+		require.True(t, utf8.ValidString(msgContent))
+		require.Contains(t, msgContent, "\n! master took 3s, exceeded threshold 2s\n")
+		require.Contains(t, msgContent, "\nSlowest: master > slowest (2s)\n")
+		require.True(t, strings.HasSuffix(msgContent, "..."), "the tree must be truncated")
+	})
+}
+
+func TestTelegramBot_NewProfileReportSink(t *testing.T) {
+	_, err := (&TelegramBot{}).NewProfileReportSink(nil)
+	require.Error(t, err)
+
+	sink, err := (&TelegramBot{}).NewProfileReportSink([]int64{1})
+	require.NoError(t, err)
+	require.Error(t, sink.ReportProfile(nil))
+	require.Error(t, sink.ReportProfile(&utils.ProfileAlert{}))
+}
+
+// capturingSink implements utils.ProfileReportSink, collects the alerts
+type capturingSink struct {
+	alerts []*utils.ProfileAlert
+}
+
+// ReportProfile implements utils.ProfileReportSink
+func (s *capturingSink) ReportProfile(alert *utils.ProfileAlert) error {
+	s.alerts = append(s.alerts, alert)
+	return nil
+}
@@ -0,0 +1,133 @@
+package types
+
+import (
+	"context"
+	"fmt"
+)
+
+// CancellationReason is the reason which a CancellationTokenSource expired
+type CancellationReason string
+
+const (
+	CancellationReasonTimeout          CancellationReason = "timeout"
+	CancellationReasonCounterExhausted CancellationReason = "counter exhausted"
+	CancellationReasonManual           CancellationReason = "manual"
+)
+
+// CancellationCause describes the source which caused the expiry and why
+type CancellationCause struct {
+	Source *CancellationTokenSource // the source which expired first, can be a linked source of the expired one
+	Reason CancellationReason
+}
+
+// Err returns nil if the cause is nil, context.DeadlineExceeded if expired by time, otherwise context.Canceled
+func (c *CancellationCause) Err() error {
+	if c == nil {
+		return nil
+	}
+	if c.Reason == CancellationReasonTimeout {
+		return context.DeadlineExceeded
+	}
+	return context.Canceled
+}
+
+// String returns the cause in human-readable format
+func (c *CancellationCause) String() string {
+	if c == nil {
+		return "not expired"
+	}
+	return fmt.Sprintf("%s expired by %s", describeCancellationTokenSource(c.Source.Name()), c.Reason)
+}
+
+// NewLinkedCancellationTokenSource returns an instance of CancellationTokenSource which expires when any of the provided tokens expired,
+// or when requested cancellation. The tokens are not affected by the returned source.
+// Default counter will be infinite and it does not expire by time, use LinkTo to link a source created with other conditions.
+// Call Close when the source is no longer needed but not expired, to release it from long-lived tokens.
+func NewLinkedCancellationTokenSource(tokens ...CancellationToken) *CancellationTokenSource {
+	return NewCancellationTokenSource().LinkTo(tokens...)
+}
+
+// AnyCancellationToken returns a CancellationToken which expires as soon as any of the provided tokens expired.
+// It is held by the provided tokens until expired, use NewLinkedCancellationTokenSource to be able to release it earlier.
+func AnyCancellationToken(tokens ...CancellationToken) CancellationToken {
+	return NewLinkedCancellationTokenSource(tokens...).GetCancellationToken()
+}
+
+// LinkTo makes the source expire when any of the provided tokens expired, while the tokens are not affected by the source.
+// The tokens must not be created from this source or its linked sources. Returns the source itself, so it can be chained like
+//
+//	NewCancellationTokenSourceWithTimeoutDuration(10 * time.Second).LinkTo(jobToken)
+func (cs *CancellationTokenSource) LinkTo(tokens ...CancellationToken) *CancellationTokenSource {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for _, token := range tokens {
+		if token.cancellationTokenSource == nil || token.cancellationTokenSource == cs {
+			panic(fmt.Errorf("invalid token to link to %s", describeCancellationTokenSource(cs.name)))
+		}
+		cs.parents = append(cs.parents, token)
+		if cs.done != nil && cs.cause == nil {
+			cs.watchParent(token)
+		}
+	}
+	if cs.done != nil {
+		cs.expireIfNeeded()
+	}
+	return cs
+}
+
+// Close unlinks the source from the tokens it was linked to, so it no longer expires when they expired,
+// and releases the callbacks registered to them. The source itself is not expired.
+// Linked sources are held by the tokens they are linked to, until expired or closed.
+func (cs *CancellationTokenSource) Close() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.unwatchParents()
+	cs.parents = nil
+}
+
+// WithName names the source, so it can be identified in CancellationCause. Returns the source itself, so it can be chained.
+func (cs *CancellationTokenSource) WithName(name string) *CancellationTokenSource {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.name = name
+	return cs
+}
+
+// Name returns the name of the source, empty if not named
+func (cs *CancellationTokenSource) Name() string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.name
+}
+
+// describeCancellationTokenSource returns the human-readable identity of the source, by its name if any
+func describeCancellationTokenSource(name string) string {
+	if len(name) < 1 {
+		return "cancellation token source"
+	}
+	return fmt.Sprintf("cancellation token source [%s]", name)
+}
+
+// watchParent registers a callback to the linked token, which expires the source when the token expired.
+// No goroutine is kept while waiting, the callback is unregistered when the source expired or closed.
+// Must be called with the lock held.
+func (cs *CancellationTokenSource) watchParent(parent CancellationToken) {
+	unregister := parent.Register(func() {
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		cs.expireIfNeeded()
+	})
+	cs.unregisterParent = append(cs.unregisterParent, unregister)
+}
+
+// unwatchParents unregisters the callbacks registered to the linked tokens by watchParent. Must be called with the lock held.
+func (cs *CancellationTokenSource) unwatchParents() {
+	for _, unregister := range cs.unregisterParent {
+		unregister()
+	}
+	cs.unregisterParent = nil
+}
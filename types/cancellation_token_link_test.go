@@ -0,0 +1,241 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestNewLinkedCancellationTokenSource(t *testing.T) {
+	t.Run("child expires when parent does", func(t *testing.T) {
+		job := NewCancellationTokenSource().WithName("job")
+		task := NewCancellationTokenSourceWithTimeoutDuration(time.Hour).WithName("task").LinkTo(job.GetCancellationToken())
+		taskDone := task.Done()
+
+		if task.IsExpired() || task.Cause() != nil {
+			t.Errorf("child must not be expired before parent")
+		}
+
+		job.RequestCancellation()
+		if !task.IsExpired() || !isClosed(taskDone, time.Second) {
+			t.Errorf("child must be expired when parent expired")
+		}
+		cause := task.Cause()
+		if cause == nil || cause.Source != job || cause.Reason != CancellationReasonManual {
+			t.Errorf("Cause() = %v, want manual cancellation of the parent", cause)
+		}
+		if cause.String() != "cancellation token source [job] expired by manual" {
+			t.Errorf("String() = %s", cause.String())
+		}
+		if !errors.Is(task.Err(), context.Canceled) {
+			t.Errorf("Err() = %v, want %v", task.Err(), context.Canceled)
+		}
+	})
+
+	t.Run("parent is not affected by child", func(t *testing.T) {
+		job := NewCancellationTokenSource()
+		task := NewLinkedCancellationTokenSource(job.GetCancellationToken())
+
+		task.RequestCancellation()
+		if !task.IsExpired() {
+			t.Errorf("child must be expired")
+		}
+		if job.IsExpired() || isClosed(job.Done(), 10*time.Millisecond) {
+			t.Errorf("parent must not be affected by child")
+		}
+		if cause := task.Cause(); cause.Source != task || cause.Reason != CancellationReasonManual {
+			t.Errorf("Cause() = %v, want manual cancellation of the child", cause)
+		}
+	})
+
+	t.Run("own timeout of child", func(t *testing.T) {
+		job := NewCancellationTokenSource()
+		task := NewCancellationTokenSourceWithTimeoutDuration(50 * time.Millisecond).LinkTo(job.GetCancellationToken())
+
+		if !isClosed(task.Done(), time.Second) {
+			t.Errorf("child must be expired by its own timeout")
+		}
+		if cause := task.Cause(); cause.Source != task || cause.Reason != CancellationReasonTimeout {
+			t.Errorf("Cause() = %v, want timeout of the child", cause)
+		}
+		if !errors.Is(task.Err(), context.DeadlineExceeded) {
+			t.Errorf("Err() = %v, want %v", task.Err(), context.DeadlineExceeded)
+		}
+		if job.IsExpired() {
+			t.Errorf("parent must not be affected by child")
+		}
+	})
+
+	t.Run("multi-level", func(t *testing.T) {
+		root := NewCancellationTokenSourceWithTimeoutDurationAndCounter(time.Hour, 1).WithName("root")
+		middle := NewLinkedCancellationTokenSource(root.GetCancellationToken())
+		leaf := NewLinkedCancellationTokenSource(middle.GetCancellationToken())
+		leafDone := leaf.Done()
+
+		root.ReduceCounter()
+		if !isClosed(leafDone, time.Second) || !middle.IsExpired() {
+			t.Errorf("descendants must be expired when root expired")
+		}
+		if cause := leaf.Cause(); cause.Source != root || cause.Reason != CancellationReasonCounterExhausted {
+			t.Errorf("Cause() = %v, want counter exhausted of the root", cause)
+		}
+	})
+
+	t.Run("deadline is the earliest one", func(t *testing.T) {
+		early := time.Now().Add(time.Minute)
+		late := time.Now().Add(time.Hour)
+		job := NewCancellationTokenSourceWithExpiry(&early)
+		task := NewCancellationTokenSourceWithExpiry(&late).LinkTo(job.GetCancellationToken())
+		if deadline, ok := task.Deadline(); !ok || !deadline.Equal(early) {
+			t.Errorf("Deadline() = %v, %t, want %v", deadline, ok, early)
+		}
+	})
+
+	t.Run("link to expired token", func(t *testing.T) {
+		job := NewCancellationTokenSource()
+		job.RequestCancellation()
+
+		task := NewCancellationTokenSource()
+		done := task.Done()
+		task.LinkTo(job.GetCancellationToken())
+		if !isClosed(done, 0) {
+			t.Errorf("must be expired immediately when linked to expired token")
+		}
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		assertPanic := func(name string, fn func()) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected panic", name)
+				}
+			}()
+			fn()
+		}
+		cs := NewCancellationTokenSource()
+		assertPanic("itself", func() { cs.LinkTo(cs.GetCancellationToken()) })
+		assertPanic("zero token", func() { cs.LinkTo(CancellationToken{}) })
+	})
+}
+
+func TestAnyCancellationToken(t *testing.T) {
+	first := NewCancellationTokenSource().WithName("first")
+	second := NewCancellationTokenSourceWithTimeoutDuration(50 * time.Millisecond).WithName("second")
+	anyToken := AnyCancellationToken(first.GetCancellationToken(), second.GetCancellationToken())
+
+	if anyToken.IsExpired() {
+		t.Errorf("must not be expired before any of the tokens expired")
+	}
+	if !isClosed(anyToken.Done(), time.Second) {
+		t.Errorf("must be expired when any of the tokens expired")
+	}
+	if cause := anyToken.Cause(); cause.Source != second || cause.Reason != CancellationReasonTimeout {
+		t.Errorf("Cause() = %v, want timeout of the second", cause)
+	}
+	if first.IsExpired() {
+		t.Errorf("tokens must not be affected")
+	}
+}
+
+func TestCancellationTokenSource_Close(t *testing.T) {
+	// number of callbacks registered to the source, which are held until it expired
+	registered := func(cs *CancellationTokenSource) int {
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		return len(cs.callbacks)
+	}
+
+	t.Run("linking does not keep goroutines", func(t *testing.T) {
+		parent := NewCancellationTokenSource()
+		before := runtime.NumGoroutine()
+
+		children := make([]*CancellationTokenSource, 1000)
+		for i := range children {
+			children[i] = NewLinkedCancellationTokenSource(parent.GetCancellationToken())
+			_ = children[i].Done() // starts watching the parent
+		}
+		if after := runtime.NumGoroutine(); after-before > 10 {
+			t.Errorf("goroutines grew from %d to %d, linked sources must not keep goroutines", before, after)
+		}
+		if got := registered(parent); got != len(children) {
+			t.Errorf("registered callbacks = %d, want %d", got, len(children))
+		}
+
+		for _, child := range children {
+			child.Close()
+		}
+		if got := registered(parent); got != 0 {
+			t.Errorf("registered callbacks = %d after closed, want 0", got)
+		}
+	})
+
+	t.Run("closed source no longer follows the parent", func(t *testing.T) {
+		parent := NewCancellationTokenSource()
+		child := NewLinkedCancellationTokenSource(parent.GetCancellationToken())
+		childDone := child.Done()
+
+		child.Close()
+		if child.IsExpired() {
+			t.Errorf("close must not expire the source")
+		}
+		parent.RequestCancellation()
+		if child.IsExpired() || isClosed(childDone, 10*time.Millisecond) {
+			t.Errorf("closed source must not expire when the parent expired")
+		}
+
+		child.RequestCancellation()
+		if !isClosed(childDone, time.Second) {
+			t.Errorf("closed source must still be cancellable")
+		}
+	})
+
+	t.Run("expired source releases the parent", func(t *testing.T) {
+		parent := NewCancellationTokenSource()
+		child := NewLinkedCancellationTokenSource(parent.GetCancellationToken())
+		_ = child.Done()
+
+		child.RequestCancellation()
+		if got := registered(parent); got != 0 {
+			t.Errorf("registered callbacks = %d after expired, want 0", got)
+		}
+	})
+}
+
+func TestCancellationTokenSource_Cause(t *testing.T) {
+	cs := NewCancellationTokenSourceWithTimeoutDurationAndCounter(time.Hour, 1)
+	if cs.Cause() != nil || cs.Cause().Err() != nil {
+		t.Errorf("Cause() must be nil before expired")
+	}
+	if cs.Cause().String() != "not expired" {
+		t.Errorf("String() = %s", cs.Cause().String())
+	}
+
+	cs.ReduceCounter()
+	cs.RequestCancellation()
+	if cause := cs.GetCancellationToken().Cause(); cause.Reason != CancellationReasonCounterExhausted {
+		t.Errorf("Cause() = %v, the first cause must be kept", cause)
+	}
+	if cs.Cause().String() != "cancellation token source expired by counter exhausted" {
+		t.Errorf("String() = %s", cs.Cause().String())
+	}
+
+	t.Run("from context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		cs := NewCancellationTokenSourceFromContext(ctx)
+		if !isClosed(cs.Done(), time.Second) {
+			t.Errorf("must be expired after deadline of the context")
+		}
+		if cause := cs.Cause(); cause.Reason != CancellationReasonTimeout {
+			t.Errorf("Cause() = %v, want timeout", cause)
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		if cause := NewCancellationTokenSourceFromContext(ctx).Cause(); cause.Reason != CancellationReasonManual {
+			t.Errorf("Cause() = %v, want manual", cause)
+		}
+	})
+}
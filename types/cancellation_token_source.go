@@ -1,13 +1,35 @@
 package types
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"time"
 )
 
-// CancellationTokenSource holds an expiry condition, you can either provide expiry time and/or reduce counter or manually cancel it via RequestCancellation method
+var (
+	_ context.Context = CancellationToken{}
+)
+
+// noExpiry is the expiry of the CancellationTokenSource which does not expire by time
+var noExpiry = time.Date(9999, time.September, 9, 9, 9, 9, 9999, time.UTC)
+
+// CancellationTokenSource holds an expiry condition, you can either provide expiry time and/or reduce counter or manually cancel it via RequestCancellation method.
+// It is safe for concurrent use.
 type CancellationTokenSource struct {
+	mu      sync.Mutex
 	expiry  *time.Time
 	counter int64 // = 0 is out of chance, = -1 is infinite
+
+	name             string              // optional, to identify the source in CancellationCause
+	parents          []CancellationToken // linked tokens, the source expires when any of them expired
+	unregisterParent []func() bool       // unregisters the callbacks registered to the linked tokens, by watchParent
+	cause            *CancellationCause  // recorded when expired by an event, computed from the state otherwise
+
+	done           chan struct{}     // lazily created by Done, closed when expired
+	timer          *time.Timer       // closes done when the expiry time passed
+	callbacks      map[uint64]func() // registered by Register, called once when expired
+	nextCallbackId uint64
 }
 
 // NewCancellationTokenSourceWithTimeoutMilliseconds returns an instance of CancellationTokenSource
@@ -64,10 +86,44 @@ func NewCancellationTokenSourceWithExpiryAndCounter(expiry *time.Time, counter i
 // NewCancellationTokenSource returns an instance of CancellationTokenSource
 // which returns always return false when ask for IsExpired, but you can cancel it by calling RequestCancellation
 func NewCancellationTokenSource() *CancellationTokenSource {
-	expiry := time.Date(9999, time.September, 9, 9, 9, 9, 9999, time.UTC)
+	expiry := noExpiry
 	return NewCancellationTokenSourceWithExpiryAndCounter(&expiry, -1)
 }
 
+// NewCancellationTokenSourceFromContext returns an instance of CancellationTokenSource which expires at the deadline of the context if any,
+// and is cancelled when the context is done. Default counter will be infinite.
+// Until either the context is done or the source is expired, a goroutine is kept to watch the context.
+func NewCancellationTokenSourceFromContext(ctx context.Context) *CancellationTokenSource {
+	expiry := noExpiry
+	if deadline, ok := ctx.Deadline(); ok {
+		expiry = deadline
+	}
+	cs := NewCancellationTokenSourceWithExpiryAndCounter(&expiry, -1)
+
+	if ctx.Err() != nil {
+		cs.cancelByContext(ctx)
+	} else if ctxDone := ctx.Done(); ctxDone != nil {
+		csDone := cs.Done()
+		go func() {
+			select {
+			case <-ctxDone:
+				cs.cancelByContext(ctx)
+			case <-csDone:
+			}
+		}()
+	}
+	return cs
+}
+
+// cancelByContext expires the source since the context is done, by timeout if the deadline of the context exceeded, otherwise manually
+func (cs *CancellationTokenSource) cancelByContext(ctx context.Context) {
+	reason := CancellationReasonManual
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		reason = CancellationReasonTimeout
+	}
+	cs.cancel(reason)
+}
+
 // GetCancellationToken returns an instance of CancellationToken, which can check if expired but does not have ability to request cancellation
 func (cs *CancellationTokenSource) GetCancellationToken() CancellationToken {
 	return CancellationToken{
@@ -75,26 +131,261 @@ func (cs *CancellationTokenSource) GetCancellationToken() CancellationToken {
 	}
 }
 
-// RequestCancellation requests for CancellationTokenSource to be expired and counter also reduce to zero
+// RequestCancellation requests for CancellationTokenSource to be expired and counter also reduce to zero.
+// Linked sources created from this source will be expired as well, but not the sources which this source was linked to.
 func (cs *CancellationTokenSource) RequestCancellation() {
+	cs.cancel(CancellationReasonManual)
+}
+
+// cancel expires the source, the reason is recorded if not expired yet
+func (cs *CancellationTokenSource) cancel(reason CancellationReason) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.expire(reason)
 	cs.expiry = nil
 	cs.counter = 0
 }
 
 // ReduceCounter subtracts counter by 1 if remaining value is > 0
 func (cs *CancellationTokenSource) ReduceCounter() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
 	if cs.counter <= 0 {
 		return
 	}
+	if cs.counter == 1 {
+		cs.expire(CancellationReasonCounterExhausted)
+	}
 	cs.counter--
 }
 
-// IsExpired returns `true` if expired
+// IsExpired returns `true` if expired, including when any of the linked tokens expired
 func (cs *CancellationTokenSource) IsExpired() bool {
-	return cs.expiry == nil || cs.counter == 0 || time.Now().After(*cs.expiry)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.isExpired()
+}
+
+// isExpired returns `true` if expired, must be called with the lock held
+func (cs *CancellationTokenSource) isExpired() bool {
+	return cs.currentCause() != nil
+}
+
+// Cause returns the source which caused the expiry and why, nil if not expired yet.
+// When expired because of a linked token, the cause is the one of the linked token, so it tells the origin of the cancellation.
+func (cs *CancellationTokenSource) Cause() *CancellationCause {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.currentCause()
 }
 
-// CancellationToken is child of CancellationTokenSource, it can check if the parent token source is expired
+// currentCause returns the recorded cause, or computes it from the current state. Must be called with the lock held.
+func (cs *CancellationTokenSource) currentCause() *CancellationCause {
+	if cs.cause != nil {
+		return cs.cause
+	}
+
+	switch {
+	case cs.expiry == nil:
+		return &CancellationCause{Source: cs, Reason: CancellationReasonManual}
+	case cs.counter == 0:
+		return &CancellationCause{Source: cs, Reason: CancellationReasonCounterExhausted}
+	case time.Now().After(*cs.expiry):
+		return &CancellationCause{Source: cs, Reason: CancellationReasonTimeout}
+	}
+
+	for _, parent := range cs.parents {
+		if cause := parent.Cause(); cause != nil {
+			return cause
+		}
+	}
+	return nil
+}
+
+// expire records the cause if not expired yet, the provided reason is used if not expired by the current state,
+// then closes the done channel. Must be called with the lock held.
+func (cs *CancellationTokenSource) expire(reason CancellationReason) {
+	if cs.cause == nil {
+		cs.cause = cs.currentCause()
+		if cs.cause == nil {
+			cs.cause = &CancellationCause{Source: cs, Reason: reason}
+		}
+	}
+	cs.closeDone()
+}
+
+// expireIfNeeded records the cause and closes the done channel if expired by the current state, returns `true` if expired.
+// Must be called with the lock held.
+func (cs *CancellationTokenSource) expireIfNeeded() bool {
+	cause := cs.currentCause()
+	if cause == nil {
+		return false
+	}
+	cs.cause = cause
+	cs.closeDone()
+	return true
+}
+
+// Done returns a channel which is closed when the CancellationTokenSource is expired, same as context.Context
+func (cs *CancellationTokenSource) Done() <-chan struct{} {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.ensureDone()
+	return cs.done
+}
+
+// ensureDone creates the done channel then starts watching the expiry, if not yet. Must be called with the lock held.
+func (cs *CancellationTokenSource) ensureDone() {
+	if cs.done == nil {
+		cs.done = make(chan struct{})
+		cs.watchExpiry()
+	}
+}
+
+// Register registers the callback to be called once, on its own goroutine, when the source expired.
+// If already expired, the callback is called immediately. The expiry time is watched by a timer since registered,
+// so the callback is called on time without polling IsExpired.
+// The returned function unregisters the callback, it returns false if the callback has already been called or unregistered.
+func (cs *CancellationTokenSource) Register(callback func()) (unregister func() bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.ensureDone()
+	select {
+	case <-cs.done:
+		go callback()
+		return func() bool {
+			return false
+		}
+	default:
+	}
+
+	if cs.callbacks == nil {
+		cs.callbacks = make(map[uint64]func())
+	}
+	id := cs.nextCallbackId
+	cs.nextCallbackId++
+	cs.callbacks[id] = callback
+
+	return func() bool {
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+
+		if _, found := cs.callbacks[id]; !found {
+			return false
+		}
+		delete(cs.callbacks, id)
+		return true
+	}
+}
+
+// Wait blocks until the source expired or the timeout passed, returns `true` if expired.
+// Non-positive timeout returns immediately, same as IsExpired.
+func (cs *CancellationTokenSource) Wait(timeout time.Duration) bool {
+	if timeout <= 0 {
+		return cs.IsExpired()
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-cs.Done():
+		return true
+	case <-timer.C:
+		return cs.IsExpired()
+	}
+}
+
+// Sleep pauses the current goroutine for the duration, returns early when the source expired.
+// Returns `true` if the source expired, so the caller can stop, otherwise `false` after slept the whole duration.
+func (cs *CancellationTokenSource) Sleep(d time.Duration) bool {
+	return cs.Wait(d)
+}
+
+// Err returns nil if not expired yet, context.DeadlineExceeded if expired by time, otherwise context.Canceled.
+// So the error can be checked the same way as the error of context.Context.
+func (cs *CancellationTokenSource) Err() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.currentCause().Err()
+}
+
+// Deadline returns the earliest expiry time of the source and the linked tokens,
+// ok is false when none of them expires by time, same as context.Context
+func (cs *CancellationTokenSource) Deadline() (deadline time.Time, ok bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.expiry != nil && !cs.expiry.Equal(noExpiry) {
+		deadline, ok = *cs.expiry, true
+	}
+	for _, parent := range cs.parents {
+		if parentDeadline, parentOk := parent.Deadline(); parentOk && (!ok || parentDeadline.Before(deadline)) {
+			deadline, ok = parentDeadline, true
+		}
+	}
+	return
+}
+
+// watchExpiry closes the done channel if expired, otherwise schedules to check again at the expiry time
+// and watches the linked tokens. Must be called with the lock held.
+func (cs *CancellationTokenSource) watchExpiry() {
+	if cs.expireIfNeeded() {
+		return
+	}
+	for _, parent := range cs.parents {
+		cs.watchParent(parent)
+	}
+	cs.scheduleTimer()
+}
+
+// scheduleTimer schedules to check again at the expiry time, if the source expires by time. Must be called with the lock held.
+func (cs *CancellationTokenSource) scheduleTimer() {
+	if cs.expiry == nil || cs.expiry.Equal(noExpiry) {
+		return
+	}
+	cs.timer = time.AfterFunc(time.Until(*cs.expiry), func() {
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		cs.timer = nil
+		if !cs.expireIfNeeded() {
+			cs.scheduleTimer()
+		}
+	})
+}
+
+// closeDone closes the done channel if created and not closed yet, then stops the timer. Must be called with the lock held.
+func (cs *CancellationTokenSource) closeDone() {
+	if cs.timer != nil {
+		cs.timer.Stop()
+		cs.timer = nil
+	}
+	if cs.done == nil {
+		return
+	}
+	select {
+	case <-cs.done:
+	default:
+		close(cs.done)
+	}
+
+	for _, callback := range cs.callbacks {
+		go callback()
+	}
+	cs.callbacks = nil
+
+	cs.unwatchParents()
+}
+
+// CancellationToken is child of CancellationTokenSource, it can check if the parent token source is expired.
+// It implements context.Context, so it can be passed to any API which takes a context.
 type CancellationToken struct {
 	cancellationTokenSource *CancellationTokenSource
 }
@@ -104,7 +395,84 @@ func (ct CancellationToken) IsExpired() bool {
 	return ct.cancellationTokenSource.IsExpired()
 }
 
+// Register registers the callback to be called once, on its own goroutine, when the parent token source expired.
+// The returned function unregisters the callback, it returns false if the callback has already been called or unregistered.
+func (ct CancellationToken) Register(callback func()) (unregister func() bool) {
+	return ct.cancellationTokenSource.Register(callback)
+}
+
+// Wait blocks until the parent token source expired or the timeout passed, returns `true` if expired
+func (ct CancellationToken) Wait(timeout time.Duration) bool {
+	return ct.cancellationTokenSource.Wait(timeout)
+}
+
+// Sleep pauses the current goroutine for the duration, returns early when the parent token source expired.
+// Returns `true` if expired, otherwise `false` after slept the whole duration.
+func (ct CancellationToken) Sleep(d time.Duration) bool {
+	return ct.cancellationTokenSource.Sleep(d)
+}
+
+// Cause returns the source which caused the expiry of the parent token source and why, nil if not expired yet
+func (ct CancellationToken) Cause() *CancellationCause {
+	return ct.cancellationTokenSource.Cause()
+}
+
 // ReduceCounter subtracts counter on CancellationTokenSource by 1 if remaining value is > 0
 func (ct *CancellationToken) ReduceCounter() {
 	ct.cancellationTokenSource.ReduceCounter()
 }
+
+// Done returns a channel which is closed when the parent token source is expired, implements context.Context
+func (ct CancellationToken) Done() <-chan struct{} {
+	return ct.cancellationTokenSource.Done()
+}
+
+// Err returns nil if the parent token source is not expired yet, context.DeadlineExceeded if expired by time,
+// otherwise context.Canceled. Implements context.Context
+func (ct CancellationToken) Err() error {
+	return ct.cancellationTokenSource.Err()
+}
+
+// Deadline returns the expiry time of the parent token source, implements context.Context
+func (ct CancellationToken) Deadline() (deadline time.Time, ok bool) {
+	return ct.cancellationTokenSource.Deadline()
+}
+
+// Value always returns nil since the token does not carry any value, implements context.Context.
+// Use ContextWithCancellationToken to combine the token with the values of a context.
+func (ct CancellationToken) Value(_ any) any {
+	return nil
+}
+
+// ContextWithCancellationToken returns a copy of the parent context which carries the values of the parent,
+// and is done when either the parent is done or the token is expired.
+// The returned cancel function should be called to release resources, as soon as the operations running in the context complete.
+func ContextWithCancellationToken(parent context.Context, ct CancellationToken) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if deadline, ok := ct.Deadline(); ok {
+		ctx, cancel = context.WithDeadline(parent, deadline)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+
+	if ct.IsExpired() {
+		cancel()
+		return ctx, cancel
+	}
+
+	ctDone := ct.Done()
+	go func() {
+		select {
+		case <-ctDone:
+			if errors.Is(ct.Err(), context.DeadlineExceeded) {
+				// the context expires at the same deadline, let it report context.DeadlineExceeded
+				<-ctx.Done()
+				return
+			}
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
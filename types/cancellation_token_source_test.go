@@ -1,6 +1,11 @@
 package types
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 )
@@ -269,3 +274,392 @@ func TestReduceCounterOnCancellationToken(t *testing.T) {
 		t.Errorf("ReduceCounter() didn't change counter state correctly")
 	}
 }
+
+// isClosed returns true if the channel is closed within the timeout
+func isClosed(ch <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+	}
+	select {
+	case <-ch:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestCancellationTokenSource_Done(t *testing.T) {
+	t.Run("request cancellation", func(t *testing.T) {
+		cs := NewCancellationTokenSource()
+		done := cs.Done()
+		if done != cs.Done() {
+			t.Errorf("Done() must return the same channel")
+		}
+		if isClosed(done, 10*time.Millisecond) {
+			t.Errorf("Done() closed before expired")
+		}
+		if cs.Err() != nil {
+			t.Errorf("Err() must be nil before expired, got %v", cs.Err())
+		}
+
+		cs.RequestCancellation()
+		if !isClosed(done, time.Second) {
+			t.Errorf("Done() not closed after RequestCancellation()")
+		}
+		if !errors.Is(cs.Err(), context.Canceled) {
+			t.Errorf("Err() = %v, want %v", cs.Err(), context.Canceled)
+		}
+		cs.RequestCancellation() // shouldn't panic
+	})
+
+	t.Run("counter exhausted", func(t *testing.T) {
+		cs := NewCancellationTokenSourceWithTimeoutDurationAndCounter(time.Hour, 2)
+		done := cs.Done()
+		cs.ReduceCounter()
+		if isClosed(done, 10*time.Millisecond) {
+			t.Errorf("Done() closed before counter exhausted")
+		}
+		cs.ReduceCounter()
+		if !isClosed(done, time.Second) {
+			t.Errorf("Done() not closed after counter exhausted")
+		}
+		if !errors.Is(cs.Err(), context.Canceled) {
+			t.Errorf("Err() = %v, want %v", cs.Err(), context.Canceled)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		cs := NewCancellationTokenSourceWithTimeoutDuration(50 * time.Millisecond)
+		done := cs.GetCancellationToken().Done()
+		if !isClosed(done, time.Second) {
+			t.Errorf("Done() not closed after timeout")
+		}
+		if !errors.Is(cs.Err(), context.DeadlineExceeded) {
+			t.Errorf("Err() = %v, want %v", cs.Err(), context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("already expired", func(t *testing.T) {
+		expiry := time.Now().Add(-time.Second)
+		cs := NewCancellationTokenSourceWithExpiry(&expiry)
+		if !isClosed(cs.Done(), 0) {
+			t.Errorf("Done() must be closed when already expired")
+		}
+	})
+}
+
+func TestCancellationTokenSource_Deadline(t *testing.T) {
+	if _, ok := NewCancellationTokenSource().Deadline(); ok {
+		t.Errorf("Deadline() must not be set when not expire by time")
+	}
+
+	expiry := time.Now().Add(time.Hour)
+	cs := NewCancellationTokenSourceWithExpiry(&expiry)
+	if deadline, ok := cs.GetCancellationToken().Deadline(); !ok || !deadline.Equal(expiry) {
+		t.Errorf("Deadline() = %v, %t, want %v", deadline, ok, expiry)
+	}
+
+	cs.RequestCancellation()
+	if _, ok := cs.Deadline(); ok {
+		t.Errorf("Deadline() must not be set after RequestCancellation()")
+	}
+}
+
+func TestCancellationTokenSource_Concurrent(t *testing.T) {
+	cs := NewCancellationTokenSourceWithTimeoutDurationAndCounter(time.Hour, 100)
+	ct := cs.GetCancellationToken()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			ct.ReduceCounter()
+		}()
+		go func() {
+			defer wg.Done()
+			_ = ct.IsExpired()
+			_ = ct.Err()
+			_ = ct.Done()
+		}()
+		go func(i int) {
+			defer wg.Done()
+			if i == 25 {
+				cs.RequestCancellation()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if !ct.IsExpired() || !isClosed(ct.Done(), time.Second) {
+		t.Errorf("must be expired after RequestCancellation()")
+	}
+}
+
+func TestCancellationToken_AsContext(t *testing.T) {
+	cs := NewCancellationTokenSource()
+	var ctx context.Context = cs.GetCancellationToken()
+	if ctx.Value("key") != nil {
+		t.Errorf("Value() must be nil")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	time.AfterFunc(50*time.Millisecond, cs.RequestCancellation)
+	_, err = http.DefaultClient.Do(req)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("request must be cancelled by the token, got %v", err)
+	}
+}
+
+func TestContextWithCancellationToken(t *testing.T) {
+	type ctxKey struct{}
+	parent := context.WithValue(context.Background(), ctxKey{}, "value")
+
+	t.Run("token expired", func(t *testing.T) {
+		cs := NewCancellationTokenSource()
+		ctx, cancel := ContextWithCancellationToken(parent, cs.GetCancellationToken())
+		defer cancel()
+
+		if ctx.Value(ctxKey{}) != "value" {
+			t.Errorf("values of the parent must be carried")
+		}
+		if isClosed(ctx.Done(), 10*time.Millisecond) {
+			t.Errorf("context done before token expired")
+		}
+		cs.RequestCancellation()
+		if !isClosed(ctx.Done(), time.Second) {
+			t.Errorf("context not done after token expired")
+		}
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			t.Errorf("Err() = %v, want %v", ctx.Err(), context.Canceled)
+		}
+	})
+
+	t.Run("deadline of token", func(t *testing.T) {
+		ctx, cancel := ContextWithCancellationToken(parent, NewCancellationTokenSourceWithTimeoutDuration(50*time.Millisecond).GetCancellationToken())
+		defer cancel()
+
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("deadline of the token must be applied")
+		}
+		if !isClosed(ctx.Done(), time.Second) {
+			t.Errorf("context not done after deadline")
+		}
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			t.Errorf("Err() = %v, want %v", ctx.Err(), context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("parent cancelled", func(t *testing.T) {
+		parent, cancelParent := context.WithCancel(parent)
+		cs := NewCancellationTokenSource()
+		ctx, cancel := ContextWithCancellationToken(parent, cs.GetCancellationToken())
+		defer cancel()
+
+		cancelParent()
+		if !isClosed(ctx.Done(), time.Second) {
+			t.Errorf("context not done after parent cancelled")
+		}
+		if cs.IsExpired() {
+			t.Errorf("token must not be affected by the context")
+		}
+	})
+
+	t.Run("already expired token", func(t *testing.T) {
+		cs := NewCancellationTokenSource()
+		cs.RequestCancellation()
+		ctx, cancel := ContextWithCancellationToken(parent, cs.GetCancellationToken())
+		defer cancel()
+
+		if !isClosed(ctx.Done(), 0) {
+			t.Errorf("context must be done when token already expired")
+		}
+	})
+}
+
+func TestNewCancellationTokenSourceFromContext(t *testing.T) {
+	t.Run("cancelled by context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cs := NewCancellationTokenSourceFromContext(ctx)
+		if cs.IsExpired() {
+			t.Errorf("must not be expired before context done")
+		}
+		if _, ok := cs.Deadline(); ok {
+			t.Errorf("Deadline() must not be set when context has no deadline")
+		}
+
+		cancel()
+		if !isClosed(cs.Done(), time.Second) || !cs.IsExpired() {
+			t.Errorf("must be expired after context done")
+		}
+	})
+
+	t.Run("deadline of context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		cs := NewCancellationTokenSourceFromContext(ctx)
+		deadline, _ := ctx.Deadline()
+		if got, ok := cs.Deadline(); !ok || !got.Equal(deadline) {
+			t.Errorf("Deadline() = %v, %t, want %v", got, ok, deadline)
+		}
+		if !isClosed(cs.Done(), time.Second) || !cs.IsExpired() {
+			t.Errorf("must be expired after deadline")
+		}
+	})
+
+	t.Run("context already done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if !NewCancellationTokenSourceFromContext(ctx).IsExpired() {
+			t.Errorf("must be expired when context already done")
+		}
+	})
+
+	t.Run("never done context", func(t *testing.T) {
+		cs := NewCancellationTokenSourceFromContext(context.Background())
+		if cs.IsExpired() {
+			t.Errorf("must not be expired")
+		}
+	})
+}
+
+func TestCancellationTokenSource_Register(t *testing.T) {
+	t.Run("called once on expiry", func(t *testing.T) {
+		cs := NewCancellationTokenSource()
+		called := make(chan int, 10)
+		cs.Register(func() { called <- 1 })
+		cs.GetCancellationToken().Register(func() { called <- 2 })
+
+		select {
+		case <-called:
+			t.Errorf("callback must not be called before expired")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		cs.RequestCancellation()
+		cs.RequestCancellation()
+		sum := 0
+		for i := 0; i < 2; i++ {
+			select {
+			case v := <-called:
+				sum += v
+			case <-time.After(time.Second):
+				t.Fatalf("callback not called after expired")
+			}
+		}
+		if sum != 3 {
+			t.Errorf("each callback must be called once, got sum %d", sum)
+		}
+		select {
+		case <-called:
+			t.Errorf("callback must be called only once")
+		case <-time.After(10 * time.Millisecond):
+		}
+	})
+
+	t.Run("fired by timer without polling", func(t *testing.T) {
+		cs := NewCancellationTokenSourceWithTimeoutDuration(50 * time.Millisecond)
+		called := make(chan struct{})
+		cs.Register(func() { close(called) })
+		if !isClosed(called, time.Second) {
+			t.Errorf("callback not called on timeout")
+		}
+	})
+
+	t.Run("already expired", func(t *testing.T) {
+		cs := NewCancellationTokenSource()
+		cs.RequestCancellation()
+		called := make(chan struct{})
+		unregister := cs.Register(func() { close(called) })
+		if !isClosed(called, time.Second) {
+			t.Errorf("callback must be called immediately when already expired")
+		}
+		if unregister() {
+			t.Errorf("unregister must return false when already called")
+		}
+	})
+
+	t.Run("unregister", func(t *testing.T) {
+		cs := NewCancellationTokenSourceWithTimeoutDurationAndCounter(time.Hour, 1)
+		called := make(chan struct{})
+		unregister := cs.Register(func() { close(called) })
+		if !unregister() {
+			t.Errorf("unregister must return true when not called yet")
+		}
+		if unregister() {
+			t.Errorf("unregister must return false when already unregistered")
+		}
+		cs.ReduceCounter()
+		if isClosed(called, 20*time.Millisecond) {
+			t.Errorf("unregistered callback must not be called")
+		}
+	})
+
+	t.Run("linked", func(t *testing.T) {
+		job := NewCancellationTokenSource()
+		task := NewLinkedCancellationTokenSource(job.GetCancellationToken())
+		called := make(chan struct{})
+		task.Register(func() { close(called) })
+		job.RequestCancellation()
+		if !isClosed(called, time.Second) {
+			t.Errorf("callback must be called when the linked token expired")
+		}
+	})
+}
+
+func TestCancellationTokenSource_Wait(t *testing.T) {
+	cs := NewCancellationTokenSourceWithTimeoutDuration(time.Hour)
+	if cs.Wait(0) || cs.Wait(-time.Second) {
+		t.Errorf("Wait() must return false when not expired")
+	}
+
+	start := time.Now()
+	if cs.GetCancellationToken().Wait(30 * time.Millisecond) {
+		t.Errorf("Wait() must return false when not expired")
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Wait() must block until timeout, returned after %s", elapsed)
+	}
+
+	time.AfterFunc(20*time.Millisecond, cs.RequestCancellation)
+	start = time.Now()
+	if !cs.Wait(time.Minute) {
+		t.Errorf("Wait() must return true when expired")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Wait() must return as soon as expired, returned after %s", elapsed)
+	}
+	if !cs.Wait(0) {
+		t.Errorf("Wait() must return true when expired")
+	}
+}
+
+func TestCancellationTokenSource_Sleep(t *testing.T) {
+	ct := NewCancellationTokenSourceWithTimeoutDuration(50 * time.Millisecond).GetCancellationToken()
+
+	start := time.Now()
+	if ct.Sleep(10 * time.Millisecond) {
+		t.Errorf("Sleep() must return false when slept the whole duration")
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Sleep() must sleep the whole duration, returned after %s", elapsed)
+	}
+
+	if !ct.Sleep(time.Minute) {
+		t.Errorf("Sleep() must return true when expired")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Sleep() must return early when expired, returned after %s", elapsed)
+	}
+}
@@ -1,24 +1,57 @@
 package types
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
 	"github.com/EscanBE/go-lib/validation"
+	"io"
 	"net"
+	"os"
 	"reflect"
 	"strconv"
+	"sync/atomic"
 )
 
 // === SshRemoteServer
 
-// SshRemote holds target endpoint information
+// SshRemote holds target endpoint information.
+//
+// BREAKING CHANGE: host key of the remote server is always verified. A nil HostKeyPolicy means known_hosts policy
+// with ~/.ssh/known_hosts, so connections to hosts which are not listed there are rejected,
+// while any host key was accepted previously. Supply NewSshHostKeyPolicyInsecure to keep the previous behavior.
 type SshRemote struct {
 	Host             string
 	Port             string
 	Username         string
 	AuthByPrivateKey *SshAuthPrivateKey
+	AuthMethods      []SshAuth         // authentication methods, tried in order after AuthByPrivateKey if supplied
+	HostKeyPolicy    *SshHostKeyPolicy // how the host key of the remote server is verified, nil = known_hosts of current user, see the type doc
 }
 
-// NewSshRemoteEndpoint returns a SshRemote instance with endpoint info and supplied auth type if any
+// SshAuth is an authentication method of SshRemote,
+// implemented by SshAuthPrivateKey, SshAuthPassword, SshAuthAgent and SshAuthKeyboardInteractive
+type SshAuth interface {
+	// Redacted returns a copy with secrets replaced, safe for logging
+	Redacted() interface{}
+
+	// writeFingerprint writes the credentials which identify the authentication method
+	writeFingerprint(w io.Writer)
+}
+
+var (
+	_ SshAuth = SshAuthPrivateKey{}
+	_ SshAuth = SshAuthPassword{}
+	_ SshAuth = SshAuthAgent{}
+	_ SshAuth = SshAuthKeyboardInteractive{}
+)
+
+// NewSshRemoteEndpoint returns a SshRemote instance with endpoint info and supplied auth type,
+// which is either a SshAuth or a []SshAuth to be tried in order.
+// Host key is verified by known_hosts of current user unless another policy is supplied by WithHostKeyPolicy.
 func NewSshRemoteEndpoint(host, port, username string, authType interface{}) (*SshRemote, error) {
 	if len(host) < 1 {
 		return nil, fmt.Errorf("host is blank")
@@ -50,9 +83,22 @@ func NewSshRemoteEndpoint(host, port, username string, authType interface{}) (*S
 		Username: username,
 	}
 
-	if pk, ok1 := authType.(SshAuthPrivateKey); ok1 {
-		result.AuthByPrivateKey = &pk
-	} else {
+	switch auth := authType.(type) {
+	case SshAuthPrivateKey:
+		result.AuthByPrivateKey = &auth
+	case SshAuthPassword, SshAuthAgent, SshAuthKeyboardInteractive:
+		result.AuthMethods = []SshAuth{auth.(SshAuth)}
+	case []SshAuth:
+		if len(auth) < 1 {
+			return nil, fmt.Errorf("at least one authentication type is required")
+		}
+		for _, method := range auth {
+			if !isSupportedSshAuth(method) {
+				return nil, fmt.Errorf("not supported auth type %s", reflect.TypeOf(method))
+			}
+		}
+		result.AuthMethods = append([]SshAuth{}, auth...)
+	default:
 		return nil, fmt.Errorf("not supported auth type %s", reflect.TypeOf(authType))
 	}
 
@@ -64,6 +110,45 @@ func (sr *SshRemote) WithAuthByPrivateKey(authPk SshAuthPrivateKey) {
 	sr.AuthByPrivateKey = &authPk
 }
 
+// WithHostKeyPolicy supplies the policy which the host key of the remote endpoint is verified by
+func (sr *SshRemote) WithHostKeyPolicy(policy SshHostKeyPolicy) {
+	sr.HostKeyPolicy = &policy
+}
+
+// WithAuth appends authentication methods for the remote endpoint, to be tried in order
+func (sr *SshRemote) WithAuth(auths ...SshAuth) {
+	sr.AuthMethods = append(sr.AuthMethods, auths...)
+}
+
+// GetAuthMethods returns the supplied authentication methods in the order they should be tried
+func (sr *SshRemote) GetAuthMethods() []SshAuth {
+	var auths []SshAuth
+	if sr.AuthByPrivateKey != nil {
+		auths = append(auths, *sr.AuthByPrivateKey)
+	}
+	return append(auths, sr.AuthMethods...)
+}
+
+// AuthFingerprint returns a digest of the supplied authentication methods, in order,
+// remotes of the same fingerprint authenticate using the same credentials. The secrets can not be recovered from it.
+// Keyboard-interactive methods with custom challenge function are identified by the instance returned by NewSshAuthByKeyboardInteractive,
+// the ones created without the constructor can not be identified so the fingerprint differs on every call.
+func (sr *SshRemote) AuthFingerprint() string {
+	hash := sha256.New()
+	for _, auth := range sr.GetAuthMethods() {
+		auth.writeFingerprint(hash)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// writeFingerprintFields writes the fields, each is prefixed by its length so the boundaries are unambiguous
+func writeFingerprintFields(w io.Writer, fields ...[]byte) {
+	for _, field := range fields {
+		_ = binary.Write(w, binary.BigEndian, uint32(len(field)))
+		_, _ = w.Write(field)
+	}
+}
+
 // GetEndpoint returns endpoint as combined of host and port
 func (sr *SshRemote) GetEndpoint() string {
 	if len(sr.Port) < 1 {
@@ -77,12 +162,39 @@ func (sr *SshRemote) IsAuthByPrivateKey() bool {
 	return sr.AuthByPrivateKey != nil
 }
 
+// Redacted returns a copy of the remote with authentication secrets replaced, safe for logging
+func (sr SshRemote) Redacted() interface{} {
+	if sr.AuthByPrivateKey != nil {
+		redacted := sr.AuthByPrivateKey.Redacted().(SshAuthPrivateKey)
+		sr.AuthByPrivateKey = &redacted
+	}
+	if len(sr.AuthMethods) > 0 {
+		redactedAuthMethods := make([]SshAuth, len(sr.AuthMethods))
+		for i, auth := range sr.AuthMethods {
+			redactedAuthMethods[i] = auth.Redacted().(SshAuth)
+		}
+		sr.AuthMethods = redactedAuthMethods
+	}
+	return sr
+}
+
+// isSupportedSshAuth returns true if the auth is one of the supported types, pointers are not accepted
+func isSupportedSshAuth(auth SshAuth) bool {
+	switch auth.(type) {
+	case SshAuthPrivateKey, SshAuthPassword, SshAuthAgent, SshAuthKeyboardInteractive:
+		return true
+	default:
+		return false
+	}
+}
+
 // === SshAuthPrivateKey
 
 // SshAuthPrivateKey holds target endpoint auth information
 type SshAuthPrivateKey struct {
-	PrivateKey []byte
-	Passphrase []byte
+	PrivateKey  []byte
+	Passphrase  []byte
+	Certificate []byte // OpenSSH certificate of the key in authorized_keys format, eg: content of id_ed25519-cert.pub, optional
 }
 
 // NewSshAuthByPrivateKey returns an instance which holds target endpoint auth information
@@ -92,3 +204,196 @@ func NewSshAuthByPrivateKey(privateKey, passphrase []byte) SshAuthPrivateKey {
 		Passphrase: passphrase,
 	}
 }
+
+// NewSshAuthByCertificate returns an instance which holds the private key and its OpenSSH certificate signed by a trusted CA
+func NewSshAuthByCertificate(privateKey, passphrase, certificate []byte) SshAuthPrivateKey {
+	return SshAuthPrivateKey{
+		PrivateKey:  privateKey,
+		Passphrase:  passphrase,
+		Certificate: certificate,
+	}
+}
+
+// Redacted returns a copy with private key and passphrase replaced, safe for logging
+func (a SshAuthPrivateKey) Redacted() interface{} {
+	if len(a.PrivateKey) > 0 {
+		a.PrivateKey = []byte(logtypes.REDACTED_VALUE)
+	}
+	if len(a.Passphrase) > 0 {
+		a.Passphrase = []byte(logtypes.REDACTED_VALUE)
+	}
+	return a
+}
+
+func (a SshAuthPrivateKey) writeFingerprint(w io.Writer) {
+	writeFingerprintFields(w, []byte("private-key"), a.PrivateKey, a.Passphrase, a.Certificate)
+}
+
+// === SshAuthPassword
+
+// SshAuthPassword holds password of the user on target endpoint
+type SshAuthPassword struct {
+	Password []byte
+}
+
+// NewSshAuthByPassword returns an instance which holds password of the user on target endpoint
+func NewSshAuthByPassword(password []byte) SshAuthPassword {
+	return SshAuthPassword{
+		Password: password,
+	}
+}
+
+// Redacted returns a copy with password replaced, safe for logging
+func (a SshAuthPassword) Redacted() interface{} {
+	if len(a.Password) > 0 {
+		a.Password = []byte(logtypes.REDACTED_VALUE)
+	}
+	return a
+}
+
+func (a SshAuthPassword) writeFingerprint(w io.Writer) {
+	writeFingerprintFields(w, []byte("password"), a.Password)
+}
+
+// === SshAuthAgent
+
+// SshAuthAgent authenticates using the keys, including certificates, held by ssh-agent
+type SshAuthAgent struct {
+	SocketPath string // unix socket of the agent, empty = value of SSH_AUTH_SOCK environment variable
+}
+
+// NewSshAuthByAgent returns an instance which authenticates using keys held by ssh-agent listening on the socket,
+// empty socket path means the one from SSH_AUTH_SOCK environment variable
+func NewSshAuthByAgent(socketPath string) SshAuthAgent {
+	return SshAuthAgent{
+		SocketPath: socketPath,
+	}
+}
+
+// Redacted returns itself since it holds no secret
+func (a SshAuthAgent) Redacted() interface{} {
+	return a
+}
+
+func (a SshAuthAgent) writeFingerprint(w io.Writer) {
+	socketPath := a.SocketPath
+	if len(socketPath) < 1 {
+		socketPath = os.Getenv("SSH_AUTH_SOCK")
+	}
+	writeFingerprintFields(w, []byte("agent"), []byte(socketPath))
+}
+
+// === SshAuthKeyboardInteractive
+
+// SshAuthKeyboardInteractive authenticates by answering the questions asked by target endpoint, eg: password and OTP
+type SshAuthKeyboardInteractive struct {
+	// Challenge returns answers for the questions, echos indicate if the answers can be displayed.
+	// It can be called multiple times, and with no question.
+	Challenge func(name, instruction string, questions []string, echos []bool) (answers []string, err error)
+
+	id       uint64 // identifies the challenge function, assigned by the constructor
+	password []byte // the answer of every question, if created by NewSshAuthByKeyboardInteractivePassword
+}
+
+// lastSshAuthKeyboardInteractiveId is the id of the latest SshAuthKeyboardInteractive created by the constructor
+var lastSshAuthKeyboardInteractiveId uint64
+
+// NewSshAuthByKeyboardInteractive returns an instance which answers questions asked by target endpoint using the challenge function
+func NewSshAuthByKeyboardInteractive(challenge func(name, instruction string, questions []string, echos []bool) (answers []string, err error)) SshAuthKeyboardInteractive {
+	return SshAuthKeyboardInteractive{
+		Challenge: challenge,
+		id:        atomic.AddUint64(&lastSshAuthKeyboardInteractiveId, 1),
+	}
+}
+
+// NewSshAuthByKeyboardInteractivePassword returns an instance which answers every question with the password,
+// for servers which only accept password via keyboard-interactive, eg: PAM
+func NewSshAuthByKeyboardInteractivePassword(password []byte) SshAuthKeyboardInteractive {
+	auth := NewSshAuthByKeyboardInteractive(func(_, _ string, questions []string, _ []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i := range questions {
+			answers[i] = string(password)
+		}
+		return answers, nil
+	})
+	auth.password = password
+	return auth
+}
+
+// Redacted returns a copy with password removed, other secrets are kept inside the challenge function
+func (a SshAuthKeyboardInteractive) Redacted() interface{} {
+	a.password = nil
+	return a
+}
+
+func (a SshAuthKeyboardInteractive) writeFingerprint(w io.Writer) {
+	if a.password != nil {
+		writeFingerprintFields(w, []byte("keyboard-interactive-password"), a.password)
+		return
+	}
+
+	id := make([]byte, 8)
+	if a.id > 0 {
+		binary.BigEndian.PutUint64(id, a.id)
+	} else {
+		// not created by the constructor, can not be identified
+		_, _ = rand.Read(id)
+		id = append([]byte("random"), id...)
+	}
+	writeFingerprintFields(w, []byte("keyboard-interactive"), id)
+}
+
+// === SshHostKeyPolicy
+
+// SshHostKeyPolicyType is the way which host key of the remote server is verified
+type SshHostKeyPolicyType string
+
+//goland:noinspection SpellCheckingInspection
+const (
+	SshHostKeyPolicyKnownHosts      SshHostKeyPolicyType = "known_hosts"        // trust keys listed in known_hosts files
+	SshHostKeyPolicyPinned          SshHostKeyPolicyType = "pinned"             // trust keys matching the SHA256 fingerprints
+	SshHostKeyPolicyTrustOnFirstUse SshHostKeyPolicyType = "trust_on_first_use" // trust and persist the key seen at the first connection
+	SshHostKeyPolicyInsecure        SshHostKeyPolicyType = "insecure"           // trust any key, vulnerable to man-in-the-middle attack
+)
+
+// SshHostKeyPolicy holds information to verify host key of the remote server
+type SshHostKeyPolicy struct {
+	Type            SshHostKeyPolicyType
+	KnownHostsFiles []string // for known_hosts policy, empty = ~/.ssh/known_hosts
+	Fingerprints    []string // for pinned policy, format SHA256:<43 base64 characters>, as printed by `ssh-keygen -l`
+	TrustStoreFile  string   // for trust-on-first-use policy, file in known_hosts format which first-seen keys are persisted into
+}
+
+// NewSshHostKeyPolicyKnownHosts returns a policy which trusts keys listed in the known_hosts files, default ~/.ssh/known_hosts
+func NewSshHostKeyPolicyKnownHosts(knownHostsFiles ...string) SshHostKeyPolicy {
+	return SshHostKeyPolicy{
+		Type:            SshHostKeyPolicyKnownHosts,
+		KnownHostsFiles: knownHostsFiles,
+	}
+}
+
+// NewSshHostKeyPolicyPinned returns a policy which trusts keys matching any of the SHA256 fingerprints,
+// in format of `ssh-keygen -l` output, `SHA256:` prefix and `=` padding are optional.
+// Fingerprints of invalid format are rejected when connecting.
+func NewSshHostKeyPolicyPinned(fingerprints ...string) SshHostKeyPolicy {
+	return SshHostKeyPolicy{
+		Type:         SshHostKeyPolicyPinned,
+		Fingerprints: fingerprints,
+	}
+}
+
+// NewSshHostKeyPolicyTrustOnFirstUse returns a policy which trusts the key seen at the first connection to a host
+// and persists it into the store file, later connections must present the same key
+func NewSshHostKeyPolicyTrustOnFirstUse(trustStoreFile string) SshHostKeyPolicy {
+	return SshHostKeyPolicy{
+		Type:           SshHostKeyPolicyTrustOnFirstUse,
+		TrustStoreFile: trustStoreFile,
+	}
+}
+
+// NewSshHostKeyPolicyInsecure returns a policy which trusts any key, should only be used for testing purpose
+func NewSshHostKeyPolicyInsecure() SshHostKeyPolicy {
+	return SshHostKeyPolicy{
+		Type: SshHostKeyPolicyInsecure,
+	}
+}
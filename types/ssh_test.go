@@ -1,6 +1,7 @@
 package types
 
 import (
+	logtypes "github.com/EscanBE/go-lib/logging/types"
 	"reflect"
 	"testing"
 )
@@ -271,3 +272,246 @@ func TestSshRemote_WithAuthByPrivateKey(t *testing.T) {
 		t.Errorf("WithAuthByPrivateKey not working as expected")
 	}
 }
+
+func TestSshAuthPrivateKey_Redacted(t *testing.T) {
+	auth := NewSshAuthByPrivateKey([]byte{1, 2, 3}, []byte{4, 5, 6})
+	want := SshAuthPrivateKey{
+		PrivateKey: []byte(logtypes.REDACTED_VALUE),
+		Passphrase: []byte(logtypes.REDACTED_VALUE),
+	}
+	if got := auth.Redacted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Redacted() = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(auth.PrivateKey, []byte{1, 2, 3}) {
+		t.Errorf("Redacted() must not modify the original")
+	}
+
+	noPassphrase := NewSshAuthByPrivateKey([]byte{1, 2, 3}, nil).Redacted().(SshAuthPrivateKey)
+	if noPassphrase.Passphrase != nil {
+		t.Errorf("Redacted() should keep empty passphrase as is")
+	}
+}
+
+func TestSshRemote_Redacted(t *testing.T) {
+	sr := &SshRemote{
+		Host:     "x",
+		Port:     "22",
+		Username: "z",
+	}
+	if got := sr.Redacted(); !reflect.DeepEqual(got, *sr) {
+		t.Errorf("Redacted() = %v, want %v", got, *sr)
+	}
+
+	sr.WithAuthByPrivateKey(NewSshAuthByPrivateKey([]byte{1, 2, 3}, nil))
+	redacted := sr.Redacted().(SshRemote)
+	if string(redacted.AuthByPrivateKey.PrivateKey) != logtypes.REDACTED_VALUE {
+		t.Errorf("Redacted() must redact private key")
+	}
+	if !reflect.DeepEqual(sr.AuthByPrivateKey.PrivateKey, []byte{1, 2, 3}) {
+		t.Errorf("Redacted() must not modify the original")
+	}
+}
+
+func TestSshRemote_Redacted_AuthMethods(t *testing.T) {
+	sr := &SshRemote{
+		Host:     "x",
+		Port:     "22",
+		Username: "z",
+	}
+	sr.WithAuth(NewSshAuthByPassword([]byte{1, 2, 3}), NewSshAuthByAgent("/tmp/agent.sock"))
+
+	redacted := sr.Redacted().(SshRemote)
+	if got := string(redacted.AuthMethods[0].(SshAuthPassword).Password); got != logtypes.REDACTED_VALUE {
+		t.Errorf("Redacted() must redact password, got %s", got)
+	}
+	if got := redacted.AuthMethods[1].(SshAuthAgent).SocketPath; got != "/tmp/agent.sock" {
+		t.Errorf("Redacted() must keep socket path, got %s", got)
+	}
+	if !reflect.DeepEqual(sr.AuthMethods[0].(SshAuthPassword).Password, []byte{1, 2, 3}) {
+		t.Errorf("Redacted() must not modify the original")
+	}
+}
+
+func TestNewSshRemoteEndpoint_AuthMethods(t *testing.T) {
+	password := NewSshAuthByPassword([]byte("p"))
+	agent := NewSshAuthByAgent("")
+	tests := []struct {
+		name     string
+		authType interface{}
+		want     []SshAuth
+		wantErr  bool
+	}{
+		{
+			name:     "password",
+			authType: password,
+			want:     []SshAuth{password},
+		},
+		{
+			name:     "agent",
+			authType: agent,
+			want:     []SshAuth{agent},
+		},
+		{
+			name:     "ordered list",
+			authType: []SshAuth{agent, password},
+			want:     []SshAuth{agent, password},
+		},
+		{
+			name:     "empty list",
+			authType: []SshAuth{},
+			wantErr:  true,
+		},
+		{
+			name:     "pointer in list",
+			authType: []SshAuth{&password},
+			wantErr:  true,
+		},
+		{
+			name:     "pointer",
+			authType: &password,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSshRemoteEndpoint("x", "22", "z", tt.authType)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSshRemoteEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got.AuthMethods, tt.want) {
+				t.Errorf("NewSshRemoteEndpoint() AuthMethods = %v, want %v", got.AuthMethods, tt.want)
+			}
+		})
+	}
+}
+
+func TestSshRemote_GetAuthMethods(t *testing.T) {
+	sr := &SshRemote{}
+	if got := sr.GetAuthMethods(); len(got) != 0 {
+		t.Errorf("GetAuthMethods() = %v, want empty", got)
+	}
+
+	password := NewSshAuthByPassword([]byte("p"))
+	privateKey := NewSshAuthByCertificate([]byte{1}, nil, []byte{2})
+	sr.WithAuth(password)
+	sr.WithAuthByPrivateKey(privateKey)
+	if got, want := sr.GetAuthMethods(), []SshAuth{privateKey, password}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAuthMethods() = %v, want %v, private key must be the first", got, want)
+	}
+}
+
+func TestSshRemote_AuthFingerprint(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+
+	fingerprint := func(auths ...SshAuth) string {
+		return (&SshRemote{AuthMethods: auths}).AuthFingerprint()
+	}
+	challenge := func(string, string, []string, []bool) ([]string, error) {
+		return nil, nil
+	}
+	customChallenge := NewSshAuthByKeyboardInteractive(challenge)
+	password := NewSshAuthByPassword([]byte("p"))
+	privateKey := NewSshAuthByPrivateKey([]byte("key"), []byte("passphrase"))
+
+	same := []struct {
+		name string
+		a, b string
+	}{
+		{name: "same password", a: fingerprint(password), b: fingerprint(NewSshAuthByPassword([]byte("p")))},
+		{name: "same private key", a: (&SshRemote{AuthByPrivateKey: &privateKey}).AuthFingerprint(), b: fingerprint(privateKey)},
+		{name: "agent of SSH_AUTH_SOCK", a: fingerprint(NewSshAuthByAgent("")), b: fingerprint(NewSshAuthByAgent("/tmp/agent.sock"))},
+		{name: "keyboard-interactive of same password", a: fingerprint(NewSshAuthByKeyboardInteractivePassword([]byte("p"))), b: fingerprint(NewSshAuthByKeyboardInteractivePassword([]byte("p")))},
+		{name: "copy of keyboard-interactive", a: fingerprint(customChallenge), b: fingerprint(customChallenge)},
+	}
+	for _, tt := range same {
+		if tt.a != tt.b {
+			t.Errorf("AuthFingerprint() %s: %s != %s, want same", tt.name, tt.a, tt.b)
+		}
+	}
+
+	different := []struct {
+		name string
+		a, b string
+	}{
+		{name: "different password", a: fingerprint(password), b: fingerprint(NewSshAuthByPassword([]byte("q")))},
+		{name: "different passphrase", a: fingerprint(privateKey), b: fingerprint(NewSshAuthByPrivateKey([]byte("key"), []byte("other")))},
+		{name: "with certificate", a: fingerprint(privateKey), b: fingerprint(NewSshAuthByCertificate([]byte("key"), []byte("passphrase"), []byte("cert")))},
+		{name: "different agent", a: fingerprint(NewSshAuthByAgent("")), b: fingerprint(NewSshAuthByAgent("/tmp/other.sock"))},
+		{name: "order", a: fingerprint(password, privateKey), b: fingerprint(privateKey, password)},
+		{name: "none", a: fingerprint(), b: fingerprint(password)},
+		{name: "keyboard-interactive of different password", a: fingerprint(NewSshAuthByKeyboardInteractivePassword([]byte("p"))), b: fingerprint(NewSshAuthByKeyboardInteractivePassword([]byte("q")))},
+		{name: "keyboard-interactive of another instance", a: fingerprint(customChallenge), b: fingerprint(NewSshAuthByKeyboardInteractive(challenge))},
+		{name: "keyboard-interactive without constructor", a: fingerprint(SshAuthKeyboardInteractive{Challenge: challenge}), b: fingerprint(SshAuthKeyboardInteractive{Challenge: challenge})},
+		{name: "password is not keyboard-interactive", a: fingerprint(password), b: fingerprint(NewSshAuthByKeyboardInteractivePassword([]byte("p")))},
+	}
+	for _, tt := range different {
+		if tt.a == tt.b {
+			t.Errorf("AuthFingerprint() %s: %s, want different", tt.name, tt.a)
+		}
+	}
+}
+
+func TestNewSshAuthByKeyboardInteractivePassword(t *testing.T) {
+	auth := NewSshAuthByKeyboardInteractivePassword([]byte("p"))
+	answers, err := auth.Challenge("", "", []string{"Password: ", "Again: "}, []bool{false, false})
+	if err != nil || !reflect.DeepEqual(answers, []string{"p", "p"}) {
+		t.Errorf("Challenge() = %v, %v, want every question answered with the password", answers, err)
+	}
+	if answers, _ = auth.Challenge("", "", nil, nil); len(answers) != 0 {
+		t.Errorf("Challenge() = %v, want no answer for no question", answers)
+	}
+	if redacted := auth.Redacted().(SshAuthKeyboardInteractive); redacted.password != nil {
+		t.Errorf("Redacted() password = %s, want removed", redacted.password)
+	}
+}
+
+func TestNewSshHostKeyPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		got  SshHostKeyPolicy
+		want SshHostKeyPolicy
+	}{
+		{
+			name: "known_hosts",
+			got:  NewSshHostKeyPolicyKnownHosts("a", "b"),
+			want: SshHostKeyPolicy{Type: SshHostKeyPolicyKnownHosts, KnownHostsFiles: []string{"a", "b"}},
+		},
+		{
+			name: "known_hosts default",
+			got:  NewSshHostKeyPolicyKnownHosts(),
+			want: SshHostKeyPolicy{Type: SshHostKeyPolicyKnownHosts},
+		},
+		{
+			name: "pinned",
+			got:  NewSshHostKeyPolicyPinned("SHA256:a"),
+			want: SshHostKeyPolicy{Type: SshHostKeyPolicyPinned, Fingerprints: []string{"SHA256:a"}},
+		},
+		{
+			name: "trust on first use",
+			got:  NewSshHostKeyPolicyTrustOnFirstUse("store"),
+			want: SshHostKeyPolicy{Type: SshHostKeyPolicyTrustOnFirstUse, TrustStoreFile: "store"},
+		},
+		{
+			name: "insecure",
+			got:  NewSshHostKeyPolicyInsecure(),
+			want: SshHostKeyPolicy{Type: SshHostKeyPolicyInsecure},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("got = %v, want %v", tt.got, tt.want)
+			}
+
+			sr := &SshRemote{}
+			sr.WithHostKeyPolicy(tt.got)
+			if sr.HostKeyPolicy == nil || !reflect.DeepEqual(*sr.HostKeyPolicy, tt.want) {
+				t.Errorf("WithHostKeyPolicy() got = %v, want %v", sr.HostKeyPolicy, tt.want)
+			}
+		})
+	}
+}
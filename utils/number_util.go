@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"math/big"
+	"strconv"
 	"strings"
 )
 
@@ -92,3 +93,23 @@ func convertFromHexNumberStringToDecimalString(hexNumberStr string, bypassValida
 
 	return bi.String(), nil
 }
+
+// FormatBytesAutoUnit returns the number of bytes in the most readable binary unit among B, KiB, MiB, GiB and TiB,
+// with at most 2 decimals. Eg: 512B, 1.5KiB, 12.25MiB
+func FormatBytesAutoUnit(bytes uint64) string {
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	if bytes < 1024 {
+		return fmt.Sprintf("%dB", bytes)
+	}
+
+	value := float64(bytes) / 1024
+	unitIdx := 0
+	for unitIdx < len(units)-1 && value >= 1024-0.005 { // would be rounded to 1024 of the current unit
+		value /= 1024
+		unitIdx++
+	}
+
+	formatted := strconv.FormatFloat(value, 'f', 2, 64)
+	formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	return formatted + units[unitIdx]
+}
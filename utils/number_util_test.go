@@ -249,3 +249,24 @@ func TestConvertFromHexNumberStringToDecimalString(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatBytesAutoUnit(t *testing.T) {
+	tests := []struct {
+		bytes uint64
+		want  string
+	}{
+		{bytes: 0, want: "0B"},
+		{bytes: 1023, want: "1023B"},
+		{bytes: 1024, want: "1KiB"},
+		{bytes: 1536, want: "1.5KiB"},
+		{bytes: 1024*1024 - 1, want: "1MiB"},
+		{bytes: 12*1024*1024 + 256*1024, want: "12.25MiB"},
+		{bytes: 3 * 1024 * 1024 * 1024, want: "3GiB"},
+		{bytes: 2048 * 1024 * 1024 * 1024 * 1024, want: "2048TiB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			require.Equal(t, tt.want, FormatBytesAutoUnit(tt.bytes))
+		})
+	}
+}
@@ -0,0 +1,510 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultProfileAggregatorWindow is the rolling window used when no window was provided
+	DefaultProfileAggregatorWindow = time.Hour
+
+	// DefaultProfileAggregatorSlots is the number of slots the window is divided into when no number was provided,
+	// statistics of the oldest slot are dropped at once when it goes out of the window
+	DefaultProfileAggregatorSlots = 60
+
+	// maxAggregatedPaths is the maximum number of paths which have their own statistics,
+	// records of new paths beyond it are dropped, so a flood of unique descriptions can not exhaust memory
+	maxAggregatedPaths = 10_000
+
+	// histogramGamma is the ratio between upper bounds of two consecutive histogram buckets,
+	// percentiles are estimated with relative error not greater than (gamma-1)/(gamma+1), about 2.5%
+	histogramGamma = 1.05
+)
+
+var (
+	_ http.Handler = &profileMetricsHandler{}
+)
+
+// metricNamespaceRegex is the pattern of a valid Prometheus metric name prefix
+var metricNamespaceRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// ProfileAggregator keeps rolling statistics of execution time of finalized Profiler trees, per path of descriptions from the root.
+// Descriptions should not contain dynamic content like block number, otherwise every execution would have its own path.
+// It is safe for concurrent use.
+type ProfileAggregator struct {
+	mu           sync.Mutex
+	window       time.Duration
+	slotDuration time.Duration
+	slots        int
+	now          func() time.Time
+	paths        map[string]*aggregatedPath
+	droppedPaths uint64 // number of records dropped because of maxAggregatedPaths
+}
+
+// aggregatedPath holds statistics of a path, rolling within the window and cumulative since the start
+type aggregatedPath struct {
+	path        []string
+	slots       []*aggregatedSlot // ring of slots, indexed by slot number modulo number of slots
+	totalCount  uint64
+	totalErrors uint64
+	totalSum    time.Duration
+}
+
+// aggregatedSlot holds statistics of records added within a slot of time
+type aggregatedSlot struct {
+	number    int64 // slot number since epoch, identifies the time range of the slot
+	count     uint64
+	errors    uint64
+	min       time.Duration
+	max       time.Duration
+	sum       time.Duration
+	histogram *durationHistogram
+}
+
+// ProfileAggregateReport is a snapshot of statistics of the ProfileAggregator
+type ProfileAggregateReport struct {
+	Window       time.Duration           `json:"window"`
+	DroppedPaths uint64                  `json:"dropped-paths,omitempty"`
+	Paths        []ProfileAggregateStats `json:"paths"`
+}
+
+// ProfileAggregateStats is statistics of a path, within the rolling window
+type ProfileAggregateStats struct {
+	Path   string        `json:"path"` // descriptions from the root, joined by " > "
+	Depth  int           `json:"depth"`
+	Count  uint64        `json:"count"`
+	Errors uint64        `json:"errors"`
+	Min    time.Duration `json:"min"` // durations are in nanoseconds
+	Max    time.Duration `json:"max"`
+	Mean   time.Duration `json:"mean"`
+	P50    time.Duration `json:"p50"` // estimated from histogram
+	P95    time.Duration `json:"p95"` // estimated from histogram
+	P99    time.Duration `json:"p99"` // estimated from histogram
+
+	segments []string // descriptions from the root
+}
+
+// NewProfileAggregator returns a ProfileAggregator which keeps statistics within the rolling window,
+// the window is divided into slots, so statistics move forward one slot at a time.
+// Zero window or slots mean DefaultProfileAggregatorWindow and DefaultProfileAggregatorSlots.
+func NewProfileAggregator(window time.Duration, slots int) (*ProfileAggregator, error) {
+	if window == 0 {
+		window = DefaultProfileAggregatorWindow
+	}
+	if slots == 0 {
+		slots = DefaultProfileAggregatorSlots
+	}
+	if window < 0 {
+		return nil, fmt.Errorf("invalid window %s", window)
+	}
+	if slots < 0 {
+		return nil, fmt.Errorf("invalid number of slots %d", slots)
+	}
+	slotDuration := window / time.Duration(slots)
+	if slotDuration < time.Millisecond {
+		return nil, fmt.Errorf("window %s is too small to be divided into %d slots", window, slots)
+	}
+
+	return &ProfileAggregator{
+		window:       window,
+		slotDuration: slotDuration,
+		slots:        slots,
+		now:          time.Now,
+		paths:        make(map[string]*aggregatedPath),
+	}, nil
+}
+
+// Add records execution time of every finalized record of the finalized profiler tree
+func (a *ProfileAggregator) Add(profiler *Profiler) error {
+	if profiler == nil {
+		return fmt.Errorf("profiler is required")
+	}
+	return a.AddReport(profiler.Report())
+}
+
+// AddReport records execution time of every finalized record of the report, the root record must be finalized.
+// Records which were not finalized, like abandoned children, are skipped.
+func (a *ProfileAggregator) AddReport(report *ProfileReport) error {
+	if report == nil {
+		return fmt.Errorf("report is required")
+	}
+	if !report.Finalized {
+		return fmt.Errorf("profiler must be finalized")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	slotNumber := a.slotNumber(a.now())
+	report.walk(nil, func(node *ProfileReport, path []string) {
+		if !node.Finalized {
+			return
+		}
+		aggregated := a.pathOf(path, slotNumber)
+		if aggregated == nil {
+			a.droppedPaths++
+			return
+		}
+		aggregated.add(slotNumber, node.Duration, node.Err)
+	})
+	return nil
+}
+
+// slotNumber returns number of the slot, since epoch, which the time belongs to
+func (a *ProfileAggregator) slotNumber(t time.Time) int64 {
+	return t.UnixNano() / int64(a.slotDuration)
+}
+
+// pathOf returns statistics of the path, creates one if not exists.
+// Returns nil if the number of paths reached the limit, must be called with lock held.
+func (a *ProfileAggregator) pathOf(path []string, slotNumber int64) *aggregatedPath {
+	key := strings.Join(path, profilePathSeparator)
+	if aggregated, found := a.paths[key]; found {
+		return aggregated
+	}
+
+	if len(a.paths) >= maxAggregatedPaths {
+		a.prunePaths(slotNumber)
+		if len(a.paths) >= maxAggregatedPaths {
+			return nil
+		}
+	}
+
+	aggregated := &aggregatedPath{
+		path:  append([]string{}, path...),
+		slots: make([]*aggregatedSlot, a.slots),
+	}
+	a.paths[key] = aggregated
+	return aggregated
+}
+
+// prunePaths removes the paths which have no record within the window, must be called with lock held
+func (a *ProfileAggregator) prunePaths(slotNumber int64) {
+	for key, aggregated := range a.paths {
+		if aggregated.merge(slotNumber).count < 1 {
+			delete(a.paths, key)
+		}
+	}
+}
+
+// add records an execution time into the slot
+func (p *aggregatedPath) add(slotNumber int64, duration time.Duration, err bool) {
+	index := int(slotNumber % int64(len(p.slots)))
+	slot := p.slots[index]
+	if slot == nil || slot.number != slotNumber {
+		slot = &aggregatedSlot{
+			number:    slotNumber,
+			histogram: newDurationHistogram(),
+		}
+		p.slots[index] = slot
+	}
+	slot.add(duration, err)
+
+	p.totalCount++
+	p.totalSum += duration
+	if err {
+		p.totalErrors++
+	}
+}
+
+// merge returns statistics of the slots within the window which ends at the provided slot
+func (p *aggregatedPath) merge(slotNumber int64) *aggregatedSlot {
+	merged := &aggregatedSlot{
+		number:    slotNumber,
+		histogram: newDurationHistogram(),
+	}
+	for _, slot := range p.slots {
+		if slot == nil || slot.number <= slotNumber-int64(len(p.slots)) || slot.number > slotNumber {
+			continue
+		}
+		if merged.count < 1 || slot.min < merged.min {
+			merged.min = slot.min
+		}
+		if merged.count < 1 || slot.max > merged.max {
+			merged.max = slot.max
+		}
+		merged.count += slot.count
+		merged.errors += slot.errors
+		merged.sum += slot.sum
+		merged.histogram.merge(slot.histogram)
+	}
+	return merged
+}
+
+// add records an execution time into the slot
+func (s *aggregatedSlot) add(duration time.Duration, err bool) {
+	if s.count < 1 || duration < s.min {
+		s.min = duration
+	}
+	if s.count < 1 || duration > s.max {
+		s.max = duration
+	}
+	s.count++
+	s.sum += duration
+	if err {
+		s.errors++
+	}
+	s.histogram.add(duration)
+}
+
+// percentile returns the estimated percentile, q in range [0, 1], kept within min and max
+func (s *aggregatedSlot) percentile(q float64) time.Duration {
+	if s.count < 1 {
+		return 0
+	}
+	estimated := s.histogram.quantile(q)
+	if estimated < s.min {
+		return s.min
+	}
+	if estimated > s.max {
+		return s.max
+	}
+	return estimated
+}
+
+// Report returns statistics of all paths within the rolling window, sorted by path
+func (a *ProfileAggregator) Report() *ProfileAggregateReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	slotNumber := a.slotNumber(a.now())
+	report := &ProfileAggregateReport{
+		Window:       a.window,
+		DroppedPaths: a.droppedPaths,
+		Paths:        make([]ProfileAggregateStats, 0, len(a.paths)),
+	}
+	for _, aggregated := range a.paths {
+		merged := aggregated.merge(slotNumber)
+		if merged.count < 1 {
+			continue
+		}
+		report.Paths = append(report.Paths, ProfileAggregateStats{
+			Path:   strings.Join(aggregated.path, profilePathSeparator),
+			Depth:  len(aggregated.path) - 1,
+			Count:  merged.count,
+			Errors: merged.errors,
+			Min:    merged.min,
+			Max:    merged.max,
+			Mean:   merged.sum / time.Duration(merged.count),
+			P50:    merged.percentile(0.5),
+			P95:    merged.percentile(0.95),
+			P99:    merged.percentile(0.99),
+
+			segments: aggregated.path,
+		})
+	}
+	sort.Slice(report.Paths, func(i, j int) bool {
+		return report.Paths[i].Path < report.Paths[j].Path
+	})
+	return report
+}
+
+// Stats returns statistics of the path within the rolling window, returns false if no record of the path within the window
+func (a *ProfileAggregator) Stats(path ...string) (ProfileAggregateStats, bool) {
+	key := strings.Join(path, profilePathSeparator)
+	for _, stats := range a.Report().Paths {
+		if stats.Path == key {
+			return stats, true
+		}
+	}
+	return ProfileAggregateStats{}, false
+}
+
+// Text renders the report as a table-like text, one path per line
+func (r *ProfileAggregateReport) Text() string {
+	if r == nil {
+		return ""
+	}
+
+	pathWidth := 30
+	for _, stats := range r.Paths {
+		if width := len([]rune(stats.Path)); width > pathWidth {
+			pathWidth = width
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Profile statistics within %s\n", r.Window))
+	sb.WriteString(fmt.Sprintf("%s %8s %8s %10s %10s %10s %10s %10s %10s\n",
+		padRight("path", pathWidth), "count", "errors", "min", "mean", "p50", "p95", "p99", "max",
+	))
+	for _, stats := range r.Paths {
+		sb.WriteString(fmt.Sprintf("%s %8d %8d %10s %10s %10s %10s %10s %10s\n",
+			padRight(stats.Path, pathWidth), stats.Count, stats.Errors,
+			FormatDurationAutoUnit(stats.Min), FormatDurationAutoUnit(stats.Mean),
+			FormatDurationAutoUnit(stats.P50), FormatDurationAutoUnit(stats.P95),
+			FormatDurationAutoUnit(stats.P99), FormatDurationAutoUnit(stats.Max),
+		))
+	}
+	if r.DroppedPaths > 0 {
+		sb.WriteString(fmt.Sprintf("%d records were dropped because of too many paths\n", r.DroppedPaths))
+	}
+	return sb.String()
+}
+
+// WriteMetrics writes the statistics in Prometheus text exposition format, metric names are prefixed by the namespace.
+// Duration is exported as a summary, with quantiles within the rolling window while sum and count are cumulative.
+func (a *ProfileAggregator) WriteMetrics(w io.Writer, namespace string) error {
+	if !metricNamespaceRegex.MatchString(namespace) {
+		return fmt.Errorf("invalid metric namespace %q", namespace)
+	}
+
+	a.mu.Lock()
+	slotNumber := a.slotNumber(a.now())
+	type pathMetrics struct {
+		path        string
+		merged      *aggregatedSlot
+		totalCount  uint64
+		totalErrors uint64
+		totalSum    time.Duration
+	}
+	metrics := make([]pathMetrics, 0, len(a.paths))
+	for key, aggregated := range a.paths {
+		metrics = append(metrics, pathMetrics{
+			path:        key,
+			merged:      aggregated.merge(slotNumber),
+			totalCount:  aggregated.totalCount,
+			totalErrors: aggregated.totalErrors,
+			totalSum:    aggregated.totalSum,
+		})
+	}
+	droppedPaths := a.droppedPaths
+	a.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].path < metrics[j].path
+	})
+
+	var sb strings.Builder
+	durationName := namespace + "_profile_duration_seconds"
+	sb.WriteString(fmt.Sprintf("# HELP %s Execution time of profiler records, quantiles within the last %s.\n", durationName, a.window))
+	sb.WriteString(fmt.Sprintf("# TYPE %s summary\n", durationName))
+	for _, m := range metrics {
+		label := fmt.Sprintf(`path="%s"`, escapeMetricLabelValue(m.path))
+		if m.merged.count > 0 {
+			for _, q := range []float64{0.5, 0.95, 0.99} {
+				sb.WriteString(fmt.Sprintf("%s{%s,quantile=\"%g\"} %g\n", durationName, label, q, m.merged.percentile(q).Seconds()))
+			}
+		}
+		sb.WriteString(fmt.Sprintf("%s_sum{%s} %g\n", durationName, label, m.totalSum.Seconds()))
+		sb.WriteString(fmt.Sprintf("%s_count{%s} %d\n", durationName, label, m.totalCount))
+	}
+
+	errorsName := namespace + "_profile_errors_total"
+	sb.WriteString(fmt.Sprintf("# HELP %s Number of profiler records finalized with error.\n", errorsName))
+	sb.WriteString(fmt.Sprintf("# TYPE %s counter\n", errorsName))
+	for _, m := range metrics {
+		sb.WriteString(fmt.Sprintf("%s{path=\"%s\"} %d\n", errorsName, escapeMetricLabelValue(m.path), m.totalErrors))
+	}
+
+	droppedName := namespace + "_profile_dropped_records_total"
+	sb.WriteString(fmt.Sprintf("# HELP %s Number of profiler records dropped because of too many paths.\n", droppedName))
+	sb.WriteString(fmt.Sprintf("# TYPE %s counter\n", droppedName))
+	sb.WriteString(fmt.Sprintf("%s %d\n", droppedName, droppedPaths))
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// MetricsHandler returns a http.Handler which serves the metrics in Prometheus text exposition format
+func (a *ProfileAggregator) MetricsHandler(namespace string) (http.Handler, error) {
+	if !metricNamespaceRegex.MatchString(namespace) {
+		return nil, fmt.Errorf("invalid metric namespace %q", namespace)
+	}
+	return &profileMetricsHandler{
+		aggregator: a,
+		namespace:  namespace,
+	}, nil
+}
+
+// profileMetricsHandler serves metrics of ProfileAggregator
+type profileMetricsHandler struct {
+	aggregator *ProfileAggregator
+	namespace  string
+}
+
+// ServeHTTP implements http.Handler
+func (h *profileMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = h.aggregator.WriteMetrics(w, h.namespace)
+}
+
+// escapeMetricLabelValue escapes backslash, double-quote and line feed of the label value
+func escapeMetricLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// durationHistogram counts durations into buckets which upper bounds grow exponentially by histogramGamma,
+// so percentiles can be estimated with a bounded relative error using a small amount of memory
+type durationHistogram struct {
+	zeroCount uint64         // durations which are zero or negative
+	buckets   map[int]uint64 // bucket i counts durations in range (gamma^(i-1), gamma^i]
+}
+
+// newDurationHistogram returns an empty histogram
+func newDurationHistogram() *durationHistogram {
+	return &durationHistogram{
+		buckets: make(map[int]uint64),
+	}
+}
+
+// add counts the duration
+func (h *durationHistogram) add(duration time.Duration) {
+	if duration <= 0 {
+		h.zeroCount++
+		return
+	}
+	h.buckets[int(math.Ceil(math.Log(float64(duration))/math.Log(histogramGamma)))]++
+}
+
+// merge adds counts of the other histogram into this histogram
+func (h *durationHistogram) merge(other *durationHistogram) {
+	h.zeroCount += other.zeroCount
+	for index, count := range other.buckets {
+		h.buckets[index] += count
+	}
+}
+
+// quantile returns the estimated duration at the quantile q, in range [0, 1]
+func (h *durationHistogram) quantile(q float64) time.Duration {
+	total := h.zeroCount
+	indexes := make([]int, 0, len(h.buckets))
+	for index, count := range h.buckets {
+		indexes = append(indexes, index)
+		total += count
+	}
+	if total < 1 {
+		return 0
+	}
+	sort.Ints(indexes)
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+	cumulative := h.zeroCount
+	if cumulative >= rank {
+		return 0
+	}
+	for _, index := range indexes {
+		cumulative += h.buckets[index]
+		if cumulative >= rank {
+			// the value which has the same relative error to both bounds of the bucket
+			return time.Duration(math.Round(2 * math.Pow(histogramGamma, float64(index)) / (histogramGamma + 1)))
+		}
+	}
+	return time.Duration(math.Round(math.Pow(histogramGamma, float64(indexes[len(indexes)-1]))))
+}
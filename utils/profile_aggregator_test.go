@@ -0,0 +1,286 @@
+package utils
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// newTestProfileAggregator returns an aggregator which uses the returned pointer as the current time
+func newTestProfileAggregator(t *testing.T, window time.Duration, slots int) (*ProfileAggregator, *time.Time) {
+	aggregator, err := NewProfileAggregator(window, slots)
+	require.NoError(t, err)
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	aggregator.now = func() time.Time {
+		return now
+	}
+	return aggregator, &now
+}
+
+// newTestProfileReport returns a finalized report of a root with a single child
+func newTestProfileReport(rootMs, childMs int64, childErr bool) *ProfileReport {
+	return &ProfileReport{
+		Desc:      "scan",
+		Duration:  time.Duration(rootMs) * time.Millisecond,
+		Finalized: true,
+		Children: []*ProfileReport{
+			{Desc: "fetch block", Level: 1, Duration: time.Duration(childMs) * time.Millisecond, Finalized: true, Err: childErr},
+		},
+	}
+}
+
+func TestNewProfileAggregator(t *testing.T) {
+	tests := []struct {
+		window      time.Duration
+		slots       int
+		wantWindow  time.Duration
+		wantSlots   int
+		wantErrPart string
+	}{
+		{window: 0, slots: 0, wantWindow: DefaultProfileAggregatorWindow, wantSlots: DefaultProfileAggregatorSlots},
+		{window: time.Minute, slots: 6, wantWindow: time.Minute, wantSlots: 6},
+		{window: -time.Minute, slots: 6, wantErrPart: "invalid window"},
+		{window: time.Minute, slots: -1, wantErrPart: "invalid number of slots"},
+		{window: time.Millisecond, slots: 2, wantErrPart: "too small"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.window, tt.slots), func(t *testing.T) {
+			aggregator, err := NewProfileAggregator(tt.window, tt.slots)
+			if len(tt.wantErrPart) > 0 {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantErrPart)
+				require.Nil(t, aggregator)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantWindow, aggregator.window)
+			require.Equal(t, tt.wantSlots, aggregator.slots)
+		})
+	}
+}
+
+func TestProfileAggregator_Add(t *testing.T) {
+	aggregator, _ := newTestProfileAggregator(t, time.Hour, 60)
+
+	require.Error(t, aggregator.Add(nil))
+	require.Error(t, aggregator.AddReport(nil))
+	require.Error(t, aggregator.Add(NewMasterProfiler("not finalized", "", true)))
+	require.Empty(t, aggregator.Report().Paths)
+
+	for i := int64(1); i <= 100; i++ {
+		require.NoError(t, aggregator.AddReport(newTestProfileReport(i+10, i, i%10 == 0)))
+	}
+
+	// abandoned child is skipped
+	report := newTestProfileReport(1, 1, false)
+	report.Children = append(report.Children, &ProfileReport{Desc: "abandoned", Level: 1, Duration: time.Millisecond})
+	require.NoError(t, aggregator.AddReport(report))
+	_, found := aggregator.Stats("scan", "abandoned")
+	require.False(t, found)
+
+	stats, found := aggregator.Stats("scan", "fetch block")
+	require.True(t, found)
+	require.Equal(t, "scan > fetch block", stats.Path)
+	require.Equal(t, 1, stats.Depth)
+	require.Equal(t, uint64(101), stats.Count)
+	require.Equal(t, uint64(10), stats.Errors)
+	require.Equal(t, time.Millisecond, stats.Min)
+	require.Equal(t, 100*time.Millisecond, stats.Max)
+	require.Equal(t, 5051*time.Millisecond/101, stats.Mean)
+	require.InEpsilon(t, float64(50*time.Millisecond), float64(stats.P50), 0.05)
+	require.InEpsilon(t, float64(95*time.Millisecond), float64(stats.P95), 0.05)
+	require.InEpsilon(t, float64(99*time.Millisecond), float64(stats.P99), 0.05)
+	require.LessOrEqual(t, stats.P99, stats.Max)
+
+	stats, found = aggregator.Stats("scan")
+	require.True(t, found)
+	require.Equal(t, 0, stats.Depth)
+	require.Equal(t, uint64(0), stats.Errors)
+	require.Equal(t, time.Millisecond, stats.Min)
+	require.Equal(t, 110*time.Millisecond, stats.Max)
+
+	t.Run("works with profiler", func(t *testing.T) {
+		aggregator, _ := newTestProfileAggregator(t, time.Hour, 60)
+		profiler := NewMasterProfiler("master", "", true)
+		profiler.NewChild("child").Finalize()
+		require.NoError(t, aggregator.Add(profiler.Finalize()))
+		require.Len(t, aggregator.Report().Paths, 2)
+	})
+}
+
+func TestProfileAggregator_RollingWindow(t *testing.T) {
+	aggregator, now := newTestProfileAggregator(t, time.Hour, 60)
+
+	require.NoError(t, aggregator.AddReport(newTestProfileReport(1000, 1000, false)))
+	*now = now.Add(30 * time.Minute)
+	require.NoError(t, aggregator.AddReport(newTestProfileReport(10, 10, true)))
+
+	stats, _ := aggregator.Stats("scan", "fetch block")
+	require.Equal(t, uint64(2), stats.Count)
+	require.Equal(t, time.Second, stats.Max)
+
+	// the first record went out of the window
+	*now = now.Add(31 * time.Minute)
+	stats, _ = aggregator.Stats("scan", "fetch block")
+	require.Equal(t, uint64(1), stats.Count)
+	require.Equal(t, uint64(1), stats.Errors)
+	require.Equal(t, 10*time.Millisecond, stats.Max)
+	require.Equal(t, 10*time.Millisecond, stats.P99, "kept within min and max")
+
+	// nothing within the window
+	*now = now.Add(time.Hour)
+	_, found := aggregator.Stats("scan", "fetch block")
+	require.False(t, found)
+	require.Empty(t, aggregator.Report().Paths)
+
+	// slot is reused after a full round
+	require.NoError(t, aggregator.AddReport(newTestProfileReport(5, 5, false)))
+	stats, _ = aggregator.Stats("scan", "fetch block")
+	require.Equal(t, uint64(1), stats.Count)
+	require.Equal(t, 5*time.Millisecond, stats.Min)
+
+	// cumulative totals are kept for metrics
+	var sb strings.Builder
+	require.NoError(t, aggregator.WriteMetrics(&sb, "app"))
+	require.Contains(t, sb.String(), `app_profile_duration_seconds_count{path="scan > fetch block"} 3`+"\n")
+	require.Contains(t, sb.String(), `app_profile_errors_total{path="scan > fetch block"} 1`+"\n")
+}
+
+func TestProfileAggregator_MaxPaths(t *testing.T) {
+	aggregator, now := newTestProfileAggregator(t, time.Hour, 60)
+
+	for i := 0; i < maxAggregatedPaths+5; i++ {
+		require.NoError(t, aggregator.AddReport(&ProfileReport{Desc: fmt.Sprintf("scan %d", i), Finalized: true}))
+	}
+	report := aggregator.Report()
+	require.Len(t, report.Paths, maxAggregatedPaths)
+	require.Equal(t, uint64(5), report.DroppedPaths)
+	require.Contains(t, report.Text(), "5 records were dropped")
+
+	// paths without record within the window are pruned to make room for new paths
+	*now = now.Add(2 * time.Hour)
+	require.NoError(t, aggregator.AddReport(&ProfileReport{Desc: "new", Finalized: true}))
+	report = aggregator.Report()
+	require.Len(t, report.Paths, 1)
+	require.Equal(t, "new", report.Paths[0].Path)
+}
+
+func TestProfileAggregator_Concurrent(t *testing.T) {
+	aggregator, err := NewProfileAggregator(0, 0)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				require.NoError(t, aggregator.AddReport(newTestProfileReport(int64(j), int64(i), false)))
+				_ = aggregator.Report()
+				_ = aggregator.WriteMetrics(&strings.Builder{}, "app")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats, _ := aggregator.Stats("scan", "fetch block")
+	require.Equal(t, uint64(800), stats.Count)
+}
+
+func TestProfileAggregateReport_Text(t *testing.T) {
+	require.Empty(t, (*ProfileAggregateReport)(nil).Text())
+
+	aggregator, _ := newTestProfileAggregator(t, time.Hour, 60)
+	longDesc := strings.Repeat("long description ", 3)
+	require.NoError(t, aggregator.AddReport(newTestProfileReport(20, 10, true)))
+	require.NoError(t, aggregator.AddReport(&ProfileReport{Desc: longDesc, Duration: 1500 * time.Microsecond, Finalized: true}))
+
+	lines := strings.Split(strings.TrimSuffix(aggregator.Report().Text(), "\n"), "\n")
+	require.Len(t, lines, 5)
+	require.Equal(t, "Profile statistics within 1h0m0s", lines[0])
+	require.True(t, strings.HasPrefix(lines[2], longDesc))
+	require.True(t, strings.HasPrefix(lines[4], "scan > fetch block "))
+	require.Contains(t, lines[4], "       1        1       10ms       10ms")
+	require.Contains(t, lines[2], "       1        0      1.5ms      1.5ms")
+
+	// columns are aligned
+	for _, line := range lines[2:] {
+		require.Equal(t, utf8.RuneCountInString(lines[1]), utf8.RuneCountInString(line), "misaligned line: %s", line)
+	}
+}
+
+func TestProfileAggregator_WriteMetrics(t *testing.T) {
+	aggregator, _ := newTestProfileAggregator(t, time.Hour, 60)
+	require.NoError(t, aggregator.AddReport(newTestProfileReport(2000, 1000, true)))
+	require.NoError(t, aggregator.AddReport(&ProfileReport{Desc: "with \"quote\"\\\n", Duration: 0, Finalized: true}))
+
+	require.Error(t, aggregator.WriteMetrics(&strings.Builder{}, ""))
+	require.Error(t, aggregator.WriteMetrics(&strings.Builder{}, "1app"))
+	require.Error(t, aggregator.WriteMetrics(&strings.Builder{}, "my-app"))
+
+	var sb strings.Builder
+	require.NoError(t, aggregator.WriteMetrics(&sb, "app"))
+	metrics := sb.String()
+
+	require.Contains(t, metrics, "# TYPE app_profile_duration_seconds summary\n")
+	require.Contains(t, metrics, `app_profile_duration_seconds{path="scan > fetch block",quantile="0.5"} 1`+"\n")
+	require.Contains(t, metrics, `app_profile_duration_seconds{path="scan > fetch block",quantile="0.99"} 1`+"\n")
+	require.Contains(t, metrics, `app_profile_duration_seconds_sum{path="scan > fetch block"} 1`+"\n")
+	require.Contains(t, metrics, `app_profile_duration_seconds_count{path="scan > fetch block"} 1`+"\n")
+	require.Contains(t, metrics, `app_profile_duration_seconds_sum{path="scan"} 2`+"\n")
+	require.Contains(t, metrics, `app_profile_duration_seconds{path="with \"quote\"\\\n",quantile="0.95"} 0`+"\n")
+	require.Contains(t, metrics, "# TYPE app_profile_errors_total counter\n")
+	require.Contains(t, metrics, `app_profile_errors_total{path="scan > fetch block"} 1`+"\n")
+	require.Contains(t, metrics, `app_profile_errors_total{path="scan"} 0`+"\n")
+	require.Contains(t, metrics, "app_profile_dropped_records_total 0\n")
+}
+
+func TestProfileAggregator_MetricsHandler(t *testing.T) {
+	aggregator, _ := newTestProfileAggregator(t, time.Hour, 60)
+	require.NoError(t, aggregator.AddReport(newTestProfileReport(2000, 1000, false)))
+
+	_, err := aggregator.MetricsHandler("invalid namespace")
+	require.Error(t, err)
+
+	handler, err := aggregator.MetricsHandler("app")
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.True(t, strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain"))
+	require.Contains(t, recorder.Body.String(), `app_profile_duration_seconds_count{path="scan"} 1`)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestDurationHistogram_Quantile(t *testing.T) {
+	histogram := newDurationHistogram()
+	require.Zero(t, histogram.quantile(0.5))
+
+	for i := 0; i < 10; i++ {
+		histogram.add(0)
+	}
+	require.Zero(t, histogram.quantile(0.99))
+
+	for i := 1; i <= 90; i++ {
+		histogram.add(time.Duration(i * 1000))
+	}
+	require.Zero(t, histogram.quantile(0.1))
+	require.InEpsilon(t, 1000, float64(histogram.quantile(0.11)), 0.03)
+	require.InEpsilon(t, 40000, float64(histogram.quantile(0.5)), 0.03)
+	require.InEpsilon(t, 90000, float64(histogram.quantile(1)), 0.03)
+
+	other := newDurationHistogram()
+	other.add(1_000_000)
+	histogram.merge(other)
+	require.InEpsilon(t, 1_000_000, float64(histogram.quantile(1)), 0.03)
+}
@@ -0,0 +1,352 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// chromeTrace is the JSON object format of Chrome Trace Event, which Perfetto and chrome://tracing can open
+type chromeTrace struct {
+	TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+	DisplayTimeUnit string             `json:"displayTimeUnit"`
+}
+
+// chromeTraceEvent is a complete event (ph = X) or a metadata event (ph = M) of Chrome Trace Event format
+type chromeTraceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   int64                  `json:"ts"`            // microseconds
+	Dur  *int64                 `json:"dur,omitempty"` // microseconds, complete events only
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// chromeTraceBuilder builds events of profiler trees, each tree is a process and concurrent children are placed on separated threads
+type chromeTraceBuilder struct {
+	events  []chromeTraceEvent
+	pid     int
+	nextTid int
+	args    func(node *ProfileReport, path []string) map[string]interface{}
+}
+
+// chromeTraceLane is a thread which children of a record are placed on, busy until the end of the last placed child
+type chromeTraceLane struct {
+	tid int
+	end time.Time
+}
+
+// WriteChromeTrace exports the profiler trees as Chrome Trace Event JSON, which Perfetto or chrome://tracing can open.
+// Each tree is a process, children which ran at the same time with their siblings are placed on separated threads.
+func WriteChromeTrace(w io.Writer, reports ...*ProfileReport) error {
+	builder := newChromeTraceBuilder(func(node *ProfileReport, path []string) map[string]interface{} {
+		args := map[string]interface{}{
+			"path": strings.Join(path, profilePathSeparator),
+			"err":  node.Err,
+		}
+		if !node.Finalized {
+			args["finalized"] = false
+		}
+		if node.Memory != nil {
+			args["alloc-bytes"] = node.Memory.AllocBytes
+			args["alloc-objects"] = node.Memory.AllocObjects
+			args["goroutines-start"] = node.Memory.GoroutinesStart
+			args["goroutines-end"] = node.Memory.GoroutinesEnd
+		}
+		return args
+	})
+	for _, report := range reports {
+		if report == nil {
+			return fmt.Errorf("report is required")
+		}
+		builder.addTree(report)
+	}
+	return builder.write(w)
+}
+
+// newChromeTraceBuilder returns a builder which uses the provided function to build arguments of the events
+func newChromeTraceBuilder(args func(node *ProfileReport, path []string) map[string]interface{}) *chromeTraceBuilder {
+	return &chromeTraceBuilder{
+		events: make([]chromeTraceEvent, 0),
+		args:   args,
+	}
+}
+
+// addTree adds events of the tree as a new process
+func (b *chromeTraceBuilder) addTree(root *ProfileReport) {
+	b.pid++
+	b.nextTid = 1
+	b.addMetadata("process_name", 0, root.Desc)
+	b.addMetadata("thread_name", 1, root.Desc)
+	b.addNode(root, 1, nil)
+}
+
+// addNode adds the complete event of the record on the thread, then its children
+func (b *chromeTraceBuilder) addNode(node *ProfileReport, tid int, path []string) {
+	path = append(path[:len(path):len(path)], node.Desc)
+	dur := node.Duration.Microseconds()
+	b.events = append(b.events, chromeTraceEvent{
+		Name: node.Desc,
+		Cat:  node.ConstDesc,
+		Ph:   "X",
+		Ts:   node.Start.UnixMicro(),
+		Dur:  &dur,
+		Pid:  b.pid,
+		Tid:  tid,
+		Args: b.args(node, path),
+	})
+
+	children := make([]*ProfileReport, len(node.Children))
+	copy(children, node.Children)
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].Start.Before(children[j].Start)
+	})
+
+	lanes := []*chromeTraceLane{{tid: tid, end: node.Start}}
+	for _, child := range children {
+		var lane *chromeTraceLane
+		for _, l := range lanes {
+			if !l.end.After(child.Start) {
+				lane = l
+				break
+			}
+		}
+		if lane == nil {
+			b.nextTid++
+			lane = &chromeTraceLane{tid: b.nextTid}
+			lanes = append(lanes, lane)
+			b.addMetadata("thread_name", lane.tid, fmt.Sprintf("%s #%d", node.Desc, len(lanes)))
+		}
+		lane.end = child.Start.Add(child.Duration)
+		b.addNode(child, lane.tid, path)
+	}
+}
+
+// addMetadata adds a metadata event which names the current process or a thread
+func (b *chromeTraceBuilder) addMetadata(name string, tid int, value string) {
+	b.events = append(b.events, chromeTraceEvent{
+		Name: name,
+		Ph:   "M",
+		Pid:  b.pid,
+		Tid:  tid,
+		Args: map[string]interface{}{
+			"name": value,
+		},
+	})
+}
+
+// write writes the trace as JSON
+func (b *chromeTraceBuilder) write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(chromeTrace{
+		TraceEvents:     b.events,
+		DisplayTimeUnit: "ms",
+	})
+}
+
+// WriteFoldedStacks exports the profiler trees as folded stacks, the input format of flamegraph tools.
+// Each line is the descriptions from the root joined by semicolon, followed by the self time in microseconds,
+// which is the execution time not covered by the children. Same stacks of multiple trees are merged.
+func WriteFoldedStacks(w io.Writer, reports ...*ProfileReport) error {
+	stacks := newFoldedStacks(int64(time.Microsecond))
+	for _, report := range reports {
+		if report == nil {
+			return fmt.Errorf("report is required")
+		}
+		report.walk(nil, func(node *ProfileReport, path []string) {
+			self := node.Duration
+			for _, child := range node.Children {
+				self -= child.Duration
+			}
+			stacks.add(path, int64(self))
+		})
+	}
+	return stacks.write(w)
+}
+
+// WriteFoldedAllocStacks exports the profiler trees as folded stacks weighted by the self allocated heap bytes,
+// which are the bytes allocated during the record but not during its children.
+// Only records captured with ProfilerOptions.CaptureMemory have value. Same stacks of multiple trees are merged.
+func WriteFoldedAllocStacks(w io.Writer, reports ...*ProfileReport) error {
+	stacks := newFoldedStacks(1)
+	for _, report := range reports {
+		if report == nil {
+			return fmt.Errorf("report is required")
+		}
+		report.walk(nil, func(node *ProfileReport, path []string) {
+			if node.Memory == nil {
+				return
+			}
+			self := int64(node.Memory.AllocBytes)
+			for _, child := range node.Children {
+				if child.Memory != nil {
+					self -= int64(child.Memory.AllocBytes)
+				}
+			}
+			stacks.add(path, self)
+		})
+	}
+	return stacks.write(w)
+}
+
+// foldedStacks accumulates self value by stack, keeping the order which the stacks were added
+type foldedStacks struct {
+	order   []string
+	values  map[string]int64
+	divisor int64 // values are divided by it when written, eg: time.Microsecond to write nanoseconds as microseconds
+}
+
+// newFoldedStacks returns an empty foldedStacks which writes the values divided by the divisor
+func newFoldedStacks(divisor int64) *foldedStacks {
+	return &foldedStacks{
+		values:  make(map[string]int64),
+		divisor: divisor,
+	}
+}
+
+// add accumulates the self value of the stack, negative self value of parallel children is counted as zero
+func (s *foldedStacks) add(path []string, self int64) {
+	frames := make([]string, len(path))
+	for i, desc := range path {
+		frames[i] = foldedFrameReplacer.Replace(desc)
+	}
+	stack := strings.Join(frames, ";")
+	if _, found := s.values[stack]; !found {
+		s.order = append(s.order, stack)
+		s.values[stack] = 0
+	}
+	if self > 0 {
+		s.values[stack] += self
+	}
+}
+
+// write writes the stacks which have self value of at least one after divided, one per line
+func (s *foldedStacks) write(w io.Writer) error {
+	var sb strings.Builder
+	for _, stack := range s.order {
+		if value := s.values[stack] / s.divisor; value > 0 {
+			sb.WriteString(fmt.Sprintf("%s %d\n", stack, value))
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// foldedFrameReplacer replaces characters which have special meaning in folded stacks
+var foldedFrameReplacer = strings.NewReplacer(";", ":", "\r", " ", "\n", " ")
+
+// WriteChromeTrace exports the statistics as Chrome Trace Event JSON, each path is an event lasting its mean execution time.
+// Since the timeline of the aggregated executions is not kept, children are laid one after another from the start of their parent,
+// children which do not fit into their parent are placed on separated threads.
+func (r *ProfileAggregateReport) WriteChromeTrace(w io.Writer) error {
+	if r == nil {
+		return fmt.Errorf("report is required")
+	}
+
+	roots, statsOf := r.tree()
+	builder := newChromeTraceBuilder(func(node *ProfileReport, path []string) map[string]interface{} {
+		stats := statsOf[node]
+		return map[string]interface{}{
+			"path":   stats.Path,
+			"count":  stats.Count,
+			"errors": stats.Errors,
+			"min":    FormatDurationAutoUnit(stats.Min),
+			"mean":   FormatDurationAutoUnit(stats.Mean),
+			"p50":    FormatDurationAutoUnit(stats.P50),
+			"p95":    FormatDurationAutoUnit(stats.P95),
+			"p99":    FormatDurationAutoUnit(stats.P99),
+			"max":    FormatDurationAutoUnit(stats.Max),
+		}
+	})
+	for _, root := range roots {
+		builder.addTree(root)
+	}
+	return builder.write(w)
+}
+
+// WriteFoldedStacks exports the statistics as folded stacks, the input format of flamegraph tools.
+// Value of each stack is the total self time in microseconds of the path within the window,
+// which is the total execution time not covered by the children.
+func (r *ProfileAggregateReport) WriteFoldedStacks(w io.Writer) error {
+	if r == nil {
+		return fmt.Errorf("report is required")
+	}
+
+	roots, statsOf := r.tree()
+	stacks := newFoldedStacks(int64(time.Microsecond))
+	for _, root := range roots {
+		root.walk(nil, func(node *ProfileReport, path []string) {
+			self := statsOf[node].total()
+			for _, child := range node.Children {
+				self -= statsOf[child].total()
+			}
+			stacks.add(path, int64(self))
+		})
+	}
+	return stacks.write(w)
+}
+
+// total returns the total execution time of the path within the window
+func (s ProfileAggregateStats) total() time.Duration {
+	return s.Mean * time.Duration(s.Count)
+}
+
+// tree builds records from the statistics, each lasts the mean execution time of its path.
+// Children are laid one after another from the start of their parent, restarting from the start of the parent when they overflow it.
+func (r *ProfileAggregateReport) tree() (roots []*ProfileReport, statsOf map[*ProfileReport]ProfileAggregateStats) {
+	statsOf = make(map[*ProfileReport]ProfileAggregateStats, len(r.Paths))
+	nodes := make(map[string]*ProfileReport, len(r.Paths))
+	nextStart := make(map[*ProfileReport]time.Time, len(r.Paths))
+
+	paths := make([]ProfileAggregateStats, len(r.Paths))
+	copy(paths, r.Paths)
+	sort.SliceStable(paths, func(i, j int) bool {
+		return paths[i].Depth < paths[j].Depth
+	})
+
+	rootsEnd := time.Unix(0, 0) // the timeline is synthetic, starts from epoch
+	for _, stats := range paths {
+		segments := stats.pathSegments()
+		node := &ProfileReport{
+			Desc:      segments[len(segments)-1],
+			Level:     len(segments) - 1,
+			Duration:  stats.Mean,
+			Finalized: true,
+			Err:       stats.Errors > 0,
+		}
+
+		parent := nodes[strings.Join(segments[:len(segments)-1], profilePathSeparator)]
+		if len(segments) < 2 || parent == nil {
+			if len(segments) > 1 {
+				node.Desc = stats.Path // parent was not reported, keep the full path
+			}
+			node.Start = rootsEnd
+			rootsEnd = rootsEnd.Add(node.Duration)
+			roots = append(roots, node)
+		} else {
+			node.Start = nextStart[parent]
+			if node.Start.Add(node.Duration).After(parent.Start.Add(parent.Duration)) {
+				node.Start = parent.Start
+			}
+			nextStart[parent] = node.Start.Add(node.Duration)
+			parent.Children = append(parent.Children, node)
+		}
+
+		nodes[stats.Path] = node
+		nextStart[node] = node.Start
+		statsOf[node] = stats
+	}
+	return roots, statsOf
+}
+
+// pathSegments returns the descriptions from the root
+func (s ProfileAggregateStats) pathSegments() []string {
+	if len(s.segments) > 0 {
+		return s.segments
+	}
+	return strings.Split(s.Path, profilePathSeparator)
+}
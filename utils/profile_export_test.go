@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeChromeTrace decodes the trace, returns complete events by name and thread names by pid/tid
+func decodeChromeTrace(t *testing.T, bz []byte) (events map[string]chromeTraceEvent, threadNames map[[2]int]string) {
+	var trace chromeTrace
+	require.NoError(t, json.Unmarshal(bz, &trace))
+	require.Equal(t, "ms", trace.DisplayTimeUnit)
+
+	events = make(map[string]chromeTraceEvent)
+	threadNames = make(map[[2]int]string)
+	for _, event := range trace.TraceEvents {
+		switch event.Ph {
+		case "X":
+			require.NotNil(t, event.Dur)
+			events[event.Name] = event
+		case "M":
+			if event.Name == "thread_name" {
+				threadNames[[2]int{event.Pid, event.Tid}] = event.Args["name"].(string)
+			}
+		default:
+			t.Fatalf("unexpected event phase %s", event.Ph)
+		}
+	}
+	return
+}
+
+func TestWriteChromeTrace(t *testing.T) {
+	require.Error(t, WriteChromeTrace(&strings.Builder{}, nil))
+
+	var sb strings.Builder
+	require.NoError(t, WriteChromeTrace(&sb, newTestProfilerTree().Report()))
+	events, threadNames := decodeChromeTrace(t, []byte(sb.String()))
+	require.Len(t, events, 5)
+
+	master := events["master"]
+	require.Equal(t, "job", master.Cat)
+	require.Equal(t, testProfilerTime(1000).UnixMicro(), master.Ts)
+	require.Equal(t, int64(400_000), *master.Dur)
+	require.Equal(t, 1, master.Pid)
+	require.Equal(t, 1, master.Tid)
+	require.Equal(t, "master", master.Args["path"])
+	require.Equal(t, false, master.Args["err"])
+	require.Equal(t, "master", threadNames[[2]int{1, 1}])
+
+	// sequential children stay on the thread of their parent
+	require.Equal(t, 1, events["step-1"].Tid)
+	require.Equal(t, 1, events["fan-out"].Tid)
+	require.Equal(t, testProfilerTime(1100).UnixMicro(), events["fan-out"].Ts)
+
+	// concurrent children are placed on separated threads
+	worker1, worker2 := events["worker-1"], events["worker-2"]
+	require.Equal(t, 1, worker1.Tid)
+	require.Equal(t, 2, worker2.Tid)
+	require.Equal(t, "fan-out #2", threadNames[[2]int{1, 2}])
+	require.Equal(t, "master > fan-out > worker-1", worker1.Args["path"])
+	require.Equal(t, true, worker1.Args["err"])
+	require.Equal(t, int64(150_000), *worker2.Dur)
+
+	t.Run("multiple trees are separated processes", func(t *testing.T) {
+		other := NewMasterProfiler("other", "", true)
+		other.NewChild("running child") // not finalized
+
+		var sb strings.Builder
+		require.NoError(t, WriteChromeTrace(&sb, newTestProfilerTree().Report(), other.Finalize().Report()))
+		events, threadNames := decodeChromeTrace(t, []byte(sb.String()))
+		require.Len(t, events, 7)
+		require.Equal(t, 2, events["other"].Pid)
+		require.Equal(t, 1, events["other"].Tid)
+		require.Equal(t, "other", threadNames[[2]int{2, 1}])
+		require.Equal(t, false, events["running child"].Args["finalized"])
+		require.NotContains(t, events["other"].Args, "finalized")
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		var sb strings.Builder
+		require.NoError(t, WriteChromeTrace(&sb))
+		require.Equal(t, `{"traceEvents":[],"displayTimeUnit":"ms"}`+"\n", sb.String())
+	})
+}
+
+func TestWriteFoldedStacks(t *testing.T) {
+	require.Error(t, WriteFoldedStacks(&strings.Builder{}, nil))
+
+	var sb strings.Builder
+	require.NoError(t, WriteFoldedStacks(&sb, newTestProfilerTree().Report()))
+	require.Equal(t, `master;step-1 100000
+master;fan-out;worker-1 300000
+master;fan-out;worker-2 150000
+`, sb.String())
+
+	// same stacks of multiple trees are merged
+	report := &ProfileReport{
+		Desc:     "master",
+		Duration: 500 * time.Millisecond,
+		Children: []*ProfileReport{
+			{Desc: "step;1\n", Duration: 50 * time.Millisecond},
+			{Desc: "step-1", Duration: 20*time.Millisecond + 500*time.Nanosecond},
+		},
+	}
+	sb.Reset()
+	require.NoError(t, WriteFoldedStacks(&sb, newTestProfilerTree().Report(), report))
+	require.Equal(t, `master 429999
+master;step-1 120000
+master;fan-out;worker-1 300000
+master;fan-out;worker-2 150000
+master;step:1  50000
+`, sb.String())
+}
+
+func TestProfileAggregateReport_Export(t *testing.T) {
+	aggregator, _ := newTestProfileAggregator(t, time.Hour, 60)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, aggregator.AddReport(&ProfileReport{
+			Desc:      "scan",
+			Duration:  100 * time.Millisecond,
+			Finalized: true,
+			Children: []*ProfileReport{
+				{Desc: "fetch", Level: 1, Duration: 60 * time.Millisecond, Finalized: true, Err: i == 0},
+				{Desc: "process", Level: 1, Duration: 70 * time.Millisecond, Finalized: true}, // ran in parallel with fetch
+			},
+		}))
+	}
+	report := aggregator.Report()
+
+	require.Error(t, (*ProfileAggregateReport)(nil).WriteFoldedStacks(&strings.Builder{}))
+	require.Error(t, (*ProfileAggregateReport)(nil).WriteChromeTrace(&strings.Builder{}))
+
+	var sb strings.Builder
+	require.NoError(t, report.WriteFoldedStacks(&sb))
+	require.Equal(t, "scan;fetch 120000\nscan;process 140000\n", sb.String())
+
+	sb.Reset()
+	require.NoError(t, report.WriteChromeTrace(&sb))
+	events, _ := decodeChromeTrace(t, []byte(sb.String()))
+	require.Len(t, events, 3)
+
+	scan := events["scan"]
+	require.Equal(t, int64(0), scan.Ts)
+	require.Equal(t, int64(100_000), *scan.Dur)
+	require.Equal(t, float64(2), scan.Args["count"])
+	require.Equal(t, "scan", scan.Args["path"])
+
+	fetch, process := events["fetch"], events["process"]
+	require.Equal(t, int64(0), fetch.Ts)
+	require.Equal(t, 1, fetch.Tid)
+	require.Equal(t, float64(1), fetch.Args["errors"])
+	require.Equal(t, "scan > fetch", fetch.Args["path"])
+	// does not fit after fetch, so restarts from the start of the parent on another thread
+	require.Equal(t, int64(0), process.Ts)
+	require.Equal(t, 2, process.Tid)
+
+	t.Run("report decoded from JSON", func(t *testing.T) {
+		bz, err := json.Marshal(report)
+		require.NoError(t, err)
+		var decoded ProfileAggregateReport
+		require.NoError(t, json.Unmarshal(bz, &decoded))
+
+		var sb strings.Builder
+		require.NoError(t, decoded.WriteFoldedStacks(&sb))
+		require.Equal(t, "scan;fetch 120000\nscan;process 140000\n", sb.String())
+	})
+
+	t.Run("orphan path keeps full path", func(t *testing.T) {
+		orphan := &ProfileAggregateReport{
+			Paths: []ProfileAggregateStats{{Path: "gone > child", Depth: 1, Count: 1, Mean: 5 * time.Millisecond}},
+		}
+		var sb strings.Builder
+		require.NoError(t, orphan.WriteFoldedStacks(&sb))
+		require.Equal(t, "gone > child 5000\n", sb.String())
+	})
+}
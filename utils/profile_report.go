@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/EscanBE/go-lib/logging"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// profilePathSeparator joins descriptions of the records from the root, to identify a record within the tree
+const profilePathSeparator = " > "
+
+// ProfileReport is a snapshot of a Profiler tree, the data model which the profile is rendered, logged and exported from
+type ProfileReport struct {
+	Desc              string               `json:"desc"`
+	ConstDesc         string               `json:"const-desc,omitempty"`
+	Level             int                  `json:"level"`
+	Start             time.Time            `json:"start"`
+	Duration          time.Duration        `json:"duration"` // nanoseconds, up to the time of the snapshot if not finalized
+	Finalized         bool                 `json:"finalized"`
+	Err               bool                 `json:"err"`
+	Parallel          bool                 `json:"parallel,omitempty"`            // ran at the same time with any of its siblings
+	ChildrenWallClock time.Duration        `json:"children-wall-clock,omitempty"` // from the first start to the last end of the children
+	ChildrenSum       time.Duration        `json:"children-sum,omitempty"`        // sum of execution time of the children
+	Memory            *ProfileMemoryReport `json:"memory,omitempty"`              // only when ProfilerOptions.CaptureMemory is enabled
+	Children          []*ProfileReport     `json:"children,omitempty"`
+}
+
+// Report returns a snapshot of the profiler tree, nil if the profiler is nil
+func (p *Profiler) Report() *ProfileReport {
+	if p == nil {
+		return nil
+	}
+	return p.report(false)
+}
+
+// report builds the report of the profiler and its children
+func (p *Profiler) report(parallel bool) *ProfileReport {
+	snapshot := p.snapshot()
+	report := &ProfileReport{
+		Desc:      p.desc,
+		ConstDesc: p.constDesc,
+		Level:     p.level,
+		Start:     p.start,
+		Duration:  snapshot.duration,
+		Finalized: snapshot.finalized,
+		Err:       snapshot.err,
+		Parallel:  parallel,
+	}
+	if p.captureMemory {
+		report.Memory = newProfileMemoryReport(p.startMemory, snapshot.endMemory)
+	}
+
+	if len(snapshot.children) < 1 {
+		return report
+	}
+
+	childSnapshots := make([]profilerSnapshot, len(snapshot.children))
+	for i, child := range snapshot.children {
+		childSnapshots[i] = child.snapshot()
+	}
+	report.ChildrenWallClock, report.ChildrenSum = childrenTimes(snapshot.children, childSnapshots)
+
+	parallelChildren := findParallelChildren(snapshot.children, childSnapshots)
+	report.Children = make([]*ProfileReport, len(snapshot.children))
+	for i, child := range snapshot.children {
+		report.Children[i] = child.report(parallelChildren[i])
+	}
+	return report
+}
+
+// MarshalJSON implements json.Marshaler, exports the profiler tree as JSON
+func (p *Profiler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Report())
+}
+
+// AnyError returns true if the record itself or any of its descendants has error
+func (r *ProfileReport) AnyError() bool {
+	if r == nil {
+		return false
+	}
+	return r.Err || r.anyChildError()
+}
+
+// anyChildError returns true if any of the descendants has error
+func (r *ProfileReport) anyChildError() bool {
+	for _, child := range r.Children {
+		if child.AnyError() {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls the function for the record and all of its descendants, depth-first, with the descriptions from the root
+func (r *ProfileReport) walk(path []string, fn func(node *ProfileReport, path []string)) {
+	path = append(path[:len(path):len(path)], r.Desc)
+	fn(r, path)
+	for _, child := range r.Children {
+		child.walk(path, fn)
+	}
+}
+
+// Text renders the report as a table-like text, one record per line, durations are in the most readable unit.
+// Columns are sized to fit the longest descriptions, so nothing is truncated or misaligned.
+func (r *ProfileReport) Text() string {
+	if r == nil {
+		return ""
+	}
+
+	constDescWidth := 8
+	descColumnWidth := 30 // including the indentation
+	r.walk(nil, func(node *ProfileReport, _ []string) {
+		if width := utf8.RuneCountInString(node.ConstDesc); width > constDescWidth {
+			constDescWidth = width
+		}
+		if width := node.Level*2 + utf8.RuneCountInString(node.Desc); width > descColumnWidth {
+			descColumnWidth = width
+		}
+	})
+
+	var sb strings.Builder
+	r.walk(nil, func(node *ProfileReport, _ []string) {
+		indent := node.Level * 2
+		sb.WriteString(strings.Repeat(" ", indent))
+		sb.WriteString(fmt.Sprintf("[L%2d] desc [%s][%s] err [%5t] duration [%9s] children [%2d]",
+			node.Level,
+			padLeft(node.ConstDesc, constDescWidth),
+			padRight(node.Desc, descColumnWidth-indent),
+			node.Err, FormatDurationAutoUnit(node.Duration), len(node.Children),
+		))
+		if node.Memory != nil {
+			sb.WriteString(fmt.Sprintf(" alloc [%9s][%7d objs] goroutines [%d > %d]",
+				FormatBytesAutoUnit(node.Memory.AllocBytes), node.Memory.AllocObjects,
+				node.Memory.GoroutinesStart, node.Memory.GoroutinesEnd,
+			))
+		}
+		if len(node.Children) > 0 {
+			sb.WriteString(fmt.Sprintf(" wall [%9s] sum [%9s]",
+				FormatDurationAutoUnit(node.ChildrenWallClock), FormatDurationAutoUnit(node.ChildrenSum),
+			))
+		}
+		if len(node.Children) > 1 {
+			sb.WriteString(fmt.Sprintf(" avg [%s]/child", FormatDurationAutoUnit(node.Duration/time.Duration(len(node.Children)))))
+		}
+		if node.Parallel {
+			sb.WriteString(" (parallel)")
+		}
+		sb.WriteString("\n")
+	})
+
+	if r.Level == 0 {
+		sb.WriteString(fmt.Sprintf("Finished [%s][%s] duration [%9s]",
+			padLeft(r.ConstDesc, constDescWidth),
+			padRight(r.Desc, descColumnWidth),
+			FormatDurationAutoUnit(r.Duration),
+		))
+		if r.Memory != nil {
+			sb.WriteString(fmt.Sprintf(" alloc [%9s]", FormatBytesAutoUnit(r.Memory.AllocBytes)))
+		}
+		if r.anyChildError() {
+			sb.WriteString(" with at least one ERR\n")
+		} else {
+			sb.WriteString(" gracefully\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// durationMs returns the duration in milliseconds, keeping the sub-millisecond precision
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// padLeft pads spaces to the left of the text, until it reaches the width in runes, never truncates
+func padLeft(text string, width int) string {
+	if missing := width - utf8.RuneCountInString(text); missing > 0 {
+		return strings.Repeat(" ", missing) + text
+	}
+	return text
+}
+
+// padRight pads spaces to the right of the text, until it reaches the width in runes, never truncates
+func padRight(text string, width int) string {
+	if missing := width - utf8.RuneCountInString(text); missing > 0 {
+		return text + strings.Repeat(" ", missing)
+	}
+	return text
+}
+
+// LogTree logs the whole profiler tree as a single entry, with the report as a nested field `profile`.
+// The entry is logged at level Error if any record has error, otherwise Info.
+func (p *Profiler) LogTree(logger logging.Logger) {
+	if p == nil || logger == nil {
+		return
+	}
+
+	report := p.Report()
+	keyVals := []interface{}{
+		"const-desc", report.ConstDesc,
+		"desc", report.Desc,
+		"duration-ms", durationMs(report.Duration),
+		"profile", report,
+	}
+	if report.AnyError() {
+		logger.Error("profiler finished with at least one error", keyVals...)
+	} else {
+		logger.Info("profiler finished", keyVals...)
+	}
+}
+
+// LogNodes logs each record of the profiler tree as a separated entry, identified by the path of descriptions from the root.
+// Records which have error are logged at level Error, otherwise Info.
+func (p *Profiler) LogNodes(logger logging.Logger) {
+	if p == nil || logger == nil {
+		return
+	}
+
+	p.Report().walk(nil, func(node *ProfileReport, path []string) {
+		keyVals := []interface{}{
+			"const-desc", node.ConstDesc,
+			"path", strings.Join(path, profilePathSeparator),
+			"depth", node.Level,
+			"duration-ms", durationMs(node.Duration),
+			"finalized", node.Finalized,
+			"err", node.Err,
+		}
+		if node.Parallel {
+			keyVals = append(keyVals, "parallel", true)
+		}
+		if node.Memory != nil {
+			keyVals = append(keyVals,
+				"alloc-bytes", node.Memory.AllocBytes,
+				"alloc-objects", node.Memory.AllocObjects,
+				"goroutines-start", node.Memory.GoroutinesStart,
+				"goroutines-end", node.Memory.GoroutinesEnd,
+			)
+		}
+		if len(node.Children) > 0 {
+			keyVals = append(keyVals,
+				"children", len(node.Children),
+				"children-wall-clock-ms", durationMs(node.ChildrenWallClock),
+				"children-sum-ms", durationMs(node.ChildrenSum),
+			)
+		}
+		if node.Err {
+			logger.Error("profiler record", keyVals...)
+		} else {
+			logger.Info("profiler record", keyVals...)
+		}
+	})
+}
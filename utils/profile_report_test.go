@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/EscanBE/go-lib/logging/logtest"
+	logtypes "github.com/EscanBE/go-lib/logging/types"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProfilerTime returns the time which is the provided milliseconds after a fixed point of time
+func testProfilerTime(ms int64) time.Time {
+	return time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(ms) * time.Millisecond)
+}
+
+// addFinalizedChild adds a finalized child with the provided start and end, in milliseconds since testProfilerTime(0)
+func addFinalizedChild(parent *Profiler, desc string, start, end int64) *Profiler {
+	child := parent.NewChild(desc)
+	child.start = testProfilerTime(start)
+	child.end = testProfilerTime(end)
+	child.duration = child.end.Sub(child.start)
+	child.finalized = true
+	return child
+}
+
+// newTestProfilerTree returns a finalized profiler tree: master > (step-1, fan-out > (worker-1 err, worker-2 in parallel))
+func newTestProfilerTree() *Profiler {
+	master := NewMasterProfiler("master", "job", true)
+	master.start = testProfilerTime(1000)
+	addFinalizedChild(master, "step-1", 1000, 1100)
+	fanOut := addFinalizedChild(master, "fan-out", 1100, 1400)
+	worker1 := addFinalizedChild(fanOut, "worker-1", 1100, 1400)
+	worker1.err = true
+	addFinalizedChild(fanOut, "worker-2", 1150, 1300)
+	master.end = testProfilerTime(1400)
+	master.duration = 400 * time.Millisecond
+	master.finalized = true
+	return master
+}
+
+func TestProfiler_Report(t *testing.T) {
+	require.Nil(t, (*Profiler)(nil).Report())
+
+	report := newTestProfilerTree().Report()
+	require.Equal(t, "master", report.Desc)
+	require.Equal(t, "job", report.ConstDesc)
+	require.Equal(t, testProfilerTime(1000), report.Start)
+	require.Equal(t, 400*time.Millisecond, report.Duration)
+	require.True(t, report.Finalized)
+	require.False(t, report.Err)
+	require.True(t, report.AnyError())
+	require.Equal(t, 400*time.Millisecond, report.ChildrenWallClock)
+	require.Equal(t, 400*time.Millisecond, report.ChildrenSum)
+	require.Len(t, report.Children, 2)
+
+	step1, fanOut := report.Children[0], report.Children[1]
+	require.False(t, step1.Parallel)
+	require.False(t, step1.AnyError())
+	require.Empty(t, step1.Children)
+	require.False(t, fanOut.Parallel)
+	require.Equal(t, 1, fanOut.Level)
+	require.Equal(t, 300*time.Millisecond, fanOut.ChildrenWallClock)
+	require.Equal(t, 450*time.Millisecond, fanOut.ChildrenSum)
+	require.True(t, fanOut.Children[0].Parallel)
+	require.True(t, fanOut.Children[0].Err)
+	require.True(t, fanOut.Children[1].Parallel)
+	require.Equal(t, "job", fanOut.Children[1].ConstDesc)
+
+	t.Run("not finalized", func(t *testing.T) {
+		profiler := NewMasterProfiler("running", "", true)
+		report := profiler.Report()
+		require.False(t, report.Finalized)
+		require.GreaterOrEqual(t, report.Duration, time.Duration(0))
+	})
+}
+
+func TestProfiler_MarshalJSON(t *testing.T) {
+	bz, err := json.Marshal((*Profiler)(nil))
+	require.NoError(t, err)
+	require.Equal(t, "null", string(bz))
+
+	bz, err = json.Marshal(newTestProfilerTree())
+	require.NoError(t, err)
+	require.Contains(t, string(bz), `"desc":"master","const-desc":"job","level":0,"start":"2023-01-01T00:00:01Z","duration":400000000`)
+
+	var decoded ProfileReport
+	require.NoError(t, json.Unmarshal(bz, &decoded))
+	require.Equal(t, newTestProfilerTree().Report(), &decoded)
+}
+
+func TestProfileReport_Text(t *testing.T) {
+	require.Empty(t, (*ProfileReport)(nil).Text())
+
+	master := newTestProfilerTree()
+	longDesc := strings.Repeat("long description ", 5)
+	addFinalizedChild(master, longDesc, 1400, 1400)
+	longConstDesc := "a very long constant description"
+	master.constDesc = longConstDesc
+
+	text := master.Report().Text()
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	require.Len(t, lines, 7)
+
+	require.Contains(t, text, longDesc, "must not truncate description")
+	require.Contains(t, lines[0], "[L 0] desc ["+longConstDesc+"][master ")
+	require.Contains(t, lines[4], "(parallel)")
+	require.Contains(t, lines[6], "with at least one ERR")
+
+	// columns after description are aligned
+	errColumn := strings.Index(lines[0], "] err [")
+	require.Positive(t, errColumn)
+	for _, line := range lines[1:6] {
+		require.Equal(t, errColumn, strings.Index(line, "] err ["), "misaligned line: %s", line)
+	}
+
+	t.Run("graceful", func(t *testing.T) {
+		text := NewMasterProfiler("desc", "", true).Finalize().Report().Text()
+		require.True(t, strings.HasSuffix(text, " gracefully\n"))
+	})
+}
+
+func TestProfiler_LogTree(t *testing.T) {
+	(*Profiler)(nil).LogTree(logtest.NewCapturingLogger()) // shouldn't panic
+	newTestProfilerTree().LogTree(nil)                     // shouldn't panic
+
+	logger := logtest.NewCapturingLogger()
+	profiler := newTestProfilerTree()
+	profiler.LogTree(logger)
+	entries := logger.Entries()
+	require.Len(t, entries, 1)
+	logger.ExpectErrorEntry(t, "profiler finished", "const-desc", "job", "desc", "master", "duration-ms", 400)
+	require.Equal(t, profiler.Report(), entries[0].Fields["profile"])
+
+	logger.Reset()
+	profiler = NewMasterProfiler("ok", "job", true).Finalize()
+	profiler.LogTree(logger)
+	logger.ExpectInfoEntry(t, "profiler finished", "desc", "ok")
+}
+
+func TestProfiler_LogNodes(t *testing.T) {
+	(*Profiler)(nil).LogNodes(logtest.NewCapturingLogger()) // shouldn't panic
+
+	logger := logtest.NewCapturingLogger()
+	newTestProfilerTree().LogNodes(logger)
+	require.Len(t, logger.Entries(), 5)
+
+	logger.ExpectInfoEntry(t, "profiler record", "path", "master", "depth", 0, "children", 2)
+	logger.ExpectInfoEntry(t, "profiler record", "path", "master > fan-out", "children-wall-clock-ms", 300, "children-sum-ms", 450)
+	logger.ExpectErrorEntry(t, "profiler record", "path", "master > fan-out > worker-1", "depth", 2, "parallel", true, "err", true)
+	logger.ExpectInfoEntry(t, "profiler record", "path", "master > fan-out > worker-2", "parallel", true)
+	require.Len(t, logger.FindEntries(logtypes.LOG_LEVEL_ERROR, ""), 1)
+
+	for _, entry := range logger.Entries() {
+		require.Falsef(t, entry.HasField("level", 0), "must not use reserved field name: %s", fmt.Sprint(entry))
+	}
+}
@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"fmt"
+	"github.com/EscanBE/go-lib/logging"
+	"strings"
+	"time"
+)
+
+var (
+	_ ProfileReportSink = &loggerProfileReportSink{}
+)
+
+// ProfileReportPolicy defines when a profiler tree should be reported, at least one trigger must be enabled
+type ProfileReportPolicy struct {
+	RootThreshold time.Duration            // report when execution time of the root exceeds it, 0 = disabled
+	Budgets       map[string]time.Duration // report when execution time of any record exceeds the budget of its description
+	OnError       bool                     // report when any record finalized with error
+}
+
+// ProfileAlertReasonKind is the kind of trigger which caused the profiler tree to be reported
+type ProfileAlertReasonKind string
+
+const (
+	ProfileAlertRootThreshold ProfileAlertReasonKind = "root-threshold"
+	ProfileAlertBudget        ProfileAlertReasonKind = "budget"
+	ProfileAlertError         ProfileAlertReasonKind = "error"
+)
+
+// ProfileAlertReason describes a trigger which caused the profiler tree to be reported
+type ProfileAlertReason struct {
+	Kind     ProfileAlertReasonKind
+	Path     string        // descriptions from the root of the record which triggered, joined by " > "
+	Duration time.Duration // execution time of the record
+	Limit    time.Duration // the exceeded threshold or budget, zero for error
+}
+
+// ProfileAlert is a profiler tree which triggered the ProfileReportPolicy
+type ProfileAlert struct {
+	Report      *ProfileReport
+	Reasons     []ProfileAlertReason
+	SlowestPath []*ProfileReport // from the root, following the slowest child at each level
+}
+
+// ProfileReportSink receives the profiler trees which triggered the ProfileReportPolicy
+type ProfileReportSink interface {
+	// ReportProfile delivers the alert, it should not modify the alert
+	ReportProfile(alert *ProfileAlert) error
+}
+
+// ProfileReporter evaluates finalized profiler trees against the policy and delivers the ones which triggered it to the sinks.
+// With it, profilers can be enabled always in production, only slow or failed executions are reported.
+type ProfileReporter struct {
+	policy ProfileReportPolicy
+	sinks  []ProfileReportSink
+}
+
+// NewProfileReporter returns a ProfileReporter which delivers the triggered profiler trees to all the sinks
+func NewProfileReporter(policy ProfileReportPolicy, sinks ...ProfileReportSink) (*ProfileReporter, error) {
+	if policy.RootThreshold < 0 {
+		return nil, fmt.Errorf("invalid root threshold %s", policy.RootThreshold)
+	}
+	for desc, budget := range policy.Budgets {
+		if budget <= 0 {
+			return nil, fmt.Errorf("invalid budget %s of %s", budget, desc)
+		}
+	}
+	if policy.RootThreshold == 0 && len(policy.Budgets) < 1 && !policy.OnError {
+		return nil, fmt.Errorf("at least one trigger must be enabled")
+	}
+	if len(sinks) < 1 {
+		return nil, fmt.Errorf("at least one sink is required")
+	}
+	for _, sink := range sinks {
+		if sink == nil {
+			return nil, fmt.Errorf("sink must not be nil")
+		}
+	}
+
+	budgets := make(map[string]time.Duration, len(policy.Budgets))
+	for desc, budget := range policy.Budgets {
+		budgets[desc] = budget
+	}
+	policy.Budgets = budgets
+
+	return &ProfileReporter{
+		policy: policy,
+		sinks:  sinks,
+	}, nil
+}
+
+// FinalizeAndReport finalizes the profiler then delivers it to the sinks if it triggered the policy.
+// Returns the alert if triggered, nil otherwise. Nil profiler is ignored.
+func (r *ProfileReporter) FinalizeAndReport(profiler *Profiler) (*ProfileAlert, error) {
+	if profiler == nil {
+		return nil, nil
+	}
+
+	alert := r.Evaluate(profiler.Finalize().Report())
+	if alert == nil {
+		return nil, nil
+	}
+
+	var failed []string
+	for _, sink := range r.sinks {
+		if err := sink.ReportProfile(alert); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return alert, fmt.Errorf("failed to report profile to %d/%d sinks: [%s]", len(failed), len(r.sinks), strings.Join(failed, ", "))
+	}
+	return alert, nil
+}
+
+// Evaluate returns the alert if the report triggered the policy, nil otherwise
+func (r *ProfileReporter) Evaluate(report *ProfileReport) *ProfileAlert {
+	if report == nil {
+		return nil
+	}
+
+	var reasons []ProfileAlertReason
+	if r.policy.RootThreshold > 0 && report.Duration > r.policy.RootThreshold {
+		reasons = append(reasons, ProfileAlertReason{
+			Kind:     ProfileAlertRootThreshold,
+			Path:     report.Desc,
+			Duration: report.Duration,
+			Limit:    r.policy.RootThreshold,
+		})
+	}
+	report.walk(nil, func(node *ProfileReport, path []string) {
+		if budget, found := r.policy.Budgets[node.Desc]; found && node.Duration > budget {
+			reasons = append(reasons, ProfileAlertReason{
+				Kind:     ProfileAlertBudget,
+				Path:     strings.Join(path, profilePathSeparator),
+				Duration: node.Duration,
+				Limit:    budget,
+			})
+		}
+		if r.policy.OnError && node.Err {
+			reasons = append(reasons, ProfileAlertReason{
+				Kind:     ProfileAlertError,
+				Path:     strings.Join(path, profilePathSeparator),
+				Duration: node.Duration,
+			})
+		}
+	})
+	if len(reasons) < 1 {
+		return nil
+	}
+
+	return &ProfileAlert{
+		Report:      report,
+		Reasons:     reasons,
+		SlowestPath: report.slowestPath(),
+	}
+}
+
+// slowestPath returns the records from the root, following the slowest child at each level
+func (r *ProfileReport) slowestPath() []*ProfileReport {
+	path := []*ProfileReport{r}
+	for node := r; len(node.Children) > 0; {
+		slowest := node.Children[0]
+		for _, child := range node.Children[1:] {
+			if child.Duration > slowest.Duration {
+				slowest = child
+			}
+		}
+		path = append(path, slowest)
+		node = slowest
+	}
+	return path
+}
+
+// String returns the reason in human-readable format
+func (r ProfileAlertReason) String() string {
+	switch r.Kind {
+	case ProfileAlertRootThreshold:
+		return fmt.Sprintf("%s took %s, exceeded threshold %s", r.Path, FormatDurationAutoUnit(r.Duration), FormatDurationAutoUnit(r.Limit))
+	case ProfileAlertBudget:
+		return fmt.Sprintf("%s took %s, exceeded budget %s", r.Path, FormatDurationAutoUnit(r.Duration), FormatDurationAutoUnit(r.Limit))
+	default:
+		return fmt.Sprintf("%s finalized with error", r.Path)
+	}
+}
+
+// AnyError returns true if any reason of the alert is an error
+func (a *ProfileAlert) AnyError() bool {
+	for _, reason := range a.Reasons {
+		if reason.Kind == ProfileAlertError {
+			return true
+		}
+	}
+	return false
+}
+
+// SlowestPathText returns descriptions of the slowest path joined by " > ", followed by execution time of the last record
+func (a *ProfileAlert) SlowestPathText() string {
+	if len(a.SlowestPath) < 1 {
+		return ""
+	}
+	descriptions := make([]string, len(a.SlowestPath))
+	for i, node := range a.SlowestPath {
+		descriptions[i] = node.Desc
+	}
+	last := a.SlowestPath[len(a.SlowestPath)-1]
+	return fmt.Sprintf("%s (%s)", strings.Join(descriptions, profilePathSeparator), FormatDurationAutoUnit(last.Duration))
+}
+
+// NewLoggerProfileReportSink returns a ProfileReportSink which logs the alerts as a single entry,
+// at level Error if triggered by an error, otherwise Info
+func NewLoggerProfileReportSink(logger logging.Logger) (ProfileReportSink, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger is required")
+	}
+	return &loggerProfileReportSink{
+		logger: logger,
+	}, nil
+}
+
+// loggerProfileReportSink implements ProfileReportSink, logs the alerts
+type loggerProfileReportSink struct {
+	logger logging.Logger
+}
+
+// ReportProfile implements ProfileReportSink
+func (s *loggerProfileReportSink) ReportProfile(alert *ProfileAlert) error {
+	if alert == nil {
+		return fmt.Errorf("alert is required")
+	}
+
+	reasons := make([]string, len(alert.Reasons))
+	for i, reason := range alert.Reasons {
+		reasons[i] = reason.String()
+	}
+	keyVals := []interface{}{
+		"const-desc", alert.Report.ConstDesc,
+		"desc", alert.Report.Desc,
+		"duration-ms", durationMs(alert.Report.Duration),
+		"reasons", reasons,
+		"slowest-path", alert.SlowestPathText(),
+		"profile", alert.Report,
+	}
+	if alert.AnyError() {
+		s.logger.Error("profiler alert", keyVals...)
+	} else {
+		s.logger.Info("profiler alert", keyVals...)
+	}
+	return nil
+}
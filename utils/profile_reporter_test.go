@@ -0,0 +1,259 @@
+package utils
+
+import (
+	"fmt"
+	"github.com/EscanBE/go-lib/logging/logtest"
+	"github.com/EscanBE/go-lib/test_utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// capturingProfileReportSink collects the alerts, returns the provided error
+type capturingProfileReportSink struct {
+	alerts []*ProfileAlert
+	err    error
+}
+
+// ReportProfile implements ProfileReportSink
+func (s *capturingProfileReportSink) ReportProfile(alert *ProfileAlert) error {
+	s.alerts = append(s.alerts, alert)
+	return s.err
+}
+
+func TestNewProfileReporter(t *testing.T) {
+	sink := &capturingProfileReportSink{}
+	tests := []struct {
+		name        string
+		policy      ProfileReportPolicy
+		sinks       []ProfileReportSink
+		wantErrPart string
+	}{
+		{
+			name:   "root threshold",
+			policy: ProfileReportPolicy{RootThreshold: time.Second},
+			sinks:  []ProfileReportSink{sink},
+		},
+		{
+			name:   "budgets",
+			policy: ProfileReportPolicy{Budgets: map[string]time.Duration{"fetch": time.Second}},
+			sinks:  []ProfileReportSink{sink},
+		},
+		{
+			name:   "on error, multiple sinks",
+			policy: ProfileReportPolicy{OnError: true},
+			sinks:  []ProfileReportSink{sink, sink},
+		},
+		{
+			name:        "no trigger",
+			policy:      ProfileReportPolicy{Budgets: map[string]time.Duration{}},
+			sinks:       []ProfileReportSink{sink},
+			wantErrPart: "at least one trigger must be enabled",
+		},
+		{
+			name:        "negative root threshold",
+			policy:      ProfileReportPolicy{RootThreshold: -time.Second, OnError: true},
+			sinks:       []ProfileReportSink{sink},
+			wantErrPart: "invalid root threshold",
+		},
+		{
+			name:        "zero budget",
+			policy:      ProfileReportPolicy{Budgets: map[string]time.Duration{"fetch": 0}},
+			sinks:       []ProfileReportSink{sink},
+			wantErrPart: "invalid budget 0s of fetch",
+		},
+		{
+			name:        "no sink",
+			policy:      ProfileReportPolicy{OnError: true},
+			wantErrPart: "at least one sink is required",
+		},
+		{
+			name:        "nil sink",
+			policy:      ProfileReportPolicy{OnError: true},
+			sinks:       []ProfileReportSink{sink, nil},
+			wantErrPart: "sink must not be nil",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reporter, err := NewProfileReporter(tt.policy, tt.sinks...)
+			test_utils.WantErrorContainsStringIfNonEmptyOtherWiseNoError(t, err, tt.wantErrPart)
+			if len(tt.wantErrPart) > 0 {
+				require.Nil(t, reporter)
+			} else {
+				require.NotNil(t, reporter)
+			}
+		})
+	}
+
+	t.Run("budgets are copied", func(t *testing.T) {
+		budgets := map[string]time.Duration{"fetch": time.Second}
+		reporter, err := NewProfileReporter(ProfileReportPolicy{Budgets: budgets}, sink)
+		require.NoError(t, err)
+		budgets["fetch"] = time.Nanosecond
+		require.Equal(t, time.Second, reporter.policy.Budgets["fetch"])
+	})
+}
+
+func TestProfileReporter_Evaluate(t *testing.T) {
+	newReport := func() *ProfileReport {
+		return &ProfileReport{
+			Desc:     "scan",
+			Duration: 3 * time.Second,
+			Children: []*ProfileReport{
+				{Desc: "fetch", Duration: 500 * time.Millisecond},
+				{
+					Desc:     "process",
+					Duration: 2500 * time.Millisecond,
+					Children: []*ProfileReport{
+						{Desc: "tx", Duration: 2 * time.Second, Parallel: true},
+						{Desc: "tx", Duration: 2400 * time.Millisecond, Parallel: true, Err: true},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		policy      ProfileReportPolicy
+		wantReasons []string
+	}{
+		{
+			name:   "nothing triggered",
+			policy: ProfileReportPolicy{RootThreshold: 3 * time.Second, Budgets: map[string]time.Duration{"fetch": time.Second, "tx": 3 * time.Second}},
+		},
+		{
+			name:        "root threshold",
+			policy:      ProfileReportPolicy{RootThreshold: 2 * time.Second},
+			wantReasons: []string{"scan took 3s, exceeded threshold 2s"},
+		},
+		{
+			name:   "budgets",
+			policy: ProfileReportPolicy{Budgets: map[string]time.Duration{"fetch": 400 * time.Millisecond, "tx": 2100 * time.Millisecond}},
+			wantReasons: []string{
+				"scan > fetch took 500ms, exceeded budget 400ms",
+				"scan > process > tx took 2.4s, exceeded budget 2.1s",
+			},
+		},
+		{
+			name:        "on error",
+			policy:      ProfileReportPolicy{OnError: true},
+			wantReasons: []string{"scan > process > tx finalized with error"},
+		},
+		{
+			name:   "all",
+			policy: ProfileReportPolicy{RootThreshold: time.Second, Budgets: map[string]time.Duration{"process": time.Second}, OnError: true},
+			wantReasons: []string{
+				"scan took 3s, exceeded threshold 1s",
+				"scan > process took 2.5s, exceeded budget 1s",
+				"scan > process > tx finalized with error",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reporter, err := NewProfileReporter(tt.policy, &capturingProfileReportSink{})
+			require.NoError(t, err)
+			require.Nil(t, reporter.Evaluate(nil))
+
+			report := newReport()
+			alert := reporter.Evaluate(report)
+			if len(tt.wantReasons) < 1 {
+				require.Nil(t, alert)
+				return
+			}
+
+			require.NotNil(t, alert)
+			require.Same(t, report, alert.Report)
+			var reasons []string
+			for _, reason := range alert.Reasons {
+				reasons = append(reasons, reason.String())
+			}
+			require.Equal(t, tt.wantReasons, reasons)
+
+			require.Len(t, alert.SlowestPath, 3)
+			require.Same(t, report.Children[1].Children[1], alert.SlowestPath[2])
+			require.Equal(t, "scan > process > tx (2.4s)", alert.SlowestPathText())
+		})
+	}
+}
+
+func TestProfileReporter_FinalizeAndReport(t *testing.T) {
+	sink1 := &capturingProfileReportSink{}
+	sink2 := &capturingProfileReportSink{}
+	reporter, err := NewProfileReporter(ProfileReportPolicy{RootThreshold: time.Second, OnError: true}, sink1, sink2)
+	require.NoError(t, err)
+
+	alert, err := reporter.FinalizeAndReport(nil)
+	require.NoError(t, err)
+	require.Nil(t, alert)
+
+	clock := newTestClock()
+
+	// fast and no error, not reported
+	profiler := NewMasterProfilerWithOptions("fast", "", true, ProfilerOptions{Clock: clock.Now})
+	profiler.NewChild("child").Finalize()
+	clock.Advance(time.Second)
+	alert, err = reporter.FinalizeAndReport(profiler)
+	require.NoError(t, err)
+	require.Nil(t, alert)
+	require.True(t, profiler.finalized)
+	require.Empty(t, sink1.alerts)
+
+	// slow
+	profiler = NewMasterProfilerWithOptions("slow", "", true, ProfilerOptions{Clock: clock.Now})
+	clock.Advance(time.Second + time.Nanosecond)
+	alert, err = reporter.FinalizeAndReport(profiler)
+	require.NoError(t, err)
+	require.NotNil(t, alert)
+	require.False(t, alert.AnyError())
+	require.Len(t, sink1.alerts, 1)
+	require.Len(t, sink2.alerts, 1)
+	require.Same(t, alert, sink1.alerts[0])
+
+	// error, with a failing sink
+	sink2.err = fmt.Errorf("fake")
+	profiler = NewMasterProfilerWithOptions("error", "", true, ProfilerOptions{Clock: clock.Now})
+	_ = profiler.NewChild("child").FinalizeWithErr(fmt.Errorf("err"))
+	alert, err = reporter.FinalizeAndReport(profiler)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to report profile to 1/2 sinks: [fake]")
+	require.NotNil(t, alert)
+	require.True(t, alert.AnyError())
+	require.Len(t, sink1.alerts, 2, "other sinks still receive the alert")
+}
+
+func TestLoggerProfileReportSink(t *testing.T) {
+	_, err := NewLoggerProfileReportSink(nil)
+	require.Error(t, err)
+
+	logger := logtest.NewCapturingLogger()
+	sink, err := NewLoggerProfileReportSink(logger)
+	require.NoError(t, err)
+	require.Error(t, sink.ReportProfile(nil))
+
+	report := &ProfileReport{
+		Desc:      "scan",
+		ConstDesc: "job",
+		Duration:  1500 * time.Microsecond,
+		Children:  []*ProfileReport{{Desc: "fetch", Duration: time.Millisecond}},
+	}
+	reporter, err := NewProfileReporter(ProfileReportPolicy{RootThreshold: time.Millisecond, OnError: true}, sink)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.ReportProfile(reporter.Evaluate(report)))
+	logger.ExpectInfoEntry(t, "profiler alert",
+		"const-desc", "job",
+		"desc", "scan",
+		"duration-ms", 1.5,
+		"reasons", []string{"scan took 1.5ms, exceeded threshold 1ms"},
+		"slowest-path", "scan > fetch (1ms)",
+		"profile", report,
+	)
+
+	logger.Reset()
+	report.Children[0].Err = true
+	require.NoError(t, sink.ReportProfile(reporter.Evaluate(report)))
+	logger.ExpectErrorEntry(t, "profiler alert", "desc", "scan")
+}
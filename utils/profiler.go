@@ -2,40 +2,80 @@ package utils
 
 import (
 	"fmt"
+	"sync"
 	"time"
 )
 
 // Profiler is used to record execution time and support ultimately depth of children methods.
 // This would help debugging performance right on the server without any tool.
-// Receivers of this are nil-safe (if pointer is nil, can still call without any problem)
+// Receivers of this are nil-safe (if pointer is nil, can still call without any problem).
+// It is safe for concurrent use, children can be created and finalized from multiple goroutines.
 type Profiler struct {
-	desc      string      // description, each profiler will have their own description
-	constDesc string      // constant description, will be kept and copied to children profilers constantly
-	start     int64       // epoch ms, immediately assigned = epoch when instance created
-	duration  int64       // total execution time in milliseconds
-	finalized bool        // finalized state, init <false>, will be changed to <true> when Finalize* methods get called
-	level     int         // level of child, master = 0, the first tier (children of master) = 1, the second tier (children of first tier) = 2
-	err       bool        // finalized with at least one error
-	children  []*Profiler // children of current instance
+	mu         sync.Mutex       // guards the mutable fields: end, duration, finalized, err, children and onFinalize
+	clock      func() time.Time // source of time, copied to children profilers
+	desc       string           // description, each profiler will have their own description
+	constDesc  string           // constant description, will be kept and copied to children profilers constantly
+	start      time.Time        // immediately assigned when instance created, carries the monotonic clock reading of time.Now
+	end        time.Time        // assigned when finalized
+	duration   time.Duration    // total execution time, measured by the monotonic clock, never negative
+	finalized  bool             // finalized state, init <false>, will be changed to <true> when Finalize* methods get called
+	level      int              // level of child, master = 0, the first tier (children of master) = 1, the second tier (children of first tier) = 2
+	err        bool             // finalized with at least one error
+	children   []*Profiler      // children of current instance
+	onFinalize func()           // called once when finalized, like restoring pprof labels of StartSpan
+
+	captureMemory bool         // capture memory samples, copied to children profilers
+	startMemory   memorySample // assigned when instance created, if captureMemory
+	endMemory     memorySample // assigned when finalized, if captureMemory
+}
+
+// ProfilerOptions are the options of a profiler tree, applied to the master profiler and all of its children
+type ProfilerOptions struct {
+	Clock         func() time.Time // source of time, nil means time.Now
+	CaptureMemory bool             // capture heap allocations and number of goroutines of each record, read from runtime/metrics
 }
 
 // NewMasterProfiler returns a new profiler instance
 func NewMasterProfiler(desc string, constDesc string, enable bool) *Profiler {
+	return NewMasterProfilerWithOptions(desc, constDesc, enable, ProfilerOptions{})
+}
+
+// NewMasterProfilerWithOptions returns a new profiler instance with the provided options, which are used by the children as well.
+// Providing a clock allows tests to assert execution time deterministically.
+func NewMasterProfilerWithOptions(desc string, constDesc string, enable bool, options ProfilerOptions) *Profiler {
 	if !enable {
 		return nil
 	}
-	master := newProfiler(desc, 0)
+	master := newProfiler(desc, 0, options)
 	master.constDesc = constDesc
 	return master
 }
 
 // newProfiler returns instance with default value
-func newProfiler(desc string, level int) *Profiler {
-	return &Profiler{
-		desc:      desc,
-		start:     time.Now().UnixMilli(),
-		finalized: false,
-		level:     level,
+func newProfiler(desc string, level int, options ProfilerOptions) *Profiler {
+	clock := options.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+	profiler := &Profiler{
+		clock:         clock,
+		desc:          desc,
+		finalized:     false,
+		level:         level,
+		captureMemory: options.CaptureMemory,
+	}
+	if profiler.captureMemory {
+		profiler.startMemory = readMemorySample()
+	}
+	profiler.start = clock()
+	return profiler
+}
+
+// options returns the options which the profiler was created with, to be used by children
+func (p *Profiler) options() ProfilerOptions {
+	return ProfilerOptions{
+		Clock:         p.clock,
+		CaptureMemory: p.captureMemory,
 	}
 }
 
@@ -44,8 +84,11 @@ func (p *Profiler) NewChild(formatDesc string, a ...any) *Profiler {
 	if p == nil {
 		return nil
 	}
-	child := newProfiler(fmt.Sprintf(formatDesc, a...), p.level+1)
+	child := newProfiler(fmt.Sprintf(formatDesc, a...), p.level+1, p.options())
 	child.constDesc = p.constDesc
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.children = append(p.children, child)
 	return child
 }
@@ -56,11 +99,26 @@ func (p *Profiler) Finalize() *Profiler {
 		return nil
 	}
 
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finalize()
+	return p
+}
+
+// finalize stops the execution time counter if not finalized yet, must be called with lock held
+func (p *Profiler) finalize() {
 	if !p.finalized {
-		p.duration = time.Now().UnixMilli() - p.start
+		p.end = p.clock()
+		p.duration = elapsed(p.start, p.end)
+		if p.captureMemory {
+			p.endMemory = readMemorySample()
+		}
 		p.finalized = true
+		if p.onFinalize != nil {
+			p.onFinalize()
+			p.onFinalize = nil
+		}
 	}
-	return p
 }
 
 // FinalizeWithCheckErr stops the execution time counter for the current instance and seals it, later if provide err, the <err> state can be changed
@@ -68,9 +126,9 @@ func (p *Profiler) FinalizeWithCheckErr(err error) {
 	if p == nil {
 		return
 	}
-	if !p.finalized {
-		p.Finalize()
-	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finalize()
 	if err != nil {
 		p.err = true
 	} else {
@@ -83,9 +141,9 @@ func (p *Profiler) FinalizeWithErr(err error) error {
 	if p == nil {
 		return err
 	}
-	if !p.finalized {
-		p.Finalize()
-	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finalize()
 	if err != nil {
 		p.err = true
 	} else {
@@ -94,46 +152,86 @@ func (p *Profiler) FinalizeWithErr(err error) error {
 	return err
 }
 
-// Print does system print out the record data, returns if itself or any child has error
+// profilerSnapshot is a consistent copy of the mutable fields of a Profiler, taken under lock
+type profilerSnapshot struct {
+	end       time.Time     // the current time if not finalized
+	duration  time.Duration // up to now if not finalized
+	endMemory memorySample  // the current sample if not finalized, if captureMemory
+	finalized bool
+	err       bool
+	children  []*Profiler
+}
+
+// snapshot returns a consistent copy of the mutable fields
+func (p *Profiler) snapshot() profilerSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := profilerSnapshot{
+		end:       p.end,
+		duration:  p.duration,
+		endMemory: p.endMemory,
+		finalized: p.finalized,
+		err:       p.err,
+		children:  make([]*Profiler, len(p.children)),
+	}
+	copy(result.children, p.children)
+	if !p.finalized {
+		result.end = p.clock()
+		result.duration = elapsed(p.start, result.end)
+		if p.captureMemory {
+			result.endMemory = readMemorySample()
+		}
+	}
+	return result
+}
+
+// Print does system print out the record data, returns if itself or any child has error.
+// Children which ran at the same time with any of their siblings are marked as parallel,
+// and for the records which have children, wall-clock time of the children is reported next to the sum of their execution time.
 func (p *Profiler) Print() (anyError bool) {
 	if p == nil {
 		return false
 	}
-	bzPad := make([]byte, p.level*2)
-	for i := 0; i < len(bzPad); i++ {
-		bzPad[i] = 32 // space
-	}
-	duration := p.duration
-	if !p.finalized {
-		duration = time.Now().UnixMilli() - p.start
-	}
-	fmt.Printf("%s[L%2d] desc [%8s][%-30s] err [%5t] duration [%7d] ms children [%2d]", string(bzPad), p.level, p.constDesc, p.desc, p.err, duration, len(p.children))
-	if len(p.children) > 1 {
-		fmt.Printf(" avg [%2d]/child\n", int(duration)/len(p.children))
-	} else {
-		fmt.Printf("\n")
-	}
+	report := p.Report()
+	fmt.Print(report.Text())
+	return report.AnyError()
+}
 
-	anyErr := false
-	if len(p.children) > 0 {
-		for _, child := range p.children {
-			if child.Print() {
-				anyErr = true
-			}
+// childrenTimes returns wall-clock time, from the first start to the last end, and sum of execution time of the children
+func childrenTimes(children []*Profiler, snapshots []profilerSnapshot) (wallClock, sum time.Duration) {
+	var first, last time.Time
+	for i, child := range children {
+		if i == 0 || child.start.Before(first) {
+			first = child.start
 		}
-	}
-	if p.level == 0 {
-		fmt.Printf("Finished [%8s][%-30s] duration [%7d] ms", p.constDesc, p.desc, duration)
-		if anyErr {
-			fmt.Printf(" with at least one ERR\n")
-		} else {
-			fmt.Printf(" gracefully\n")
+		if i == 0 || snapshots[i].end.After(last) {
+			last = snapshots[i].end
 		}
+		sum += snapshots[i].duration
 	}
+	return elapsed(first, last), sum
+}
 
-	if p.err {
-		return true
+// findParallelChildren returns, for each child, if it ran at the same time with any of its siblings
+func findParallelChildren(children []*Profiler, snapshots []profilerSnapshot) []bool {
+	result := make([]bool, len(children))
+	for i := 0; i < len(children); i++ {
+		for j := i + 1; j < len(children); j++ {
+			if children[i].start.Before(snapshots[j].end) && children[j].start.Before(snapshots[i].end) {
+				result[i] = true
+				result[j] = true
+			}
+		}
 	}
+	return result
+}
 
-	return anyErr
+// elapsed returns the time elapsed from start to end, using the monotonic clock readings if both have.
+// Negative result, which is possible when an injected clock goes backward, is reported as zero.
+func elapsed(start, end time.Time) time.Duration {
+	if duration := end.Sub(start); duration > 0 {
+		return duration
+	}
+	return 0
 }
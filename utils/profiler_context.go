@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// profilerContextKey is the type of key which the profiler is stored in context.Context
+type profilerContextKey int
+
+const (
+	currentProfilerContextKey profilerContextKey = iota
+)
+
+// pprof label keys, applied by StartSpan and DoSpan so CPU profiles can be sliced by profiler description
+//
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// PPROF_LABEL_PROFILER_DESC is the label of description of the current profiler record
+	PPROF_LABEL_PROFILER_DESC = "profiler-desc"
+
+	// PPROF_LABEL_PROFILER_PATH is the label of descriptions from the root to the current profiler record, joined by " > "
+	PPROF_LABEL_PROFILER_PATH = "profiler-path"
+
+	// PPROF_LABEL_PROFILER_CONST_DESC is the label of constant description of the profiler tree, if any
+	PPROF_LABEL_PROFILER_CONST_DESC = "profiler-const-desc"
+)
+
+// ContextWithProfiler returns a copy of the context which carries the profiler as the current record.
+// Nil profiler, which is the disabled one, is carried as well so StartSpan will not create children.
+func ContextWithProfiler(ctx context.Context, profiler *Profiler) context.Context {
+	return context.WithValue(ctx, currentProfilerContextKey, profiler)
+}
+
+// ProfilerFromContext returns the current profiler record carried by the context, or nil if none
+func ProfilerFromContext(ctx context.Context) *Profiler {
+	if ctx == nil {
+		return nil
+	}
+	profiler, _ := ctx.Value(currentProfilerContextKey).(*Profiler)
+	return profiler
+}
+
+// StartSpan creates a child of the profiler carried by the context and returns a copy of the context which carries the child.
+// The pprof labels of the child are applied to the current goroutine, and the labels of the provided context are restored
+// when the child gets finalized, so the child should be finalized on the same goroutine, typically with defer.
+// If the context does not carry any profiler, the context is returned as is, with a nil (no-op) profiler.
+func StartSpan(ctx context.Context, formatDesc string, a ...any) (context.Context, *Profiler) {
+	parent := ProfilerFromContext(ctx)
+	child := parent.NewChild(formatDesc, a...)
+	if child == nil {
+		return ctx, nil
+	}
+
+	spanCtx := ContextWithProfiler(pprof.WithLabels(ctx, profilerLabels(ctx, parent, child)), child)
+	pprof.SetGoroutineLabels(spanCtx)
+
+	child.mu.Lock()
+	defer child.mu.Unlock()
+	child.onFinalize = func() {
+		pprof.SetGoroutineLabels(ctx)
+	}
+	return spanCtx, child
+}
+
+// DoSpan creates a child of the profiler carried by the context then calls the function with a context which carries the child,
+// the child is finalized with the error returned by the function.
+// The pprof labels of the child are applied while calling the function, and also to the goroutines started by it.
+// If the context does not carry any profiler, the function is called with the context as is.
+func DoSpan(ctx context.Context, desc string, fn func(ctx context.Context) error) error {
+	parent := ProfilerFromContext(ctx)
+	child := parent.NewChild("%s", desc)
+	if child == nil {
+		return fn(ctx)
+	}
+
+	var err error
+	pprof.Do(ctx, profilerLabels(ctx, parent, child), func(labeledCtx context.Context) {
+		err = fn(ContextWithProfiler(labeledCtx, child))
+	})
+	child.FinalizeWithCheckErr(err)
+	return err
+}
+
+// profilerLabels returns the pprof labels of the child, the path is built from the path label of the context if any
+func profilerLabels(ctx context.Context, parent, child *Profiler) pprof.LabelSet {
+	parentPath, found := pprof.Label(ctx, PPROF_LABEL_PROFILER_PATH)
+	if !found {
+		parentPath = parent.desc
+	}
+
+	labels := []string{
+		PPROF_LABEL_PROFILER_DESC, child.desc,
+		PPROF_LABEL_PROFILER_PATH, parentPath + profilePathSeparator + child.desc,
+	}
+	if len(child.constDesc) > 0 {
+		labels = append(labels, PPROF_LABEL_PROFILER_CONST_DESC, child.constDesc)
+	}
+	return pprof.Labels(labels...)
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"runtime/pprof"
+	"testing"
+)
+
+// goroutineProfileText returns the goroutine profile in text format, which includes labels of the goroutines
+func goroutineProfileText(t *testing.T) string {
+	var buf bytes.Buffer
+	require.NoError(t, pprof.Lookup("goroutine").WriteTo(&buf, 1))
+	return buf.String()
+}
+
+func TestContextWithProfiler(t *testing.T) {
+	require.Nil(t, ProfilerFromContext(nil))
+	require.Nil(t, ProfilerFromContext(context.Background()))
+
+	master := NewMasterProfiler("master", "", true)
+	ctx := ContextWithProfiler(context.Background(), master)
+	require.Same(t, master, ProfilerFromContext(ctx))
+
+	ctx = ContextWithProfiler(ctx, nil)
+	require.Nil(t, ProfilerFromContext(ctx), "disabled profiler overrides the parent one")
+}
+
+func TestStartSpan(t *testing.T) {
+	t.Run("without profiler", func(t *testing.T) {
+		ctx := context.Background()
+		spanCtx, span := StartSpan(ctx, "step %d", 1)
+		require.Nil(t, span)
+		require.Equal(t, ctx, spanCtx)
+		span.Finalize() // shouldn't panic
+	})
+
+	master := NewMasterProfiler("master", "job", true)
+	ctx := ContextWithProfiler(context.Background(), master)
+
+	stepCtx, step := StartSpan(ctx, "step %d", 1)
+	require.NotNil(t, step)
+	require.Same(t, step, ProfilerFromContext(stepCtx))
+	require.Same(t, step, master.children[0])
+	require.Equal(t, "step 1", step.desc)
+	require.Equal(t, "job", step.constDesc)
+
+	desc, _ := pprof.Label(stepCtx, PPROF_LABEL_PROFILER_DESC)
+	require.Equal(t, "step 1", desc)
+	path, _ := pprof.Label(stepCtx, PPROF_LABEL_PROFILER_PATH)
+	require.Equal(t, "master > step 1", path)
+	constDesc, _ := pprof.Label(stepCtx, PPROF_LABEL_PROFILER_CONST_DESC)
+	require.Equal(t, "job", constDesc)
+	require.Contains(t, goroutineProfileText(t), `"profiler-path":"master > step 1"`, "labels must be applied to the goroutine")
+
+	subCtx, sub := StartSpan(stepCtx, "sub")
+	require.Same(t, sub, step.children[0])
+	path, _ = pprof.Label(subCtx, PPROF_LABEL_PROFILER_PATH)
+	require.Equal(t, "master > step 1 > sub", path)
+	require.Contains(t, goroutineProfileText(t), `"profiler-path":"master > step 1 > sub"`)
+
+	// finalizing restores labels of the parent context
+	sub.Finalize()
+	profile := goroutineProfileText(t)
+	require.NotContains(t, profile, `"profiler-path":"master > step 1 > sub"`)
+	require.Contains(t, profile, `"profiler-path":"master > step 1"`)
+
+	step.Finalize()
+	require.NotContains(t, goroutineProfileText(t), `"profiler-path":"master > step 1"`)
+
+	// finalizing again does not restore labels again
+	_, other := StartSpan(ctx, "other")
+	step.Finalize()
+	require.Contains(t, goroutineProfileText(t), `"profiler-path":"master > other"`)
+	other.Finalize()
+	require.NotContains(t, goroutineProfileText(t), `"profiler-path":"master > other"`)
+}
+
+func TestDoSpan(t *testing.T) {
+	called := false
+	require.NoError(t, DoSpan(context.Background(), "no profiler", func(ctx context.Context) error {
+		called = true
+		require.Nil(t, ProfilerFromContext(ctx))
+		return nil
+	}))
+	require.True(t, called)
+
+	master := NewMasterProfiler("master", "", true)
+	ctx := ContextWithProfiler(context.Background(), master)
+
+	err := DoSpan(ctx, "100% fetch", func(ctx context.Context) error {
+		fetch := ProfilerFromContext(ctx)
+		require.NotNil(t, fetch)
+		require.Equal(t, "100% fetch", fetch.desc)
+
+		path, _ := pprof.Label(ctx, PPROF_LABEL_PROFILER_PATH)
+		require.Equal(t, "master > 100% fetch", path)
+		_, found := pprof.Label(ctx, PPROF_LABEL_PROFILER_CONST_DESC)
+		require.False(t, found, "no const desc label when const desc is empty")
+		require.Contains(t, goroutineProfileText(t), `"profiler-path":"master > 100% fetch"`)
+
+		return DoSpan(ctx, "decode", func(ctx context.Context) error {
+			path, _ := pprof.Label(ctx, PPROF_LABEL_PROFILER_PATH)
+			require.Equal(t, "master > 100% fetch > decode", path)
+			return fmt.Errorf("fake")
+		})
+	})
+	require.Error(t, err)
+	require.NotContains(t, goroutineProfileText(t), `"profiler-path":"master > 100% fetch"`)
+
+	fetch := master.children[0]
+	require.True(t, fetch.finalized)
+	require.True(t, fetch.err)
+	require.True(t, fetch.children[0].finalized)
+	require.True(t, fetch.children[0].err)
+
+	require.NoError(t, DoSpan(ctx, "ok", func(ctx context.Context) error {
+		return nil
+	}))
+	require.True(t, master.children[1].finalized)
+	require.False(t, master.children[1].err)
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"runtime/metrics"
+)
+
+// runtime/metrics names which memory samples are read from
+const (
+	metricHeapAllocsBytes   = "/gc/heap/allocs:bytes"
+	metricHeapAllocsObjects = "/gc/heap/allocs:objects"
+	metricGoroutines        = "/sched/goroutines:goroutines"
+)
+
+// memorySample is a reading of the cumulative allocation counters and the number of goroutines of the process
+type memorySample struct {
+	allocBytes   uint64
+	allocObjects uint64
+	goroutines   uint64
+}
+
+// ProfileMemoryReport is the memory usage captured by a profiler record, when enabled by ProfilerOptions.CaptureMemory.
+// Numbers are process-wide, so they include allocations of other goroutines running at the same time.
+type ProfileMemoryReport struct {
+	AllocBytes      uint64 `json:"alloc-bytes"`   // heap bytes allocated during the record
+	AllocObjects    uint64 `json:"alloc-objects"` // heap objects allocated during the record
+	GoroutinesStart uint64 `json:"goroutines-start"`
+	GoroutinesEnd   uint64 `json:"goroutines-end"` // up to the time of the snapshot if not finalized
+}
+
+// readMemorySample reads the current memory sample from runtime/metrics, unsupported metrics are read as zero
+func readMemorySample() memorySample {
+	samples := []metrics.Sample{
+		{Name: metricHeapAllocsBytes},
+		{Name: metricHeapAllocsObjects},
+		{Name: metricGoroutines},
+	}
+	metrics.Read(samples)
+
+	values := make([]uint64, len(samples))
+	for i, sample := range samples {
+		if sample.Value.Kind() == metrics.KindUint64 {
+			values[i] = sample.Value.Uint64()
+		}
+	}
+	return memorySample{
+		allocBytes:   values[0],
+		allocObjects: values[1],
+		goroutines:   values[2],
+	}
+}
+
+// newProfileMemoryReport returns the memory usage between the two samples
+func newProfileMemoryReport(start, end memorySample) *ProfileMemoryReport {
+	return &ProfileMemoryReport{
+		AllocBytes:      counterDelta(start.allocBytes, end.allocBytes),
+		AllocObjects:    counterDelta(start.allocObjects, end.allocObjects),
+		GoroutinesStart: start.goroutines,
+		GoroutinesEnd:   end.goroutines,
+	}
+}
+
+// counterDelta returns the increment of the cumulative counter, zero if it went backward
+func counterDelta(start, end uint64) uint64 {
+	if end > start {
+		return end - start
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"encoding/json"
+	"github.com/EscanBE/go-lib/logging/logtest"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testMemorySink keeps allocations of the tests alive, so they are not optimized away
+var testMemorySink [][]byte
+
+func TestProfiler_CaptureMemory(t *testing.T) {
+	require.Nil(t, NewMasterProfilerWithOptions("", "", false, ProfilerOptions{CaptureMemory: true}))
+
+	master := NewMasterProfilerWithOptions("master", "memory", true, ProfilerOptions{CaptureMemory: true})
+	require.NotNil(t, master.clock, "nil clock means time.Now")
+
+	alloc := master.NewChild("alloc")
+	for i := 0; i < 16; i++ {
+		testMemorySink = append(testMemorySink, make([]byte, 64*1024))
+	}
+	alloc.Finalize()
+
+	const goroutines = 10
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	spawn := master.NewChild("spawn")
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-release
+		}()
+	}
+	spawn.Finalize()
+	close(release)
+	wg.Wait()
+
+	running := master.NewChild("running")
+	report := master.Report()
+	require.NotNil(t, report.Memory)
+	require.False(t, report.Finalized)
+
+	allocReport := report.Children[0]
+	require.NotNil(t, allocReport.Memory, "options must be inherited by children")
+	require.GreaterOrEqual(t, allocReport.Memory.AllocBytes, uint64(16*64*1024))
+	require.GreaterOrEqual(t, allocReport.Memory.AllocObjects, uint64(16))
+	require.GreaterOrEqual(t, report.Memory.AllocBytes, allocReport.Memory.AllocBytes, "process-wide, parent covers its children")
+
+	spawnReport := report.Children[1]
+	require.GreaterOrEqual(t, spawnReport.Memory.GoroutinesEnd, spawnReport.Memory.GoroutinesStart+goroutines)
+
+	require.NotNil(t, report.Children[2].Memory, "not finalized, up to now")
+	running.Finalize()
+	master.Finalize()
+	report = master.Report()
+
+	t.Run("text", func(t *testing.T) {
+		text := report.Text()
+		require.Contains(t, text, "alloc [")
+		require.Contains(t, text, "objs] goroutines [")
+		require.Contains(t, text, FormatBytesAutoUnit(report.Memory.AllocBytes))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		bz, err := json.Marshal(report)
+		require.NoError(t, err)
+		require.Contains(t, string(bz), `"memory":{"alloc-bytes":`)
+
+		bz, err = json.Marshal(NewMasterProfiler("no-memory", "", true).Report())
+		require.NoError(t, err)
+		require.NotContains(t, string(bz), `"memory"`, "omitted when not captured")
+	})
+
+	t.Run("log nodes", func(t *testing.T) {
+		logger := logtest.NewCapturingLogger()
+		master.LogNodes(logger)
+		require.Len(t, logger.Entries(), 4)
+		logger.ExpectInfoEntry(t, "profiler record", "path", "master > alloc", "alloc-bytes", allocReport.Memory.AllocBytes)
+		for _, entry := range logger.Entries() {
+			for _, key := range []string{"alloc-bytes", "alloc-objects", "goroutines-start", "goroutines-end"} {
+				require.Containsf(t, entry.Fields, key, "missing %s: %s", key, entry)
+			}
+		}
+	})
+
+	t.Run("chrome trace", func(t *testing.T) {
+		var sb strings.Builder
+		require.NoError(t, WriteChromeTrace(&sb, report))
+		events, _ := decodeChromeTrace(t, []byte(sb.String()))
+		require.EqualValues(t, report.Children[0].Memory.AllocBytes, events["alloc"].Args["alloc-bytes"])
+		require.EqualValues(t, report.Children[1].Memory.GoroutinesEnd, events["spawn"].Args["goroutines-end"])
+	})
+}
+
+func TestWriteFoldedAllocStacks(t *testing.T) {
+	require.Error(t, WriteFoldedAllocStacks(&strings.Builder{}, nil))
+
+	report := &ProfileReport{
+		Desc:     "master",
+		Duration: time.Second,
+		Memory:   &ProfileMemoryReport{AllocBytes: 10_000},
+		Children: []*ProfileReport{
+			{Desc: "step-1", Memory: &ProfileMemoryReport{AllocBytes: 4_000}},
+			{Desc: "step-2", Memory: &ProfileMemoryReport{AllocBytes: 1_000}, Children: []*ProfileReport{
+				{Desc: "nested", Memory: &ProfileMemoryReport{AllocBytes: 1_000}},
+			}},
+			{Desc: "not-captured", Duration: time.Second},
+		},
+	}
+
+	var sb strings.Builder
+	require.NoError(t, WriteFoldedAllocStacks(&sb, report, report))
+	require.Equal(t, `master 10000
+master;step-1 8000
+master;step-2;nested 2000
+`, sb.String())
+
+	sb.Reset()
+	require.NoError(t, WriteFoldedAllocStacks(&sb, newTestProfilerTree().Report()))
+	require.Empty(t, sb.String(), "no value when memory not captured")
+}
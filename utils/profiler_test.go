@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"github.com/EscanBE/go-lib/test_utils"
 	"github.com/stretchr/testify/require"
-	"math"
 	"math/rand"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -16,10 +17,10 @@ func TestNewMasterProfiler(t *testing.T) {
 	desc := fmt.Sprintf("desc %d", rand.Int())
 	constDesc := fmt.Sprintf("constDesc %d", rand.Int())
 	profiler := NewMasterProfiler(desc, constDesc, true)
-	now := time.Now().UnixMilli()
 	require.NotNil(t, profiler)
+	require.NotNil(t, profiler.clock)
 	require.Equal(t, constDesc, profiler.constDesc)
-	require.True(t, math.Abs(float64(now-profiler.start)) < 10)
+	require.Less(t, time.Since(profiler.start), 10*time.Millisecond)
 	require.Zero(t, profiler.duration)
 	require.False(t, profiler.finalized)
 	require.Zero(t, profiler.level)
@@ -30,11 +31,10 @@ func TestNewMasterProfiler(t *testing.T) {
 func Test_newProfiler(t *testing.T) {
 	desc := fmt.Sprintf("desc %d", rand.Int())
 	level := rand.Int()
-	profiler := newProfiler(desc, level)
-	now := time.Now().UnixMilli()
+	profiler := newProfiler(desc, level, ProfilerOptions{})
 	require.NotNil(t, profiler)
 	require.Empty(t, profiler.constDesc)
-	require.True(t, math.Abs(float64(now-profiler.start)) < 10)
+	require.Less(t, time.Since(profiler.start), 10*time.Millisecond)
 	require.Zero(t, profiler.duration)
 	require.False(t, profiler.finalized)
 	require.Equal(t, level, profiler.level)
@@ -46,17 +46,16 @@ func TestProfiler_NewChild(t *testing.T) {
 	require.Nil(t, (*Profiler)(nil).NewChild(""), "nil should creates nil")
 	parentDesc := fmt.Sprintf("desc %d", rand.Int())
 	parentLevel := rand.Int()
-	parentProfiler := newProfiler(parentDesc, parentLevel)
+	parentProfiler := newProfiler(parentDesc, parentLevel, ProfilerOptions{})
 	parentProfiler.constDesc = fmt.Sprintf("constDesc %d", rand.Int())
 
 	childDesc := fmt.Sprintf("desc %d", rand.Int())
 	profiler := parentProfiler.NewChild(childDesc)
-	now := time.Now().UnixMilli()
 
 	require.NotNil(t, profiler)
 	require.Equal(t, profiler, parentProfiler.children[0], "must be appended as parent children")
 	require.Equal(t, parentProfiler.constDesc, profiler.constDesc, "constDesc should be coped from parent")
-	require.True(t, math.Abs(float64(now-profiler.start)) < 10)
+	require.Less(t, time.Since(profiler.start), 10*time.Millisecond)
 	require.Zero(t, profiler.duration)
 	require.False(t, profiler.finalized)
 	require.Equal(t, parentLevel+1, profiler.level)
@@ -75,7 +74,7 @@ func TestProfiler_Finalize(t *testing.T) {
 
 	desc := test_utils.RadStr(6)
 	level := rand.Int()
-	profiler := newProfiler(desc, level)
+	profiler := newProfiler(desc, level, ProfilerOptions{})
 
 	// make sure before finalize
 	require.NotZero(t, profiler.start)
@@ -134,7 +133,7 @@ func TestProfiler_FinalizeWithCheckErr(t *testing.T) {
 
 			desc := test_utils.RadStr(6)
 			level := rand.Int()
-			profiler := newProfiler(desc, level)
+			profiler := newProfiler(desc, level, ProfilerOptions{})
 
 			// make sure before finalize
 			require.NotZero(t, profiler.start)
@@ -203,7 +202,7 @@ func TestProfiler_FinalizeWithErr(t *testing.T) {
 
 	desc := test_utils.RadStr(6)
 	level := rand.Int()
-	profiler := newProfiler(desc, level)
+	profiler := newProfiler(desc, level, ProfilerOptions{})
 
 	// make sure before finalize
 	require.NotZero(t, profiler.start)
@@ -285,3 +284,150 @@ func TestProfiler_Print(t *testing.T) {
 		require.Truef(t, anyErr == got, "got %v (i=%d), want %v", got, i, anyErr)
 	}
 }
+
+func TestProfiler_Concurrent(t *testing.T) {
+	master := NewMasterProfiler("master", "concurrent", true)
+
+	const workers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child := master.NewChild("worker %d", i)
+			for j := 0; j < 5; j++ {
+				grandChild := child.NewChild("task %d", j)
+				if j%2 == 0 {
+					grandChild.FinalizeWithCheckErr(nil)
+				} else {
+					grandChild.Finalize()
+				}
+			}
+			if i == 0 {
+				_ = child.FinalizeWithErr(fmt.Errorf("err"))
+			} else {
+				child.Finalize()
+			}
+			_ = master.Report().Text() // report while other goroutines are still working
+		}(i)
+	}
+	wg.Wait()
+	master.Finalize()
+
+	require.Len(t, master.children, workers)
+	for _, child := range master.children {
+		require.Len(t, child.children, 5)
+	}
+	require.True(t, master.Report().AnyError())
+}
+
+func TestProfiler_Report_ParallelAndWallClock(t *testing.T) {
+	master := newProfiler("master", 0, ProfilerOptions{})
+	master.start = testProfilerTime(1000)
+
+	// sequential
+	addFinalizedChild(master, "sequential-1", 1000, 1100)
+	addFinalizedChild(master, "sequential-2", 1100, 1200)
+	// parallel fan-out
+	fanOut := addFinalizedChild(master, "fan-out", 1200, 1500)
+	addFinalizedChild(fanOut, "worker-1", 1200, 1500)
+	addFinalizedChild(fanOut, "worker-2", 1250, 1450)
+	addFinalizedChild(fanOut, "worker-3", 1210, 1300)
+	master.end = testProfilerTime(1500)
+	master.duration = 500 * time.Millisecond
+	master.finalized = true
+
+	report := master.Report()
+	require.False(t, report.AnyError())
+	lines := strings.Split(strings.TrimSpace(report.Text()), "\n")
+	require.Len(t, lines, 8)
+
+	require.Contains(t, lines[0], "children [ 3] wall [    500ms] sum [    500ms]")
+	require.NotContains(t, lines[1], "(parallel)")
+	require.NotContains(t, lines[2], "(parallel)")
+	require.NotContains(t, lines[3], "(parallel)")
+	require.Contains(t, lines[3], "children [ 3] wall [    300ms] sum [    590ms]", "sum of parallel children exceeds wall-clock time")
+	for _, line := range lines[4:7] {
+		require.Contains(t, line, "(parallel)")
+	}
+	require.Contains(t, lines[7], "gracefully")
+
+	wallClock, sum := childrenTimes(fanOut.children, []profilerSnapshot{
+		fanOut.children[0].snapshot(),
+		fanOut.children[1].snapshot(),
+		fanOut.children[2].snapshot(),
+	})
+	require.Equal(t, 300*time.Millisecond, wallClock)
+	require.Equal(t, 590*time.Millisecond, sum)
+}
+
+// testClock is a clock which only moves when being advanced
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// newTestClock returns a testClock starting at testProfilerTime(0)
+func newTestClock() *testClock {
+	return &testClock{
+		now: testProfilerTime(0),
+	}
+}
+
+// Now returns the current time of the clock
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock, negative duration moves it backward
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestProfiler_Clock(t *testing.T) {
+	require.Nil(t, NewMasterProfilerWithOptions("", "", false, ProfilerOptions{Clock: time.Now}))
+
+	clock := newTestClock()
+	master := NewMasterProfilerWithOptions("master", "clock", true, ProfilerOptions{Clock: clock.Now})
+	require.Equal(t, testProfilerTime(0), master.start)
+
+	clock.Advance(250 * time.Microsecond)
+	child := master.NewChild("sub-millisecond")
+	require.Equal(t, testProfilerTime(0).Add(250*time.Microsecond), child.start, "clock must be used by children")
+	clock.Advance(1500 * time.Nanosecond)
+	child.Finalize()
+	require.Equal(t, 1500*time.Nanosecond, child.duration)
+
+	running := master.NewChild("running")
+	clock.Advance(2 * time.Millisecond)
+	report := master.Report()
+	require.Equal(t, 2*time.Millisecond+251500*time.Nanosecond, report.Duration, "not finalized, up to now")
+	require.Equal(t, 2*time.Millisecond, report.Children[1].Duration)
+	running.Finalize()
+	master.Finalize()
+
+	text := master.Report().Text()
+	require.Contains(t, text, "duration [   2.25ms]")
+	require.Contains(t, text, "duration [    1.5µs]")
+
+	t.Run("clock goes backward", func(t *testing.T) {
+		clock := newTestClock()
+		profiler := NewMasterProfilerWithOptions("backward", "", true, ProfilerOptions{Clock: clock.Now})
+		clock.Advance(-time.Second)
+		require.Zero(t, profiler.Report().Duration)
+		profiler.Finalize()
+		require.Zero(t, profiler.duration)
+	})
+
+	t.Run("monotonic clock by default", func(t *testing.T) {
+		profiler := NewMasterProfiler("monotonic", "", true)
+		require.Contains(t, profiler.start.String(), "m=", "must carry monotonic clock reading")
+		time.Sleep(time.Millisecond)
+		profiler.Finalize()
+		require.GreaterOrEqual(t, profiler.duration, time.Millisecond)
+	})
+}
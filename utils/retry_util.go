@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/EscanBE/go-lib/types"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// RetryBackoff is the strategy which the delay between attempts grows
+type RetryBackoff string
+
+const (
+	RetryBackoffExponential RetryBackoff = "exponential" // delay = InitialDelay * Multiplier^(n-1)
+	RetryBackoffLinear      RetryBackoff = "linear"      // delay = InitialDelay + Increment*(n-1)
+)
+
+// RetryStopReason is the reason which the RetryExecutor stopped retrying
+type RetryStopReason string
+
+const (
+	RetryStopNonRetryable RetryStopReason = "non-retryable error"
+	RetryStopMaxAttempts  RetryStopReason = "max attempts reached"
+	RetryStopCancelled    RetryStopReason = "cancelled"
+)
+
+const (
+	// defaultRetryMultiplier is the multiplier of exponential backoff when not provided
+	defaultRetryMultiplier = 2
+
+	// maxRetryDelay caps the computed delay, so it does not overflow time.Duration
+	maxRetryDelay = float64(math.MaxInt64 / 2)
+)
+
+// RetryPolicy defines how the RetryExecutor retries
+type RetryPolicy struct {
+	Backoff      RetryBackoff  // default exponential
+	InitialDelay time.Duration // delay after the first failed attempt
+	MaxDelay     time.Duration // upper bound of the delay, 0 = unlimited
+	Multiplier   float64       // growth of exponential backoff, must be >= 1, 0 = default 2
+	Increment    time.Duration // growth of linear backoff, 0 = constant delay
+	Jitter       float64       // in range [0, 1], the delay is reduced randomly by up to this fraction, to avoid retrying in lockstep
+	MaxAttempts  int           // 0 = unlimited, limited by the counter and the expiry of the token only
+
+	// Retryable decides if the error is retryable, nil means every error is retryable
+	Retryable func(err error) bool
+
+	// OnAttempt is called after each attempt, eg: for logging, can be nil
+	OnAttempt func(attempt RetryAttempt)
+}
+
+// RetryAttempt is the outcome of an attempt, provided to RetryPolicy.OnAttempt
+type RetryAttempt struct {
+	Number    int           // starts from 1
+	Err       error         // nil if succeeded
+	Duration  time.Duration // execution time of the attempt
+	NextDelay time.Duration // delay before the next attempt, 0 if no more attempt
+}
+
+// RetryError is the error returned when all attempts failed or retrying was stopped
+type RetryError struct {
+	Errors     []error                  // error of each attempt, in order
+	StopReason RetryStopReason          // why retrying was stopped
+	Cause      *types.CancellationCause // the cause of expiry of the token, when stopped by the token
+}
+
+// Error implements error
+func (e *RetryError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("failed after %d attempt(s), %s", len(e.Errors), e.StopReason))
+	if e.Cause != nil {
+		sb.WriteString(fmt.Sprintf(" (%s)", e.Cause))
+	}
+	if len(e.Errors) > 0 {
+		errs := make([]string, len(e.Errors))
+		for i, err := range e.Errors {
+			errs[i] = err.Error()
+		}
+		sb.WriteString(fmt.Sprintf(": [%s]", strings.Join(errs, ", ")))
+	}
+	return sb.String()
+}
+
+// Unwrap returns the error of the last attempt, or the error of the token if no attempt was made
+func (e *RetryError) Unwrap() error {
+	if len(e.Errors) > 0 {
+		return e.Errors[len(e.Errors)-1]
+	}
+	return e.Cause.Err()
+}
+
+// RetryExecutor executes a function until it succeeded, backing off between attempts,
+// as long as the error is retryable and the token is not expired.
+// Each attempt reduces the counter of the token, so a token source created with counter limits the number of attempts,
+// and the expiry time of the token is the overall deadline.
+type RetryExecutor struct {
+	policy RetryPolicy
+	random func() float64 // source of jitter, in range [0, 1)
+}
+
+// NewRetryExecutor returns a RetryExecutor which retries following the policy
+func NewRetryExecutor(policy RetryPolicy) (*RetryExecutor, error) {
+	switch policy.Backoff {
+	case "":
+		policy.Backoff = RetryBackoffExponential
+	case RetryBackoffExponential, RetryBackoffLinear:
+	default:
+		return nil, fmt.Errorf("not supported backoff %s", policy.Backoff)
+	}
+	if policy.InitialDelay < 0 {
+		return nil, fmt.Errorf("invalid initial delay %s", policy.InitialDelay)
+	}
+	if policy.MaxDelay < 0 {
+		return nil, fmt.Errorf("invalid max delay %s", policy.MaxDelay)
+	}
+	if policy.Multiplier == 0 {
+		policy.Multiplier = defaultRetryMultiplier
+	} else if policy.Multiplier < 1 {
+		return nil, fmt.Errorf("invalid multiplier %v, must be >= 1", policy.Multiplier)
+	}
+	if policy.Increment < 0 {
+		return nil, fmt.Errorf("invalid increment %s", policy.Increment)
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return nil, fmt.Errorf("invalid jitter %v, must be in range [0, 1]", policy.Jitter)
+	}
+	if policy.MaxAttempts < 0 {
+		return nil, fmt.Errorf("invalid max attempts %d", policy.MaxAttempts)
+	}
+
+	return &RetryExecutor{
+		policy: policy,
+		random: rand.Float64,
+	}, nil
+}
+
+// Do calls the function until it succeeded or retrying was stopped, the token is provided to the function as the context.
+// The first attempt is always made, even if the token is already expired, the token is checked before each retry.
+// Returns the errors of the failed attempts in order, even if the last attempt succeeded,
+// and a *RetryError if did not succeed.
+func (e *RetryExecutor) Do(ct types.CancellationToken, fn func(ctx context.Context, attempt int) error) (attemptErrors []error, err error) {
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && ct.IsExpired() {
+			return attemptErrors, &RetryError{
+				Errors:     attemptErrors,
+				StopReason: RetryStopCancelled,
+				Cause:      ct.Cause(),
+			}
+		}
+
+		start := time.Now()
+		attemptErr := fn(ct, attempt)
+		ct.ReduceCounter()
+		result := RetryAttempt{
+			Number:   attempt,
+			Err:      attemptErr,
+			Duration: time.Since(start),
+		}
+
+		if attemptErr == nil {
+			e.onAttempt(result)
+			return attemptErrors, nil
+		}
+		attemptErrors = append(attemptErrors, attemptErr)
+
+		var stopReason RetryStopReason
+		if e.policy.Retryable != nil && !e.policy.Retryable(attemptErr) {
+			stopReason = RetryStopNonRetryable
+		} else if e.policy.MaxAttempts > 0 && attempt >= e.policy.MaxAttempts {
+			stopReason = RetryStopMaxAttempts
+		} else if !ct.IsExpired() {
+			result.NextDelay = e.delay(attempt)
+		}
+		e.onAttempt(result)
+
+		if len(stopReason) > 0 {
+			return attemptErrors, &RetryError{
+				Errors:     attemptErrors,
+				StopReason: stopReason,
+			}
+		}
+
+		ct.Sleep(result.NextDelay) // expiry is checked at the beginning of the next retry
+	}
+}
+
+// onAttempt calls the hook if provided
+func (e *RetryExecutor) onAttempt(attempt RetryAttempt) {
+	if e.policy.OnAttempt != nil {
+		e.policy.OnAttempt(attempt)
+	}
+}
+
+// delay returns the delay after the n-th failed attempt, with jitter applied
+func (e *RetryExecutor) delay(failedAttempts int) time.Duration {
+	var delay float64
+	if e.policy.Backoff == RetryBackoffLinear {
+		delay = float64(e.policy.InitialDelay) + float64(e.policy.Increment)*float64(failedAttempts-1)
+	} else {
+		delay = float64(e.policy.InitialDelay) * math.Pow(e.policy.Multiplier, float64(failedAttempts-1))
+	}
+
+	if e.policy.MaxDelay > 0 && delay > float64(e.policy.MaxDelay) {
+		delay = float64(e.policy.MaxDelay)
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	if e.policy.Jitter > 0 {
+		delay -= delay * e.policy.Jitter * e.random()
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,230 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/EscanBE/go-lib/test_utils"
+	"github.com/EscanBE/go-lib/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNewRetryExecutor(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		wantErr string
+	}{
+		{name: "default", policy: RetryPolicy{}},
+		{name: "linear", policy: RetryPolicy{Backoff: RetryBackoffLinear, InitialDelay: time.Second, Increment: time.Second}},
+		{name: "full", policy: RetryPolicy{InitialDelay: time.Second, MaxDelay: time.Minute, Multiplier: 1.5, Jitter: 1, MaxAttempts: 3}},
+		{name: "not supported backoff", policy: RetryPolicy{Backoff: "random"}, wantErr: "not supported backoff"},
+		{name: "negative initial delay", policy: RetryPolicy{InitialDelay: -1}, wantErr: "invalid initial delay"},
+		{name: "negative max delay", policy: RetryPolicy{MaxDelay: -1}, wantErr: "invalid max delay"},
+		{name: "multiplier less than 1", policy: RetryPolicy{Multiplier: 0.5}, wantErr: "invalid multiplier"},
+		{name: "negative increment", policy: RetryPolicy{Increment: -1}, wantErr: "invalid increment"},
+		{name: "negative jitter", policy: RetryPolicy{Jitter: -0.1}, wantErr: "invalid jitter"},
+		{name: "jitter greater than 1", policy: RetryPolicy{Jitter: 1.1}, wantErr: "invalid jitter"},
+		{name: "negative max attempts", policy: RetryPolicy{MaxAttempts: -1}, wantErr: "invalid max attempts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor, err := NewRetryExecutor(tt.policy)
+			test_utils.WantErrorContainsStringIfNonEmptyOtherWiseNoError(t, err, tt.wantErr)
+			if len(tt.wantErr) > 0 {
+				require.Nil(t, executor)
+			} else {
+				require.NotNil(t, executor)
+			}
+		})
+	}
+}
+
+func TestRetryExecutor_delay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		random float64
+		want   []time.Duration // after 1st, 2nd,... failed attempts
+	}{
+		{
+			name:   "exponential",
+			policy: RetryPolicy{InitialDelay: 100 * time.Millisecond},
+			want:   []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond},
+		},
+		{
+			name:   "exponential with multiplier and max delay",
+			policy: RetryPolicy{InitialDelay: 100 * time.Millisecond, Multiplier: 3, MaxDelay: time.Second},
+			want:   []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, time.Second},
+		},
+		{
+			name:   "linear",
+			policy: RetryPolicy{Backoff: RetryBackoffLinear, InitialDelay: 100 * time.Millisecond, Increment: 50 * time.Millisecond},
+			want:   []time.Duration{100 * time.Millisecond, 150 * time.Millisecond, 200 * time.Millisecond, 250 * time.Millisecond},
+		},
+		{
+			name:   "constant",
+			policy: RetryPolicy{Backoff: RetryBackoffLinear, InitialDelay: 300 * time.Millisecond},
+			want:   []time.Duration{300 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond},
+		},
+		{
+			name:   "jitter",
+			policy: RetryPolicy{InitialDelay: 100 * time.Millisecond, Jitter: 0.5},
+			random: 0.5,
+			want:   []time.Duration{75 * time.Millisecond, 150 * time.Millisecond, 300 * time.Millisecond},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor, err := NewRetryExecutor(tt.policy)
+			require.NoError(t, err)
+			executor.random = func() float64 {
+				return tt.random
+			}
+			for i, want := range tt.want {
+				require.Equal(t, want, executor.delay(i+1), "after %d failed attempts", i+1)
+			}
+		})
+	}
+
+	t.Run("never overflows", func(t *testing.T) {
+		executor, err := NewRetryExecutor(RetryPolicy{InitialDelay: time.Hour, Multiplier: 10})
+		require.NoError(t, err)
+		require.Positive(t, executor.delay(1000))
+	})
+}
+
+func TestRetryExecutor_Do(t *testing.T) {
+	errTemporary := fmt.Errorf("temporary")
+	errPermanent := fmt.Errorf("permanent")
+
+	newExecutor := func(t *testing.T, policy RetryPolicy) (*RetryExecutor, *[]RetryAttempt) {
+		var attempts []RetryAttempt
+		policy.OnAttempt = func(attempt RetryAttempt) {
+			attempts = append(attempts, attempt)
+		}
+		executor, err := NewRetryExecutor(policy)
+		require.NoError(t, err)
+		return executor, &attempts
+	}
+
+	t.Run("succeeded after retries", func(t *testing.T) {
+		executor, attempts := newExecutor(t, RetryPolicy{InitialDelay: time.Millisecond})
+		ct := types.NewCancellationTokenSource().GetCancellationToken()
+
+		attemptErrors, err := executor.Do(ct, func(ctx context.Context, attempt int) error {
+			require.NoError(t, ctx.Err())
+			if attempt < 3 {
+				return errTemporary
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []error{errTemporary, errTemporary}, attemptErrors)
+		require.Len(t, *attempts, 3)
+		require.Equal(t, time.Millisecond, (*attempts)[0].NextDelay)
+		require.Equal(t, 2*time.Millisecond, (*attempts)[1].NextDelay)
+		require.Equal(t, 3, (*attempts)[2].Number)
+		require.NoError(t, (*attempts)[2].Err)
+		require.Zero(t, (*attempts)[2].NextDelay)
+	})
+
+	t.Run("non-retryable error", func(t *testing.T) {
+		executor, attempts := newExecutor(t, RetryPolicy{
+			Retryable: func(err error) bool {
+				return !errors.Is(err, errPermanent)
+			},
+		})
+
+		attemptErrors, err := executor.Do(types.NewCancellationTokenSource().GetCancellationToken(), func(_ context.Context, attempt int) error {
+			if attempt < 2 {
+				return errTemporary
+			}
+			return errPermanent
+		})
+		var retryErr *RetryError
+		require.ErrorAs(t, err, &retryErr)
+		require.Equal(t, RetryStopNonRetryable, retryErr.StopReason)
+		require.Equal(t, []error{errTemporary, errPermanent}, retryErr.Errors)
+		require.Equal(t, retryErr.Errors, attemptErrors)
+		require.ErrorIs(t, err, errPermanent, "must unwrap to the last error")
+		require.Equal(t, "failed after 2 attempt(s), non-retryable error: [temporary, permanent]", err.Error())
+		require.Len(t, *attempts, 2)
+		require.Zero(t, (*attempts)[1].NextDelay)
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		executor, _ := newExecutor(t, RetryPolicy{MaxAttempts: 3})
+		calls := 0
+		_, err := executor.Do(types.NewCancellationTokenSource().GetCancellationToken(), func(context.Context, int) error {
+			calls++
+			return errTemporary
+		})
+		var retryErr *RetryError
+		require.ErrorAs(t, err, &retryErr)
+		require.Equal(t, RetryStopMaxAttempts, retryErr.StopReason)
+		require.Equal(t, 3, calls)
+	})
+
+	t.Run("counter of the token limits attempts", func(t *testing.T) {
+		executor, attempts := newExecutor(t, RetryPolicy{InitialDelay: time.Millisecond})
+		ct := types.NewCancellationTokenSourceWithTimeoutDurationAndCounter(time.Hour, 2).GetCancellationToken()
+
+		_, err := executor.Do(ct, func(context.Context, int) error {
+			return errTemporary
+		})
+
+		var retryErr *RetryError
+		require.ErrorAs(t, err, &retryErr)
+		require.Equal(t, RetryStopCancelled, retryErr.StopReason)
+		require.Len(t, retryErr.Errors, 2)
+		require.Equal(t, types.CancellationReasonCounterExhausted, retryErr.Cause.Reason)
+		require.Contains(t, err.Error(), "expired by counter exhausted")
+		require.Equal(t, time.Millisecond, (*attempts)[0].NextDelay)
+		require.Zero(t, (*attempts)[1].NextDelay, "must not back off when counter exhausted")
+	})
+
+	t.Run("deadline of the token", func(t *testing.T) {
+		executor, _ := newExecutor(t, RetryPolicy{InitialDelay: time.Hour})
+		ct := types.NewCancellationTokenSourceWithTimeoutDuration(50 * time.Millisecond).GetCancellationToken()
+
+		start := time.Now()
+		attemptErrors, err := executor.Do(ct, func(context.Context, int) error {
+			return errTemporary
+		})
+		require.Less(t, time.Since(start), time.Minute, "backoff must be interrupted by the deadline")
+		require.Len(t, attemptErrors, 1)
+
+		var retryErr *RetryError
+		require.ErrorAs(t, err, &retryErr)
+		require.Equal(t, RetryStopCancelled, retryErr.StopReason)
+		require.Equal(t, types.CancellationReasonTimeout, retryErr.Cause.Reason)
+	})
+
+	t.Run("token already expired", func(t *testing.T) {
+		executor, _ := newExecutor(t, RetryPolicy{})
+		cs := types.NewCancellationTokenSource()
+		cs.RequestCancellation()
+
+		calls := 0
+		attemptErrors, err := executor.Do(cs.GetCancellationToken(), func(context.Context, int) error {
+			calls++
+			return errTemporary
+		})
+		require.Equal(t, 1, calls, "first attempt must always be made")
+		require.Len(t, attemptErrors, 1)
+		require.ErrorIs(t, err, errTemporary)
+		require.Equal(t, "failed after 1 attempt(s), cancelled (cancellation token source expired by manual): [temporary]", err.Error())
+
+		calls = 0
+		attemptErrors, err = executor.Do(cs.GetCancellationToken(), func(context.Context, int) error {
+			calls++
+			return nil
+		})
+		require.Equal(t, 1, calls)
+		require.Empty(t, attemptErrors)
+		require.NoError(t, err)
+	})
+}
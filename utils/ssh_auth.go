@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"fmt"
+	"github.com/EscanBE/go-lib/types"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"net"
+	"os"
+)
+
+// sshAuthMethods returns the authentication methods supplied for the remote server, in order,
+// and the function to release the resources used by them, eg: connection to ssh-agent, to be called after the execution.
+//
+// Keys of private key and agent auths are merged into a single public key method, placed at the first of them,
+// because the SSH client does not try the same method twice.
+// An agent which can not be used is skipped, unless no other method is available.
+func sshAuthMethods(remoteServer *types.SshRemote) (auth []ssh.AuthMethod, release func(), err error) {
+	auths := remoteServer.GetAuthMethods()
+	if len(auths) < 1 {
+		return nil, nil, fmt.Errorf("not supported authentication type or none provided")
+	}
+
+	var agentConns []net.Conn
+	release = func() {
+		for _, conn := range agentConns {
+			//goland:noinspection GoUnhandledErrorResult
+			conn.Close()
+		}
+	}
+
+	var signers []ssh.Signer
+	publicKeysIndex := -1
+	var agentErr error
+	for _, sshAuth := range auths {
+		switch sshAuth := sshAuth.(type) {
+		case types.SshAuthPrivateKey:
+			signer, err := privateKeySigner(sshAuth)
+			if err != nil {
+				release()
+				return nil, nil, err
+			}
+			signers = append(signers, signer)
+		case types.SshAuthAgent:
+			conn, agentSigners, err := sshAgentSigners(sshAuth)
+			if err != nil {
+				agentErr = err
+				continue
+			}
+			agentConns = append(agentConns, conn)
+			signers = append(signers, agentSigners...)
+		case types.SshAuthPassword:
+			auth = append(auth, ssh.Password(string(sshAuth.Password)))
+			continue
+		case types.SshAuthKeyboardInteractive:
+			if sshAuth.Challenge == nil {
+				release()
+				return nil, nil, fmt.Errorf("no challenge function was provided for keyboard-interactive authentication")
+			}
+			auth = append(auth, ssh.KeyboardInteractive(sshAuth.Challenge))
+			continue
+		default:
+			release()
+			return nil, nil, fmt.Errorf("not supported authentication type %T", sshAuth)
+		}
+
+		if publicKeysIndex < 0 {
+			publicKeysIndex = len(auth)
+			auth = append(auth, nil) // reserve the position, filled after all the keys collected
+		}
+	}
+
+	if publicKeysIndex >= 0 {
+		if len(signers) > 0 {
+			auth[publicKeysIndex] = ssh.PublicKeys(signers...)
+		} else {
+			auth = append(auth[:publicKeysIndex], auth[publicKeysIndex+1:]...)
+		}
+	}
+	if len(auth) < 1 {
+		release()
+		return nil, nil, errors.Wrap(agentErr, "no authentication method is available")
+	}
+	return auth, release, nil
+}
+
+// privateKeySigner returns the signer of the private key, combined with the certificate if supplied
+func privateKeySigner(auth types.SshAuthPrivateKey) (ssh.Signer, error) {
+	if len(auth.PrivateKey) < 24 {
+		return nil, fmt.Errorf("bad private key")
+	}
+
+	var key ssh.Signer
+	var err error
+	if len(auth.Passphrase) > 0 {
+		key, err = ssh.ParsePrivateKeyWithPassphrase(auth.PrivateKey, auth.Passphrase)
+	} else {
+		key, err = ssh.ParsePrivateKey(auth.PrivateKey)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt SSH private key")
+	}
+	if len(auth.Certificate) < 1 {
+		return key, nil
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(auth.Certificate)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse SSH certificate")
+	}
+	certificate, ok := publicKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("not an OpenSSH certificate: %s", publicKey.Type())
+	}
+	signer, err := ssh.NewCertSigner(certificate, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "SSH certificate does not match the private key")
+	}
+	return signer, nil
+}
+
+// sshAgentSigners connects to ssh-agent and returns the connection, which must be kept open while signing, and the keys it holds
+func sshAgentSigners(auth types.SshAuthAgent) (net.Conn, []ssh.Signer, error) {
+	socketPath := auth.SocketPath
+	if len(socketPath) < 1 {
+		socketPath = os.Getenv("SSH_AUTH_SOCK")
+	}
+	if len(socketPath) < 1 {
+		return nil, nil, fmt.Errorf("no ssh-agent socket was provided and SSH_AUTH_SOCK is not set")
+	}
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to connect to ssh-agent")
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		//goland:noinspection GoUnhandledErrorResult
+		conn.Close()
+		return nil, nil, errors.Wrap(err, "failed to list keys of ssh-agent")
+	}
+	if len(signers) < 1 {
+		//goland:noinspection GoUnhandledErrorResult
+		conn.Close()
+		return nil, nil, fmt.Errorf("ssh-agent holds no key")
+	}
+	return conn, signers, nil
+}
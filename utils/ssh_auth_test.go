@@ -0,0 +1,286 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/EscanBE/go-lib/types"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestSshKey returns a random ed25519 key as signer and in PEM format
+func newTestSshKey(t *testing.T) (ssh.Signer, []byte) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	return signer, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// newTestSshCertificate returns the certificate of the key for the user, signed by the CA, in authorized_keys format
+func newTestSshCertificate(t *testing.T, ca ssh.Signer, key ssh.PublicKey, username string) []byte {
+	certificate := &ssh.Certificate{
+		Key:             key,
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{username},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	require.NoError(t, certificate.SignCert(rand.Reader, ca))
+	return ssh.MarshalAuthorizedKey(certificate)
+}
+
+// newTestSshAgent starts a ssh-agent holding the key, returns the socket path
+func newTestSshAgent(t *testing.T, key ed25519.PrivateKey) string {
+	keyring := agent.NewKeyring()
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: key}))
+
+	dir, err := os.MkdirTemp("", "agent") // short path, unix socket path is limited in length
+	require.NoError(t, err)
+	socketPath := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = listener.Close()
+		_ = os.RemoveAll(dir)
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	return socketPath
+}
+
+func TestExecuteRemoteCommandViaSSH_authMethods(t *testing.T) {
+	const password = "secret"
+
+	authorizedSigner, authorizedPem := newTestSshKey(t)
+	unauthorizedSigner, unauthorizedPem := newTestSshKey(t)
+	caSigner, _ := newTestSshKey(t)
+	certifiedSigner, certifiedPem := newTestSshKey(t)
+
+	_, agentKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	agentSigner, err := ssh.NewSignerFromKey(agentKey)
+	require.NoError(t, err)
+	agentSocket := newTestSshAgent(t, agentKey)
+
+	server := newTestSshServer(t, func(config *ssh.ServerConfig) {
+		certChecker := &ssh.CertChecker{
+			IsUserAuthority: func(auth ssh.PublicKey) bool {
+				return ssh.FingerprintSHA256(auth) == ssh.FingerprintSHA256(caSigner.PublicKey())
+			},
+			UserKeyFallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+				fingerprint := ssh.FingerprintSHA256(key)
+				if fingerprint == ssh.FingerprintSHA256(authorizedSigner.PublicKey()) || fingerprint == ssh.FingerprintSHA256(agentSigner.PublicKey()) {
+					return nil, nil
+				}
+				return nil, fmt.Errorf("unauthorized key")
+			},
+		}
+		config.PublicKeyCallback = certChecker.Authenticate
+		config.PasswordCallback = func(_ ssh.ConnMetadata, pwd []byte) (*ssh.Permissions, error) {
+			if string(pwd) == password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("wrong password")
+		}
+		config.KeyboardInteractiveCallback = func(_ ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("", "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if len(answers) != 1 || answers[0] != password {
+				return nil, fmt.Errorf("wrong answer")
+			}
+			return nil, nil
+		}
+	})
+
+	wrongAnswer := types.NewSshAuthByKeyboardInteractive(func(string, string, []string, []bool) ([]string, error) {
+		return []string{"wrong"}, nil
+	})
+
+	tests := []struct {
+		name       string
+		auths      []types.SshAuth
+		wantMethod string
+		wantErrMsg string
+	}{
+		{
+			name:       "password",
+			auths:      []types.SshAuth{types.NewSshAuthByPassword([]byte(password))},
+			wantMethod: "password",
+		},
+		{
+			name:       "wrong password",
+			auths:      []types.SshAuth{types.NewSshAuthByPassword([]byte("wrong"))},
+			wantErrMsg: "unable to authenticate",
+		},
+		{
+			name:       "keyboard-interactive",
+			auths:      []types.SshAuth{types.NewSshAuthByKeyboardInteractivePassword([]byte(password))},
+			wantMethod: "keyboard-interactive",
+		},
+		{
+			name:       "keyboard-interactive requires challenge function",
+			auths:      []types.SshAuth{types.SshAuthKeyboardInteractive{}},
+			wantErrMsg: "no challenge function was provided",
+		},
+		{
+			name:       "private key",
+			auths:      []types.SshAuth{types.NewSshAuthByPrivateKey(authorizedPem, nil)},
+			wantMethod: "publickey",
+		},
+		{
+			name: "all the keys are tried",
+			auths: []types.SshAuth{
+				types.NewSshAuthByPrivateKey(unauthorizedPem, nil),
+				types.NewSshAuthByPassword([]byte("wrong")),
+				types.NewSshAuthByPrivateKey(authorizedPem, nil),
+			},
+			wantMethod: "publickey",
+		},
+		{
+			name:       "certificate",
+			auths:      []types.SshAuth{types.NewSshAuthByCertificate(certifiedPem, nil, newTestSshCertificate(t, caSigner, certifiedSigner.PublicKey(), "alice"))},
+			wantMethod: "publickey",
+		},
+		{
+			name:       "certificate for another user",
+			auths:      []types.SshAuth{types.NewSshAuthByCertificate(certifiedPem, nil, newTestSshCertificate(t, caSigner, certifiedSigner.PublicKey(), "bob"))},
+			wantErrMsg: "unable to authenticate",
+		},
+		{
+			name:       "certificate of another key",
+			auths:      []types.SshAuth{types.NewSshAuthByCertificate(certifiedPem, nil, newTestSshCertificate(t, caSigner, unauthorizedSigner.PublicKey(), "alice"))},
+			wantErrMsg: "SSH certificate does not match the private key",
+		},
+		{
+			name:       "not a certificate",
+			auths:      []types.SshAuth{types.NewSshAuthByCertificate(certifiedPem, nil, ssh.MarshalAuthorizedKey(certifiedSigner.PublicKey()))},
+			wantErrMsg: "not an OpenSSH certificate",
+		},
+		{
+			name:       "agent",
+			auths:      []types.SshAuth{types.NewSshAuthByAgent(agentSocket)},
+			wantMethod: "publickey",
+		},
+		{
+			name: "unavailable agent is skipped",
+			auths: []types.SshAuth{
+				types.NewSshAuthByAgent(filepath.Join(t.TempDir(), "not-exists")),
+				types.NewSshAuthByPassword([]byte(password)),
+			},
+			wantMethod: "password",
+		},
+		{
+			name:       "unavailable agent only",
+			auths:      []types.SshAuth{types.NewSshAuthByAgent(filepath.Join(t.TempDir(), "not-exists"))},
+			wantErrMsg: "no authentication method is available: failed to connect to ssh-agent",
+		},
+		{
+			name:       "tried in order",
+			auths:      []types.SshAuth{types.NewSshAuthByPassword([]byte(password)), types.NewSshAuthByKeyboardInteractivePassword([]byte(password))},
+			wantMethod: "password",
+		},
+		{
+			name:       "fallback to the next method",
+			auths:      []types.SshAuth{wrongAnswer, types.NewSshAuthByPrivateKey(unauthorizedPem, nil), types.NewSshAuthByPassword([]byte(password))},
+			wantMethod: "password",
+		},
+		{
+			name:       "not supported",
+			auths:      []types.SshAuth{&types.SshAuthPassword{}},
+			wantErrMsg: "not supported authentication type *types.SshAuthPassword",
+		},
+		{
+			name:       "none",
+			wantErrMsg: "not supported authentication type or none provided",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := server.remote("alice")
+			remote.AuthByPrivateKey = nil
+			remote.WithAuth(tt.auths...)
+
+			server.mu.Lock()
+			server.authenticatedBy = nil
+			server.mu.Unlock()
+
+			output, err := ExecuteRemoteCommandViaSSH("command", remote)
+			if len(tt.wantErrMsg) > 0 {
+				require.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "echo: command", output)
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			require.Equal(t, []string{tt.wantMethod}, server.authenticatedBy)
+		})
+	}
+
+	t.Run("agent from SSH_AUTH_SOCK", func(t *testing.T) {
+		t.Setenv("SSH_AUTH_SOCK", agentSocket)
+		remote := server.remote("alice")
+		remote.AuthByPrivateKey = nil
+		remote.WithAuth(types.NewSshAuthByAgent(""))
+		_, err := ExecuteRemoteCommandViaSSH("command", remote)
+		require.NoError(t, err)
+
+		t.Setenv("SSH_AUTH_SOCK", "")
+		_, err = ExecuteRemoteCommandViaSSH("command", remote)
+		require.ErrorContains(t, err, "SSH_AUTH_SOCK is not set")
+	})
+
+	t.Run("private key of the remote is tried first", func(t *testing.T) {
+		remote := server.remote("alice")
+		remote.WithAuthByPrivateKey(types.NewSshAuthByPrivateKey(authorizedPem, nil))
+		remote.WithAuth(types.NewSshAuthByPassword([]byte(password)))
+
+		server.mu.Lock()
+		server.authenticatedBy = nil
+		server.mu.Unlock()
+
+		_, err := ExecuteRemoteCommandViaSSH("command", remote)
+		require.NoError(t, err)
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		require.Equal(t, []string{"publickey"}, server.authenticatedBy)
+	})
+
+	t.Run("pool", func(t *testing.T) {
+		pool, err := NewSshClientPool(SshClientPoolConfig{})
+		require.NoError(t, err)
+		defer func() {
+			_ = pool.Close()
+		}()
+
+		remote := server.remote("alice")
+		remote.AuthByPrivateKey = nil
+		remote.WithAuth(types.NewSshAuthByAgent(agentSocket), types.NewSshAuthByPassword([]byte(password)))
+		output, err := pool.ExecuteRemoteCommandViaSSH("command", remote)
+		require.NoError(t, err)
+		require.Equal(t, "echo: command", output)
+	})
+}
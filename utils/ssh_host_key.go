@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/EscanBE/go-lib/types"
+	pkgerrors "github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SshHostKeyMismatchError is returned when the host key presented by the remote server is not trusted by the host key policy
+type SshHostKeyMismatchError struct {
+	Host        string                     // host:port of the remote server
+	Policy      types.SshHostKeyPolicyType // the policy which rejected the key
+	KeyType     string                     // type of the presented key, eg: ssh-ed25519
+	Fingerprint string                     // SHA256 fingerprint of the presented key
+	Known       []string                   // SHA256 fingerprints of the trusted keys of the host, empty if the host is unknown
+}
+
+// Error implements error
+func (e *SshHostKeyMismatchError) Error() string {
+	if len(e.Known) < 1 {
+		return fmt.Sprintf("host key of [%s] is not trusted by %s policy, host is unknown, presented %s key %s", e.Host, e.Policy, e.KeyType, e.Fingerprint)
+	}
+	return fmt.Sprintf("host key of [%s] is not trusted by %s policy, presented %s key %s does not match the known keys [%s]", e.Host, e.Policy, e.KeyType, e.Fingerprint, strings.Join(e.Known, ", "))
+}
+
+// trustStoreMu serializes writes to trust-on-first-use stores
+var trustStoreMu sync.Mutex
+
+// sshHostKeyCallback returns the callback which verifies host key of the remote server following the policy,
+// and the host key algorithms to negotiate, nil = default.
+// Nil policy means known_hosts policy with default file.
+func sshHostKeyCallback(policy *types.SshHostKeyPolicy, endpoint string) (ssh.HostKeyCallback, []string, error) {
+	if policy == nil {
+		knownHostsPolicy := types.NewSshHostKeyPolicyKnownHosts()
+		policy = &knownHostsPolicy
+	}
+
+	switch policy.Type {
+	case types.SshHostKeyPolicyKnownHosts:
+		files := policy.KnownHostsFiles
+		if len(files) < 1 {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, nil, pkgerrors.Wrap(err, "failed to resolve default known_hosts file")
+			}
+			files = []string{filepath.Join(home, ".ssh", "known_hosts")}
+		}
+		callback, err := knownhosts.New(files...)
+		if err != nil {
+			return nil, nil, pkgerrors.Wrap(err, "failed to read known_hosts files")
+		}
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return asSshHostKeyMismatchError(callback(hostname, remote, key), hostname, policy.Type, key)
+		}, knownSshHostKeyAlgorithms(callback, endpoint), nil
+	case types.SshHostKeyPolicyPinned:
+		if len(policy.Fingerprints) < 1 {
+			return nil, nil, fmt.Errorf("no fingerprint was provided for pinned host key policy")
+		}
+		pinned := make([]string, len(policy.Fingerprints))
+		for i, fingerprint := range policy.Fingerprints {
+			pinned[i] = normalizeSshFingerprint(fingerprint)
+			if !isValidSshFingerprint(pinned[i]) {
+				return nil, nil, fmt.Errorf("invalid pinned fingerprint [%s], expect format SHA256:<43 base64 characters> as printed by ssh-keygen -l", fingerprint)
+			}
+		}
+		return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+			fingerprint := ssh.FingerprintSHA256(key)
+			for _, p := range pinned {
+				if p == fingerprint {
+					return nil
+				}
+			}
+			return newSshHostKeyMismatchError(hostname, policy.Type, key, pinned)
+		}, nil, nil
+	case types.SshHostKeyPolicyTrustOnFirstUse:
+		if IsBlank(policy.TrustStoreFile) {
+			return nil, nil, fmt.Errorf("no trust store file was provided for trust-on-first-use host key policy")
+		}
+		var algorithms []string
+		if callback, err := knownhosts.New(policy.TrustStoreFile); err == nil {
+			algorithms = knownSshHostKeyAlgorithms(callback, endpoint)
+		}
+		return trustOnFirstUseCallback(policy.TrustStoreFile), algorithms, nil
+	case types.SshHostKeyPolicyInsecure:
+		return ssh.InsecureIgnoreHostKey(), nil, nil
+	default:
+		return nil, nil, fmt.Errorf("not supported host key policy [%s]", policy.Type)
+	}
+}
+
+// dialSshVerifyingHostKey establishes the connection using the dial function and returns SshHostKeyMismatchError
+// if the host key was rejected, since the SSH library does not keep the error of host key verification in the chain
+func dialSshVerifyingHostKey(config *ssh.ClientConfig, dial func(config *ssh.ClientConfig) (*ssh.Client, error)) (*ssh.Client, error) {
+	var mismatchErr *SshHostKeyMismatchError
+	verifyingConfig := *config
+	verifyingConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := config.HostKeyCallback(hostname, remote, key)
+		errors.As(err, &mismatchErr)
+		return err
+	}
+
+	client, err := dial(&verifyingConfig)
+	if err != nil && mismatchErr != nil {
+		return nil, mismatchErr
+	}
+	return client, err
+}
+
+// trustOnFirstUseCallback returns the callback which persists the key of unknown hosts into the store,
+// the store is re-read at every verification, so keys persisted by other clients are respected
+func trustOnFirstUseCallback(trustStoreFile string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		trustStoreMu.Lock()
+		defer trustStoreMu.Unlock()
+
+		if err := os.MkdirAll(filepath.Dir(trustStoreFile), 0o700); err != nil {
+			return pkgerrors.Wrap(err, "failed to create directory of trust store")
+		}
+		file, err := os.OpenFile(trustStoreFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return pkgerrors.Wrap(err, "failed to open trust store")
+		}
+		//goland:noinspection GoUnhandledErrorResult
+		defer file.Close()
+
+		callback, err := knownhosts.New(trustStoreFile)
+		if err != nil {
+			return pkgerrors.Wrap(err, "failed to read trust store")
+		}
+		err = callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			return asSshHostKeyMismatchError(err, hostname, types.SshHostKeyPolicyTrustOnFirstUse, key)
+		}
+
+		// first use of an unknown host
+		if _, err := file.WriteString(knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key) + "\n"); err != nil {
+			return pkgerrors.Wrap(err, "failed to persist host key into trust store")
+		}
+		return nil
+	}
+}
+
+// knownSshHostKeyAlgorithms returns the algorithms of the keys known for the endpoint, nil if the endpoint is unknown.
+// Without it, the server may present a key of another algorithm than the known one, which would be rejected.
+func knownSshHostKeyAlgorithms(callback ssh.HostKeyCallback, endpoint string) []string {
+	probeKey, err := ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	if err != nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(callback(endpoint, &net.TCPAddr{}, probeKey), &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		if known.Key.Type() == ssh.KeyAlgoRSA {
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		algorithms = append(algorithms, known.Key.Type())
+	}
+	return algorithms
+}
+
+// asSshHostKeyMismatchError converts the error of known_hosts callback into SshHostKeyMismatchError, other errors are returned as is
+func asSshHostKeyMismatchError(err error, hostname string, policyType types.SshHostKeyPolicyType, key ssh.PublicKey) error {
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return err
+	}
+	known := make([]string, len(keyErr.Want))
+	for i, want := range keyErr.Want {
+		known[i] = ssh.FingerprintSHA256(want.Key)
+	}
+	return newSshHostKeyMismatchError(hostname, policyType, key, known)
+}
+
+// newSshHostKeyMismatchError returns SshHostKeyMismatchError for the presented key
+func newSshHostKeyMismatchError(hostname string, policyType types.SshHostKeyPolicyType, key ssh.PublicKey, known []string) *SshHostKeyMismatchError {
+	return &SshHostKeyMismatchError{
+		Host:        hostname,
+		Policy:      policyType,
+		KeyType:     key.Type(),
+		Fingerprint: ssh.FingerprintSHA256(key),
+		Known:       known,
+	}
+}
+
+// normalizeSshFingerprint converts the fingerprint into format of ssh.FingerprintSHA256, prefix and padding are optional in input
+func normalizeSshFingerprint(fingerprint string) string {
+	fingerprint = strings.TrimRight(strings.TrimSpace(fingerprint), "=")
+	if !strings.HasPrefix(fingerprint, "SHA256:") {
+		fingerprint = "SHA256:" + fingerprint
+	}
+	return fingerprint
+}
+
+// isValidSshFingerprint returns true if the normalized fingerprint is a SHA256 digest in format of ssh.FingerprintSHA256
+func isValidSshFingerprint(fingerprint string) bool {
+	encoded := strings.TrimPrefix(fingerprint, "SHA256:")
+	if len(encoded) != 43 {
+		return false
+	}
+	digest, err := base64.RawStdEncoding.DecodeString(encoded)
+	return err == nil && len(digest) == sha256.Size
+}
@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/EscanBE/go-lib/types"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestSshPublicKey returns a random ed25519 public key
+func newTestSshPublicKey(t *testing.T) ssh.PublicKey {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+	return key
+}
+
+// writeKnownHostsFile writes a known_hosts file with a line per key for the endpoint
+func writeKnownHostsFile(t *testing.T, endpoint string, keys ...ssh.PublicKey) string {
+	var sb strings.Builder
+	for _, key := range keys {
+		sb.WriteString(knownhosts.Line([]string{knownhosts.Normalize(endpoint)}, key))
+		sb.WriteString("\n")
+	}
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	require.NoError(t, os.WriteFile(file, []byte(sb.String()), 0o600))
+	return file
+}
+
+func TestExecuteRemoteCommandViaSSH_hostKeyPolicy(t *testing.T) {
+	server := newTestSshServer(t)
+	endpoint := server.remote("alice").GetEndpoint()
+	fingerprint := ssh.FingerprintSHA256(server.hostKey)
+	otherKey := newTestSshPublicKey(t)
+
+	execute := func(policy types.SshHostKeyPolicy) error {
+		remote := server.remote("alice")
+		remote.WithHostKeyPolicy(policy)
+		_, err := ExecuteRemoteCommandViaSSH("command", remote)
+		return err
+	}
+	requireMismatch := func(t *testing.T, err error, policy types.SshHostKeyPolicyType, known []string) {
+		var mismatchErr *SshHostKeyMismatchError
+		require.ErrorAs(t, err, &mismatchErr)
+		require.Equal(t, endpoint, mismatchErr.Host)
+		require.Equal(t, policy, mismatchErr.Policy)
+		require.Equal(t, ssh.KeyAlgoED25519, mismatchErr.KeyType)
+		require.Equal(t, fingerprint, mismatchErr.Fingerprint)
+		require.Equal(t, known, mismatchErr.Known)
+		require.Contains(t, err.Error(), fingerprint)
+	}
+
+	t.Run("pinned", func(t *testing.T) {
+		require.NoError(t, execute(types.NewSshHostKeyPolicyPinned(ssh.FingerprintSHA256(otherKey), fingerprint)))
+		require.NoError(t, execute(types.NewSshHostKeyPolicyPinned(strings.TrimPrefix(fingerprint, "SHA256:")+"=")), "prefix and padding are optional")
+
+		err := execute(types.NewSshHostKeyPolicyPinned(ssh.FingerprintSHA256(otherKey)))
+		requireMismatch(t, err, types.SshHostKeyPolicyPinned, []string{ssh.FingerprintSHA256(otherKey)})
+
+		require.ErrorContains(t, execute(types.NewSshHostKeyPolicyPinned()), "no fingerprint was provided")
+
+		typo := fingerprint[:len(fingerprint)-1]
+		require.ErrorContains(t, execute(types.NewSshHostKeyPolicyPinned(typo, fingerprint)), "invalid pinned fingerprint ["+typo+"]", "must not silently ignore the malformed one")
+		md5 := ssh.FingerprintLegacyMD5(server.hostKey)
+		require.ErrorContains(t, execute(types.NewSshHostKeyPolicyPinned(md5)), "invalid pinned fingerprint ["+md5+"]")
+	})
+
+	t.Run("known_hosts", func(t *testing.T) {
+		require.NoError(t, execute(types.NewSshHostKeyPolicyKnownHosts(
+			writeKnownHostsFile(t, "other-host:22", otherKey),
+			writeKnownHostsFile(t, endpoint, server.hostKey),
+		)))
+
+		err := execute(types.NewSshHostKeyPolicyKnownHosts(writeKnownHostsFile(t, endpoint, otherKey)))
+		requireMismatch(t, err, types.SshHostKeyPolicyKnownHosts, []string{ssh.FingerprintSHA256(otherKey)})
+		require.Contains(t, err.Error(), "does not match the known keys")
+
+		err = execute(types.NewSshHostKeyPolicyKnownHosts(writeKnownHostsFile(t, "other-host:22", server.hostKey)))
+		requireMismatch(t, err, types.SshHostKeyPolicyKnownHosts, []string{})
+		require.Contains(t, err.Error(), "host is unknown")
+
+		err = execute(types.NewSshHostKeyPolicyKnownHosts(filepath.Join(t.TempDir(), "not-exists")))
+		require.ErrorContains(t, err, "failed to read known_hosts files")
+	})
+
+	t.Run("known_hosts of current user by default", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+
+		remote := server.remote("alice")
+		remote.HostKeyPolicy = nil
+		_, err := ExecuteRemoteCommandViaSSH("command", remote)
+		require.ErrorContains(t, err, "failed to read known_hosts files")
+
+		require.NoError(t, os.MkdirAll(filepath.Join(home, ".ssh"), 0o700))
+		knownHosts := writeKnownHostsFile(t, endpoint, server.hostKey)
+		require.NoError(t, os.Rename(knownHosts, filepath.Join(home, ".ssh", "known_hosts")))
+		_, err = ExecuteRemoteCommandViaSSH("command", remote)
+		require.NoError(t, err)
+	})
+
+	t.Run("trust on first use", func(t *testing.T) {
+		store := filepath.Join(t.TempDir(), "sub", "trusted_hosts")
+
+		require.NoError(t, execute(types.NewSshHostKeyPolicyTrustOnFirstUse(store)), "must trust at the first use")
+		require.NoError(t, execute(types.NewSshHostKeyPolicyTrustOnFirstUse(store)), "must trust the persisted key")
+
+		content, err := os.ReadFile(store)
+		require.NoError(t, err)
+		require.Equal(t, knownhosts.Line([]string{knownhosts.Normalize(endpoint)}, server.hostKey)+"\n", string(content), "key must be persisted once")
+
+		err = execute(types.NewSshHostKeyPolicyTrustOnFirstUse(writeKnownHostsFile(t, endpoint, otherKey)))
+		requireMismatch(t, err, types.SshHostKeyPolicyTrustOnFirstUse, []string{ssh.FingerprintSHA256(otherKey)})
+
+		require.ErrorContains(t, execute(types.NewSshHostKeyPolicyTrustOnFirstUse(" ")), "no trust store file was provided")
+	})
+
+	t.Run("insecure", func(t *testing.T) {
+		require.NoError(t, execute(types.NewSshHostKeyPolicyInsecure()))
+	})
+
+	t.Run("not supported policy", func(t *testing.T) {
+		require.ErrorContains(t, execute(types.SshHostKeyPolicy{Type: "unknown"}), "not supported host key policy")
+	})
+
+	t.Run("pool", func(t *testing.T) {
+		pool, err := NewSshClientPool(SshClientPoolConfig{})
+		require.NoError(t, err)
+		defer func() {
+			_ = pool.Close()
+		}()
+
+		remote := server.remote("alice")
+		remote.WithHostKeyPolicy(types.NewSshHostKeyPolicyPinned(ssh.FingerprintSHA256(otherKey)))
+		_, err = pool.ExecuteRemoteCommandViaSSH("command", remote)
+		requireMismatch(t, err, types.SshHostKeyPolicyPinned, []string{ssh.FingerprintSHA256(otherKey)})
+	})
+}
+
+func Test_knownSshHostKeyAlgorithms(t *testing.T) {
+	ed25519Key := newTestSshPublicKey(t)
+	rsaPrivateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaKey, err := ssh.NewPublicKey(&rsaPrivateKey.PublicKey)
+	require.NoError(t, err)
+
+	callback, err := knownhosts.New(writeKnownHostsFile(t, "host:2222", ed25519Key, rsaKey))
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, []string{ssh.KeyAlgoED25519, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}, knownSshHostKeyAlgorithms(callback, "host:2222"))
+	require.Nil(t, knownSshHostKeyAlgorithms(callback, "host:22"), "unknown host must use default algorithms")
+}
+
+func Test_normalizeSshFingerprint(t *testing.T) {
+	tests := []struct {
+		fingerprint string
+		want        string
+	}{
+		{fingerprint: "SHA256:abc", want: "SHA256:abc"},
+		{fingerprint: "abc", want: "SHA256:abc"},
+		{fingerprint: " SHA256:abc= ", want: "SHA256:abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fingerprint, func(t *testing.T) {
+			require.Equal(t, tt.want, normalizeSshFingerprint(tt.fingerprint))
+		})
+	}
+}
+
+func Test_isValidSshFingerprint(t *testing.T) {
+	valid := ssh.FingerprintSHA256(newTestSshPublicKey(t))
+	tests := []struct {
+		name        string
+		fingerprint string
+		want        bool
+	}{
+		{name: "valid", fingerprint: valid, want: true},
+		{name: "too short", fingerprint: valid[:len(valid)-1]},
+		{name: "too long", fingerprint: valid + "A"},
+		{name: "not base64", fingerprint: valid[:len(valid)-1] + "!"},
+		{name: "url-safe base64", fingerprint: "SHA256:" + strings.Repeat("-", 43)},
+		{name: "MD5", fingerprint: "SHA256:16:27:ac:a5:76:28:2d:36:63:1b:56:4d:eb:df:a6:48"},
+		{name: "empty", fingerprint: "SHA256:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, isValidSshFingerprint(tt.fingerprint))
+		})
+	}
+}
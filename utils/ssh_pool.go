@@ -0,0 +1,392 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/EscanBE/go-lib/types"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSshDialTimeout is the default timeout of establishing a SSH connection, including the handshake
+	DefaultSshDialTimeout = 10 * time.Second
+
+	// DefaultSshKeepAliveInterval is the default interval which keepalive requests are sent to the remote servers
+	DefaultSshKeepAliveInterval = 30 * time.Second
+
+	// DefaultSshIdleTimeout is the default duration which a connection without running session is kept open
+	DefaultSshIdleTimeout = 5 * time.Minute
+
+	// DefaultSshMaxSessionsPerHost is the default limit of concurrent sessions per remote server, same as default MaxSessions of OpenSSH server
+	DefaultSshMaxSessionsPerHost = 10
+)
+
+// SshClientPoolConfig defines how the SshClientPool manages connections, zero values are replaced by defaults
+type SshClientPoolConfig struct {
+	DialTimeout        time.Duration // timeout of establishing a connection, including the handshake
+	KeepAliveInterval  time.Duration // interval of keepalive requests, negative = disabled
+	IdleTimeout        time.Duration // connections without running session for that long are closed
+	MaxSessionsPerHost int           // limit of concurrent sessions per remote server, callers wait for a free slot
+}
+
+// SshClientPool keeps SSH connections open and reuses them to execute commands,
+// one connection per remote endpoint, user, authentication credentials and host key policy.
+// Broken connections, detected by keepalive or when failed to open a session, are re-established,
+// sessions rejected by the remote server are reported without closing the connection.
+// Host keys are verified the same way as ExecuteRemoteCommandViaSSH, known_hosts of current user by default.
+// It is safe for concurrent use.
+type SshClientPool struct {
+	config SshClientPoolConfig
+
+	mu          sync.Mutex
+	entries     map[string]*sshPoolEntry // by sshPoolKey
+	closed      bool
+	stopJanitor chan struct{}
+}
+
+// sshPoolEntry holds the connection to a remote endpoint of a user
+type sshPoolEntry struct {
+	slots  chan struct{} // semaphore which limits concurrent sessions
+	dialMu sync.Mutex    // only one connection is established at a time
+
+	// below fields are guarded by the lock of the pool
+	client   *ssh.Client // nil if not connected
+	active   int         // number of executions holding the entry, including the ones waiting for a slot
+	lastUsed time.Time
+}
+
+// NewSshClientPool returns a SshClientPool, which should be closed when no longer needed
+func NewSshClientPool(config SshClientPoolConfig) (*SshClientPool, error) {
+	if config.DialTimeout < 0 {
+		return nil, fmt.Errorf("invalid dial timeout %s", config.DialTimeout)
+	} else if config.DialTimeout == 0 {
+		config.DialTimeout = DefaultSshDialTimeout
+	}
+	if config.KeepAliveInterval == 0 {
+		config.KeepAliveInterval = DefaultSshKeepAliveInterval
+	}
+	if config.IdleTimeout < 0 {
+		return nil, fmt.Errorf("invalid idle timeout %s", config.IdleTimeout)
+	} else if config.IdleTimeout == 0 {
+		config.IdleTimeout = DefaultSshIdleTimeout
+	}
+	if config.MaxSessionsPerHost < 0 {
+		return nil, fmt.Errorf("invalid max sessions per host %d", config.MaxSessionsPerHost)
+	} else if config.MaxSessionsPerHost == 0 {
+		config.MaxSessionsPerHost = DefaultSshMaxSessionsPerHost
+	}
+
+	pool := &SshClientPool{
+		config:      config,
+		entries:     make(map[string]*sshPoolEntry),
+		stopJanitor: make(chan struct{}),
+	}
+	go pool.evictIdleClients()
+	return pool, nil
+}
+
+// ExecuteRemoteCommandViaSSH performs execution of remote command on target server using a pooled connection,
+// it returns the output string of the execution and an error if any
+func (p *SshClientPool) ExecuteRemoteCommandViaSSH(remoteCommand string, remoteServer *types.SshRemote) (string, error) {
+	return p.ExecuteRemoteCommandViaSSHWithContext(context.Background(), remoteCommand, remoteServer)
+}
+
+// ExecuteRemoteCommandViaSSHWithContext performs execution of remote command on target server using a pooled connection,
+// it returns the output string of the execution and an error if any.
+// The context bounds waiting for a free session slot, connecting, and the execution which is interrupted when the context is done.
+func (p *SshClientPool) ExecuteRemoteCommandViaSSHWithContext(ctx context.Context, remoteCommand string, remoteServer *types.SshRemote) (string, error) {
+	if remoteServer == nil {
+		panic("remote server is required")
+	}
+	if IsBlank(remoteCommand) {
+		return "", fmt.Errorf("no command was provided")
+	}
+	if err := validateSshRemote(remoteServer); err != nil {
+		return "", err
+	}
+
+	entry, err := p.acquireEntry(sshPoolKey(remoteServer))
+	if err != nil {
+		return "", err
+	}
+	defer p.markActive(entry, -1)
+
+	select {
+	case entry.slots <- struct{}{}:
+	case <-ctx.Done():
+		return "", errors.Wrap(ctx.Err(), "failed to wait for a free SSH session slot")
+	}
+	defer func() {
+		<-entry.slots
+	}()
+
+	var sessionErr error
+	for attempt := 0; attempt < 2; attempt++ { // reconnect once if the pooled connection is broken
+		client, err := p.client(ctx, entry, remoteServer)
+		if err != nil {
+			return "", err
+		}
+
+		session, err := client.NewSession()
+		if err != nil {
+			var openChannelErr *ssh.OpenChannelError
+			if errors.As(err, &openChannelErr) {
+				// rejected by the remote server, eg: too many sessions, the connection is still usable
+				return "", errors.Wrap(err, "failed to start a new SSH session")
+			}
+			sessionErr = err
+			p.discard(entry, client)
+			continue
+		}
+		return runSshSession(ctx, session, remoteCommand)
+	}
+	return "", errors.Wrap(sessionErr, "failed to start a new SSH session")
+}
+
+// Close closes all the connections, the pool can not be used anymore
+func (p *SshClientPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.stopJanitor)
+
+	var clients []*ssh.Client
+	for _, entry := range p.entries {
+		if entry.client != nil {
+			clients = append(clients, entry.client)
+			entry.client = nil
+		}
+	}
+	p.mu.Unlock()
+
+	for _, client := range clients {
+		//goland:noinspection GoUnhandledErrorResult
+		client.Close()
+	}
+	return nil
+}
+
+// sshPoolKey returns the key of the pooled connection of the remote server.
+// Fingerprint of the auth methods and the host key policy are parts of the key,
+// so a connection is never reused by executions of other credentials or verified by another policy.
+func sshPoolKey(remoteServer *types.SshRemote) string {
+	key := fmt.Sprintf("%s@%s %s", remoteServer.Username, remoteServer.GetEndpoint(), remoteServer.AuthFingerprint())
+	if policy := remoteServer.HostKeyPolicy; policy != nil {
+		key += fmt.Sprintf(" %s %q %q %q", policy.Type, policy.KnownHostsFiles, policy.Fingerprints, policy.TrustStoreFile)
+	}
+	return key
+}
+
+// acquireEntry returns the entry of the key, creates if not exists, and marks it active so it is not pruned.
+// Caller must release it by markActive(entry, -1).
+func (p *SshClientPool) acquireEntry(key string) (*sshPoolEntry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, fmt.Errorf("SSH client pool is closed")
+	}
+	entry, found := p.entries[key]
+	if !found {
+		entry = &sshPoolEntry{
+			slots: make(chan struct{}, p.config.MaxSessionsPerHost),
+		}
+		p.entries[key] = entry
+	}
+	entry.active++
+	entry.lastUsed = time.Now()
+	return entry, nil
+}
+
+// markActive adds delta to the number of executions holding the entry
+func (p *SshClientPool) markActive(entry *sshPoolEntry, delta int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry.active += delta
+	entry.lastUsed = time.Now()
+}
+
+// client returns the pooled connection of the entry, connects if not connected.
+// Authentication methods are only prepared when connecting and released right after that.
+func (p *SshClientPool) client(ctx context.Context, entry *sshPoolEntry, remoteServer *types.SshRemote) (*ssh.Client, error) {
+	entry.dialMu.Lock()
+	defer entry.dialMu.Unlock()
+
+	p.mu.Lock()
+	client, closed := entry.client, p.closed
+	p.mu.Unlock()
+	if closed {
+		return nil, fmt.Errorf("SSH client pool is closed")
+	}
+	if client != nil {
+		return client, nil
+	}
+
+	auth, release, err := sshAuthMethods(remoteServer)
+	if err != nil {
+		return nil, err
+	}
+	config, err := newSshClientConfig(remoteServer, auth)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	client, err = dialSshVerifyingHostKey(config, func(config *ssh.ClientConfig) (*ssh.Client, error) {
+		return dialSsh(ctx, remoteServer.GetEndpoint(), config, p.config.DialTimeout)
+	})
+	release()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to remote server")
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		//goland:noinspection GoUnhandledErrorResult
+		client.Close()
+		return nil, fmt.Errorf("SSH client pool is closed")
+	}
+	entry.client = client
+	p.mu.Unlock()
+
+	go p.watchClient(entry, client)
+	return client, nil
+}
+
+// dialSsh establishes a SSH connection, the timeout covers both connecting and the handshake
+func dialSsh(ctx context.Context, endpoint string, config *ssh.ClientConfig, timeout time.Duration) (*ssh.Client, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		//goland:noinspection GoUnhandledErrorResult
+		conn.Close()
+		return nil, err
+	}
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, endpoint, config)
+	if err != nil {
+		//goland:noinspection GoUnhandledErrorResult
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		//goland:noinspection GoUnhandledErrorResult
+		clientConn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, channels, requests), nil
+}
+
+// watchClient sends keepalive requests until the connection is closed, then removes it from the pool.
+// Connections which do not reply to keepalive within the interval are considered broken and closed.
+func (p *SshClientPool) watchClient(entry *sshPoolEntry, client *ssh.Client) {
+	closed := make(chan struct{})
+	go func() {
+		//goland:noinspection GoUnhandledErrorResult
+		client.Wait()
+		close(closed)
+	}()
+
+	if p.config.KeepAliveInterval > 0 {
+		ticker := time.NewTicker(p.config.KeepAliveInterval)
+		defer ticker.Stop()
+
+	keepAlive:
+		for {
+			select {
+			case <-closed:
+				break keepAlive
+			case <-ticker.C:
+				if !sendSshKeepAlive(client, p.config.KeepAliveInterval) {
+					//goland:noinspection GoUnhandledErrorResult
+					client.Close()
+					break keepAlive
+				}
+			}
+		}
+	}
+
+	<-closed
+	p.discard(entry, client)
+}
+
+// sendSshKeepAlive returns true if the remote server replied to the keepalive request within the timeout
+func sendSshKeepAlive(client *ssh.Client, timeout time.Duration) bool {
+	replied := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		replied <- err
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-replied:
+		return err == nil
+	case <-timer.C:
+		return false
+	}
+}
+
+// discard removes the connection from the pool if it is still the pooled one of the entry, then closes it
+func (p *SshClientPool) discard(entry *sshPoolEntry, client *ssh.Client) {
+	p.mu.Lock()
+	if entry.client == client {
+		entry.client = nil
+	}
+	p.mu.Unlock()
+
+	//goland:noinspection GoUnhandledErrorResult
+	client.Close()
+}
+
+// evictIdleClients periodically closes the connections without running session for longer than the idle timeout,
+// and removes the entries which are neither connected nor held by any execution, until the pool closed
+func (p *SshClientPool) evictIdleClients() {
+	interval := p.config.IdleTimeout / 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopJanitor:
+			return
+		case <-ticker.C:
+			var idleClients []*ssh.Client
+			p.mu.Lock()
+			for key, entry := range p.entries {
+				if entry.active > 0 {
+					continue
+				}
+				if entry.client != nil && time.Since(entry.lastUsed) >= p.config.IdleTimeout {
+					idleClients = append(idleClients, entry.client)
+					entry.client = nil
+				}
+				if entry.client == nil {
+					delete(p.entries, key)
+				}
+			}
+			p.mu.Unlock()
+
+			for _, client := range idleClients {
+				//goland:noinspection GoUnhandledErrorResult
+				client.Close()
+			}
+		}
+	}
+}
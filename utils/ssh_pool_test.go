@@ -0,0 +1,562 @@
+package utils
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/EscanBE/go-lib/types"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSshServer is an in-process SSH server, which replies to `exec` requests with `echo: <command>`.
+// Command `block` runs until the server is unblocked, so concurrent sessions can be observed.
+type testSshServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	hostKey  ssh.PublicKey
+
+	mu                    sync.Mutex
+	conns                 []net.Conn
+	handshakes            int
+	runningSessions       int
+	maxConcurrentSessions int
+	openSessions          int
+	sessionsLimit         int // channels beyond the limit of open sessions are rejected, zero = unlimited
+	unblock               chan struct{}
+	ignoreKeepAlive       bool
+	authenticatedBy       []string // the method of each successful authentication
+}
+
+// newTestSshServer starts a SSH server on a random local port, stopped when the test finished.
+// It accepts any public key unless the authentication is configured.
+func newTestSshServer(t *testing.T, configureAuth ...func(config *ssh.ServerConfig)) *testSshServer {
+	_, hostPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivateKey)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	for _, configure := range configureAuth {
+		configure(config)
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &testSshServer{
+		listener: listener,
+		config:   config,
+		hostKey:  hostSigner.PublicKey(),
+		unblock:  make(chan struct{}),
+	}
+	config.AuthLogCallback = func(_ ssh.ConnMetadata, method string, err error) {
+		if err == nil {
+			server.mu.Lock()
+			server.authenticatedBy = append(server.authenticatedBy, method)
+			server.mu.Unlock()
+		}
+	}
+	t.Cleanup(server.stop)
+	go server.serve()
+	return server
+}
+
+// remote returns the remote server info to connect to the test server, with private key auth and the host key pinned
+func (s *testSshServer) remote(username string) *types.SshRemote {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	hostKeyPolicy := types.NewSshHostKeyPolicyPinned(ssh.FingerprintSHA256(s.hostKey))
+	return &types.SshRemote{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		AuthByPrivateKey: &types.SshAuthPrivateKey{
+			PrivateKey: []byte(testPk),
+			Passphrase: []byte(passphraseTestPk),
+		},
+		HostKeyPolicy: &hostKeyPolicy,
+	}
+}
+
+func (s *testSshServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		go s.handleConn(conn)
+	}
+}
+
+func (s *testSshServer) handleConn(conn net.Conn) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer serverConn.Close()
+
+	s.mu.Lock()
+	s.handshakes++
+	s.mu.Unlock()
+
+	go func() {
+		for req := range requests {
+			s.mu.Lock()
+			ignore := s.ignoreKeepAlive
+			s.mu.Unlock()
+			if !ignore && req.WantReply {
+				_ = req.Reply(true, nil)
+			}
+		}
+	}()
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "not supported")
+			continue
+		}
+		s.mu.Lock()
+		reject := s.sessionsLimit > 0 && s.openSessions >= s.sessionsLimit
+		if !reject {
+			s.openSessions++
+		}
+		s.mu.Unlock()
+		if reject {
+			_ = newChannel.Reject(ssh.ResourceShortage, "too many sessions")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			s.mu.Lock()
+			s.openSessions--
+			s.mu.Unlock()
+			continue
+		}
+		go s.handleSession(channel, channelRequests)
+	}
+}
+
+func (s *testSshServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	//goland:noinspection GoUnhandledErrorResult
+	defer channel.Close()
+	defer func() {
+		s.mu.Lock()
+		s.openSessions--
+		s.mu.Unlock()
+	}()
+
+	for req := range requests {
+		if req.Type != "exec" {
+			_ = req.Reply(false, nil)
+			continue
+		}
+		_ = req.Reply(true, nil)
+
+		command := string(req.Payload[4:]) // string payload is prefixed by its length
+
+		s.mu.Lock()
+		s.runningSessions++
+		if s.runningSessions > s.maxConcurrentSessions {
+			s.maxConcurrentSessions = s.runningSessions
+		}
+		unblock := s.unblock
+		s.mu.Unlock()
+
+		if command == "block" {
+			<-unblock
+		}
+		_, _ = fmt.Fprintf(channel, "echo: %s", command)
+
+		s.mu.Lock()
+		s.runningSessions--
+		s.mu.Unlock()
+
+		exitStatus := make([]byte, 4)
+		binary.BigEndian.PutUint32(exitStatus, 0)
+		_, _ = channel.SendRequest("exit-status", false, exitStatus)
+		return
+	}
+}
+
+// dropConnections closes all the established connections from the server side
+func (s *testSshServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
+
+// stats returns number of handshakes and the max number of concurrent sessions
+func (s *testSshServer) stats() (handshakes, maxConcurrentSessions int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handshakes, s.maxConcurrentSessions
+}
+
+func (s *testSshServer) stop() {
+	_ = s.listener.Close()
+	s.mu.Lock()
+	select {
+	case <-s.unblock:
+	default:
+		close(s.unblock)
+	}
+	s.mu.Unlock()
+	s.dropConnections()
+}
+
+// pooledClients returns the number of connected entries of the pool
+func (p *SshClientPool) pooledClients() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cnt := 0
+	for _, entry := range p.entries {
+		if entry.client != nil {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// entriesCount returns the number of entries of the pool, connected or not
+func (p *SshClientPool) entriesCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.entries)
+}
+
+func TestNewSshClientPool(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  SshClientPoolConfig
+		wantErr string
+	}{
+		{name: "default", config: SshClientPoolConfig{}},
+		{name: "keepalive disabled", config: SshClientPoolConfig{KeepAliveInterval: -1}},
+		{name: "negative dial timeout", config: SshClientPoolConfig{DialTimeout: -1}, wantErr: "invalid dial timeout"},
+		{name: "negative idle timeout", config: SshClientPoolConfig{IdleTimeout: -1}, wantErr: "invalid idle timeout"},
+		{name: "negative max sessions", config: SshClientPoolConfig{MaxSessionsPerHost: -1}, wantErr: "invalid max sessions per host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := NewSshClientPool(tt.config)
+			if len(tt.wantErr) > 0 {
+				require.ErrorContains(t, err, tt.wantErr)
+				require.Nil(t, pool)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, DefaultSshDialTimeout, pool.config.DialTimeout)
+			require.Equal(t, DefaultSshIdleTimeout, pool.config.IdleTimeout)
+			require.Equal(t, DefaultSshMaxSessionsPerHost, pool.config.MaxSessionsPerHost)
+			require.NoError(t, pool.Close())
+		})
+	}
+}
+
+func TestSshClientPool_ExecuteRemoteCommandViaSSH(t *testing.T) {
+	server := newTestSshServer(t, func(config *ssh.ServerConfig) {
+		config.PasswordCallback = func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		}
+	})
+
+	pool, err := NewSshClientPool(SshClientPoolConfig{})
+	require.NoError(t, err)
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	t.Run("reuse connection", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			output, err := pool.ExecuteRemoteCommandViaSSH(fmt.Sprintf("command %d", i), server.remote("alice"))
+			require.NoError(t, err)
+			require.Equal(t, fmt.Sprintf("echo: command %d", i), output)
+		}
+		handshakes, _ := server.stats()
+		require.Equal(t, 1, handshakes, "connection must be reused")
+
+		_, err := pool.ExecuteRemoteCommandViaSSH("other user", server.remote("bob"))
+		require.NoError(t, err)
+		handshakes, _ = server.stats()
+		require.Equal(t, 2, handshakes, "connection is per user")
+		require.Equal(t, 2, pool.pooledClients())
+	})
+
+	t.Run("reconnect broken connection", func(t *testing.T) {
+		server.dropConnections()
+		require.Eventually(t, func() bool {
+			return pool.pooledClients() == 0
+		}, 30*time.Second, 10*time.Millisecond, "closed connections must be removed from the pool")
+
+		output, err := pool.ExecuteRemoteCommandViaSSH("after reconnect", server.remote("alice"))
+		require.NoError(t, err)
+		require.Equal(t, "echo: after reconnect", output)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		_, err := pool.ExecuteRemoteCommandViaSSH(" ", server.remote("alice"))
+		require.ErrorContains(t, err, "no command was provided")
+
+		remote := server.remote("carol")
+		remote.AuthByPrivateKey = nil
+		_, err = pool.ExecuteRemoteCommandViaSSH("command", remote)
+		require.ErrorContains(t, err, "not supported authentication type")
+
+		remote = server.remote("alice")
+		remote.AuthByPrivateKey = nil
+		_, err = pool.ExecuteRemoteCommandViaSSH("command", remote)
+		require.ErrorContains(t, err, "not supported authentication type", "connection of other credentials must not be reused")
+
+		remote = server.remote("")
+		_, err = pool.ExecuteRemoteCommandViaSSH("command", remote)
+		require.ErrorContains(t, err, "no username was provided")
+
+		require.Panics(t, func() {
+			_, _ = pool.ExecuteRemoteCommandViaSSH("command", nil)
+		})
+	})
+
+	t.Run("connection is per host key policy", func(t *testing.T) {
+		handshakes, _ := server.stats()
+
+		otherFingerprint := ssh.FingerprintSHA256(newTestSshPublicKey(t))
+		remote := server.remote("alice")
+		remote.WithHostKeyPolicy(types.NewSshHostKeyPolicyPinned(otherFingerprint))
+		_, err := pool.ExecuteRemoteCommandViaSSH("command", remote)
+		var mismatchErr *SshHostKeyMismatchError
+		require.ErrorAs(t, err, &mismatchErr, "connection verified by another policy must not be reused")
+
+		remote.WithHostKeyPolicy(types.NewSshHostKeyPolicyPinned(otherFingerprint, ssh.FingerprintSHA256(server.hostKey)))
+		_, err = pool.ExecuteRemoteCommandViaSSH("command", remote)
+		require.NoError(t, err)
+		_, err = pool.ExecuteRemoteCommandViaSSH("command", remote)
+		require.NoError(t, err)
+
+		newHandshakes, _ := server.stats()
+		require.Equal(t, handshakes+1, newHandshakes, "connection of the same policy must be reused")
+	})
+
+	t.Run("connection is per credentials", func(t *testing.T) {
+		handshakes, _ := server.stats()
+
+		remote := server.remote("alice")
+		remote.AuthByPrivateKey = nil
+		remote.WithAuth(types.NewSshAuthByPassword([]byte("password")))
+		_, err := pool.ExecuteRemoteCommandViaSSH("command", remote)
+		require.NoError(t, err)
+
+		remote.AuthMethods = []types.SshAuth{types.NewSshAuthByPassword([]byte("other password"))}
+		_, err = pool.ExecuteRemoteCommandViaSSH("command", remote)
+		require.NoError(t, err)
+		_, err = pool.ExecuteRemoteCommandViaSSH("command", remote)
+		require.NoError(t, err)
+
+		newHandshakes, _ := server.stats()
+		require.Equal(t, handshakes+2, newHandshakes, "connection must be reused only by the same credentials")
+		server.mu.Lock()
+		require.Equal(t, []string{"password", "password"}, server.authenticatedBy[len(server.authenticatedBy)-2:])
+		server.mu.Unlock()
+	})
+
+	t.Run("failed to connect", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		remote := server.remote("alice")
+		_, remote.Port, _ = net.SplitHostPort(listener.Addr().String())
+		require.NoError(t, listener.Close())
+
+		_, err = pool.ExecuteRemoteCommandViaSSH("command", remote)
+		require.ErrorContains(t, err, "failed to connect to remote server")
+	})
+}
+
+func TestSshClientPool_MaxSessionsPerHost(t *testing.T) {
+	server := newTestSshServer(t)
+
+	pool, err := NewSshClientPool(SshClientPoolConfig{MaxSessionsPerHost: 2})
+	require.NoError(t, err)
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	results := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, err := pool.ExecuteRemoteCommandViaSSH("block", server.remote("alice"))
+			results <- err
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		_, maxConcurrentSessions := server.stats()
+		return maxConcurrentSessions == 2
+	}, 30*time.Second, 10*time.Millisecond)
+
+	t.Run("waiting for a free slot is bounded by the context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := pool.ExecuteRemoteCommandViaSSHWithContext(ctx, "command", server.remote("alice"))
+		require.ErrorContains(t, err, "failed to wait for a free SSH session slot")
+	})
+
+	server.mu.Lock()
+	close(server.unblock)
+	server.mu.Unlock()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, <-results)
+	}
+
+	handshakes, maxConcurrentSessions := server.stats()
+	require.Equal(t, 2, maxConcurrentSessions, "concurrent sessions must be capped")
+	require.Equal(t, 1, handshakes, "sessions must share the connection")
+}
+
+func TestSshClientPool_SessionRejected(t *testing.T) {
+	server := newTestSshServer(t)
+	server.sessionsLimit = 1
+
+	pool, err := NewSshClientPool(SshClientPoolConfig{})
+	require.NoError(t, err)
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	result := make(chan error, 1)
+	go func() {
+		output, err := pool.ExecuteRemoteCommandViaSSH("block", server.remote("alice"))
+		if err == nil && output != "echo: block" {
+			err = fmt.Errorf("unexpected output %s", output)
+		}
+		result <- err
+	}()
+	require.Eventually(t, func() bool {
+		_, maxConcurrentSessions := server.stats()
+		return maxConcurrentSessions == 1
+	}, 30*time.Second, 10*time.Millisecond)
+
+	_, err = pool.ExecuteRemoteCommandViaSSH("command", server.remote("alice"))
+	var openChannelErr *ssh.OpenChannelError
+	require.ErrorAs(t, err, &openChannelErr)
+	require.Equal(t, ssh.ResourceShortage, openChannelErr.Reason)
+	require.Equal(t, 1, pool.pooledClients(), "connection must be kept when the session is rejected")
+
+	server.mu.Lock()
+	close(server.unblock)
+	server.mu.Unlock()
+	require.NoError(t, <-result, "session in flight must not be interrupted")
+
+	_, err = pool.ExecuteRemoteCommandViaSSH("command", server.remote("alice"))
+	require.NoError(t, err)
+	handshakes, _ := server.stats()
+	require.Equal(t, 1, handshakes, "connection must be reused after the session was rejected")
+}
+
+func TestSshClientPool_IdleEviction(t *testing.T) {
+	server := newTestSshServer(t)
+
+	pool, err := NewSshClientPool(SshClientPoolConfig{IdleTimeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	_, err = pool.ExecuteRemoteCommandViaSSH("command", server.remote("alice"))
+	require.NoError(t, err)
+	require.Equal(t, 1, pool.pooledClients())
+
+	require.Eventually(t, func() bool {
+		return pool.pooledClients() == 0
+	}, 30*time.Second, 10*time.Millisecond, "idle connection must be closed")
+	require.Eventually(t, func() bool {
+		return pool.entriesCount() == 0
+	}, 30*time.Second, 10*time.Millisecond, "entry of evicted connection must be removed")
+
+	_, err = pool.ExecuteRemoteCommandViaSSH("command", server.remote("alice"))
+	require.NoError(t, err)
+	handshakes, _ := server.stats()
+	require.Equal(t, 2, handshakes)
+}
+
+func TestSshClientPool_KeepAlive(t *testing.T) {
+	server := newTestSshServer(t)
+
+	pool, err := NewSshClientPool(SshClientPoolConfig{KeepAliveInterval: 20 * time.Millisecond})
+	require.NoError(t, err)
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	_, err = pool.ExecuteRemoteCommandViaSSH("command", server.remote("alice"))
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 1, pool.pooledClients(), "connection replying keepalive must be kept")
+
+	server.mu.Lock()
+	server.ignoreKeepAlive = true
+	server.mu.Unlock()
+	require.Eventually(t, func() bool {
+		return pool.pooledClients() == 0
+	}, 30*time.Second, 10*time.Millisecond, "connection not replying keepalive must be closed")
+}
+
+func TestSshClientPool_Close(t *testing.T) {
+	server := newTestSshServer(t)
+
+	pool, err := NewSshClientPool(SshClientPoolConfig{})
+	require.NoError(t, err)
+
+	_, err = pool.ExecuteRemoteCommandViaSSH("command", server.remote("alice"))
+	require.NoError(t, err)
+
+	require.NoError(t, pool.Close())
+	require.NoError(t, pool.Close(), "must be idempotent")
+	require.Zero(t, pool.pooledClients())
+
+	_, err = pool.ExecuteRemoteCommandViaSSH("command", server.remote("alice"))
+	require.ErrorContains(t, err, "pool is closed")
+}
+
+func Test_executeRemoteCommandViaSSH_closesClient(t *testing.T) {
+	server := newTestSshServer(t)
+	remote := server.remote("alice")
+	auth, release, err := sshAuthMethods(remote)
+	require.NoError(t, err)
+	defer release()
+
+	output, err := executeRemoteCommandViaSSH("command", remote, auth)
+	require.NoError(t, err)
+	require.Equal(t, "echo: command", output)
+
+	require.Eventually(t, func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		for _, conn := range server.conns {
+			// reading from a connection closed by the client returns immediately
+			_ = conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+			if _, err := conn.Read(make([]byte, 1)); err == nil || strings.Contains(err.Error(), "timeout") {
+				return false
+			}
+		}
+		return true
+	}, 30*time.Second, 20*time.Millisecond, "connection must be closed after the execution")
+}
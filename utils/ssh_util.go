@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/EscanBE/go-lib/types"
 	"github.com/pkg/errors"
@@ -9,96 +10,102 @@ import (
 	"strconv"
 )
 
-// ExecuteRemoteCommandViaSSH performs execution of remote command on target server,
-// it returns the output string of the execution and an error if any
+// ExecuteRemoteCommandViaSSH performs execution of remote command on target server using a new connection,
+// it returns the output string of the execution and an error if any.
+// Use SshClientPool to reuse connections across executions.
+//
+// BREAKING CHANGE: host key is verified by known_hosts of current user when the remote server has no host key policy,
+// unknown hosts are rejected instead of being accepted, see types.SshRemote.
 func ExecuteRemoteCommandViaSSH(remoteCommand string, remoteServer *types.SshRemote) (string, error) {
 	if remoteServer == nil {
 		panic("remote server is required")
 	}
-	if remoteServer.IsAuthByPrivateKey() {
-		return executeRemoteCommandViaSSHUsingPrivateKey(remoteCommand, remoteServer)
+	auth, release, err := sshAuthMethods(remoteServer)
+	if err != nil {
+		return "", err
 	}
+	defer release()
 
-	return "", fmt.Errorf("not supported authentication type or none provided")
+	return executeRemoteCommandViaSSH(remoteCommand, remoteServer, auth)
 }
 
-// executeRemoteCommandViaSSHUsingPrivateKey performs execution of remote command on target server,
-// using private key authentication method,
+// executeRemoteCommandViaSSH performs execution of remote command on target server,
+// using a new connection which is closed after the execution,
 // it returns the output string of the execution and an error if any
-func executeRemoteCommandViaSSHUsingPrivateKey(remoteCommand string, remoteServer *types.SshRemote) (stdOut string, resErr error) {
-	if remoteServer.AuthByPrivateKey == nil {
-		return "", fmt.Errorf("not a SSH auth by private key (not supplied)")
+func executeRemoteCommandViaSSH(remoteCommand string, remoteServer *types.SshRemote, auth []ssh.AuthMethod) (string, error) {
+	if IsBlank(remoteCommand) {
+		return "", fmt.Errorf("no command was provided")
 	}
-	if len(remoteServer.AuthByPrivateKey.PrivateKey) < 24 {
-		return "", fmt.Errorf("bad private key")
+	config, err := newSshClientConfig(remoteServer, auth)
+	if err != nil {
+		return "", err
 	}
 
-	var key ssh.Signer
-	var err error
-	if len(remoteServer.AuthByPrivateKey.Passphrase) > 0 {
-		key, err = ssh.ParsePrivateKeyWithPassphrase(remoteServer.AuthByPrivateKey.PrivateKey, remoteServer.AuthByPrivateKey.Passphrase)
-	} else {
-		key, err = ssh.ParsePrivateKey(remoteServer.AuthByPrivateKey.PrivateKey)
-	}
+	// Connect
+	client, err := dialSshVerifyingHostKey(config, func(config *ssh.ClientConfig) (*ssh.Client, error) {
+		return ssh.Dial("tcp", remoteServer.GetEndpoint(), config)
+	})
 	if err != nil {
-		return "", errors.Wrap(err, "failed to decrypt SSH private key")
-	}
-	auth := []ssh.AuthMethod{
-		ssh.PublicKeys(key),
+		return "", errors.Wrap(err, "failed to connect to remote server")
 	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer client.Close()
 
-	return executeRemoteCommandViaSSH(remoteCommand, remoteServer, auth)
+	// Create a session. It is one session per command.
+	session, err := client.NewSession()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to start a new SSH session")
+	}
+	return runSshSession(context.Background(), session, remoteCommand)
 }
 
-// executeRemoteCommandViaSSHUsingPrivateKey performs execution of remote command on target server,
-// using private key authentication method,
-// it returns the output string of the execution and an error if any
-func executeRemoteCommandViaSSH(remoteCommand string, remoteServer *types.SshRemote, auth []ssh.AuthMethod) (string, error) {
-	if IsBlank(remoteCommand) {
-		return "", fmt.Errorf("no command was provided")
-	}
+// validateSshRemote returns error if the host, port or username of the remote server is invalid
+func validateSshRemote(remoteServer *types.SshRemote) error {
 	if IsBlank(remoteServer.Host) {
-		return "", fmt.Errorf("no remote host was provided")
+		return fmt.Errorf("no remote host was provided")
 	}
 	if IsBlank(remoteServer.Port) {
-		return "", fmt.Errorf("no SSH port was provided")
+		return fmt.Errorf("no SSH port was provided")
 	}
 	portNo, errPort := strconv.ParseInt(remoteServer.Port, 10, 32)
 	if errPort != nil {
-		return "", errors.Wrap(errPort, "supplied SSH port is invalid format")
+		return errors.Wrap(errPort, "supplied SSH port is invalid format")
 	}
 	if portNo < 1 || portNo > 65535 {
-		return "", fmt.Errorf("bad SSH port no.%d", portNo)
+		return fmt.Errorf("bad SSH port no.%d", portNo)
 	}
 	if IsBlank(remoteServer.Username) {
-		return "", fmt.Errorf("no username was provided")
-	}
-	if len(auth) < 1 {
-		return "", fmt.Errorf("no auth was provided")
+		return fmt.Errorf("no username was provided")
 	}
+	return nil
+}
 
-	// Authentication
-	//goland:noinspection SpellCheckingInspection
-	config := &ssh.ClientConfig{
-		User: remoteServer.Username,
-		// https://github.com/golang/go/issues/19767
-		// as clientConfig is non-permissive by default
-		// you can set ssh.InsercureIgnoreHostKey to allow any host
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Auth:            auth,
+// newSshClientConfig validates the remote server then returns the client config to connect to it
+func newSshClientConfig(remoteServer *types.SshRemote, auth []ssh.AuthMethod) (*ssh.ClientConfig, error) {
+	if err := validateSshRemote(remoteServer); err != nil {
+		return nil, err
 	}
-
-	// Connect
-	client, err := ssh.Dial("tcp", remoteServer.GetEndpoint(), config)
-	if err != nil {
-		return "", errors.Wrap(err, "failed to connect to remote server")
+	if len(auth) < 1 {
+		return nil, fmt.Errorf("no auth was provided")
 	}
 
-	// Create a session. It is one session per command.
-	session, err := client.NewSession()
+	hostKeyCallback, hostKeyAlgorithms, err := sshHostKeyCallback(remoteServer.HostKeyPolicy, remoteServer.GetEndpoint())
 	if err != nil {
-		return "", errors.Wrap(err, "failed to start a new SSH session")
+		return nil, errors.Wrap(err, "failed to prepare host key verification")
 	}
+
+	// Authentication
+	return &ssh.ClientConfig{
+		User:              remoteServer.Username,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		Auth:              auth,
+	}, nil
+}
+
+// runSshSession runs the command on the session then closes it, it returns the output string of the execution and an error if any.
+// The session is closed early when the context is done.
+func runSshSession(ctx context.Context, session *ssh.Session, remoteCommand string) (string, error) {
 	//goland:noinspection GoUnhandledErrorResult
 	defer session.Close()
 	var b bytes.Buffer  // import "bytes"
@@ -107,8 +114,24 @@ func executeRemoteCommandViaSSH(remoteCommand string, remoteServer *types.SshRem
 	// content from client to server
 	//      session.Stdin = bytes.NewBufferString("My input")
 
+	if ctxDone := ctx.Done(); ctxDone != nil {
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-ctxDone:
+				//goland:noinspection GoUnhandledErrorResult
+				session.Close()
+			case <-finished:
+			}
+		}()
+	}
+
 	// Finally, run the command
-	err = session.Run(remoteCommand)
+	err := session.Run(remoteCommand)
+	if ctxErr := ctx.Err(); ctxErr != nil && err != nil {
+		return b.String(), errors.Wrap(ctxErr, "command was interrupted")
+	}
 	return b.String(), err
 }
 
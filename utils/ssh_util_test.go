@@ -134,7 +134,7 @@ func TestExecuteRemoteCommandViaSSH(t *testing.T) {
 	}
 }
 
-func Test_executeRemoteCommandViaSSHUsingPrivateKey(t *testing.T) {
+func TestExecuteRemoteCommandViaSSH_privateKey(t *testing.T) {
 	tests := []struct {
 		name          string
 		remoteCommand string
@@ -145,7 +145,7 @@ func Test_executeRemoteCommandViaSSHUsingPrivateKey(t *testing.T) {
 			name:          "require private key",
 			remoteCommand: "sudo reboot",
 			remoteServer:  generateRemoteServer(nil, nil),
-			wantErrMsg:    "not a SSH auth by private key",
+			wantErrMsg:    "not supported authentication type or none provided",
 		},
 		{
 			name:          "bad private key",
@@ -174,10 +174,10 @@ func Test_executeRemoteCommandViaSSHUsingPrivateKey(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := executeRemoteCommandViaSSHUsingPrivateKey(tt.remoteCommand, tt.remoteServer)
+			got, err := ExecuteRemoteCommandViaSSH(tt.remoteCommand, tt.remoteServer)
 			wantErr := len(tt.wantErrMsg) > 0
 			if (err != nil) != wantErr {
-				t.Errorf("executeRemoteCommandViaSSHUsingPrivateKey() error = %v, wantErr %v", err, wantErr)
+				t.Errorf("ExecuteRemoteCommandViaSSH() error = %v, wantErr %v", err, wantErr)
 				return
 			}
 			if !test_utils.WantErrorContainsStringIfNonEmptyOtherWiseNoError(t, err, tt.wantErrMsg) {
@@ -300,6 +300,9 @@ func Test_executeRemoteCommandViaSSH(t *testing.T) {
 				Host:     "192.168.0.1a9",
 				Port:     "22222",
 				Username: "test",
+				HostKeyPolicy: &types.SshHostKeyPolicy{
+					Type: types.SshHostKeyPolicyInsecure,
+				},
 			},
 			auth:       privateKeyAuth(),
 			wantErrMsg: "failed to connect to remote server",
@@ -3,6 +3,8 @@ package utils
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -26,6 +28,31 @@ func DiffMs(previous int64) int64 {
 	return NowMs() - previous
 }
 
+// FormatDurationAutoUnit returns the duration in the most readable unit among ns, µs, ms and s, with at most 2 decimals.
+// Eg: 850ns, 12.5µs, 1.25ms, 3s
+func FormatDurationAutoUnit(d time.Duration) string {
+	if d < 0 {
+		return "-" + FormatDurationAutoUnit(-d)
+	}
+
+	var value float64
+	var unit string
+	switch {
+	case d < time.Microsecond:
+		return fmt.Sprintf("%dns", int64(d))
+	case d < time.Millisecond-5*time.Nanosecond: // would be rounded to 1000µs
+		value, unit = float64(d)/float64(time.Microsecond), "µs"
+	case d < time.Second-5*time.Microsecond: // would be rounded to 1000ms
+		value, unit = float64(d)/float64(time.Millisecond), "ms"
+	default:
+		value, unit = d.Seconds(), "s"
+	}
+
+	formatted := strconv.FormatFloat(value, 'f', 2, 64)
+	formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	return formatted + unit
+}
+
 // IsTimeNear returns true when t1 and t2, are the same time (maximum diff is offset), regardless timezone.
 // Eg: 03:00:00 UTC+0000 is equals to 10:00:00 UTC+0700
 func IsTimeNear(t1, t2 time.Time, offsetDuration time.Duration) bool {
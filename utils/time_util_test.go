@@ -176,3 +176,30 @@ func TestIsTimeNear(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatDurationAutoUnit(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 0, want: "0ns"},
+		{d: 850 * time.Nanosecond, want: "850ns"},
+		{d: time.Microsecond, want: "1µs"},
+		{d: 12500 * time.Nanosecond, want: "12.5µs"},
+		{d: 999994 * time.Nanosecond, want: "999.99µs"},
+		{d: 999995 * time.Nanosecond, want: "1ms"},
+		{d: 1250 * time.Microsecond, want: "1.25ms"},
+		{d: 1234567 * time.Nanosecond, want: "1.23ms"},
+		{d: 999999 * time.Microsecond, want: "1s"},
+		{d: 3 * time.Second, want: "3s"},
+		{d: 90 * time.Second, want: "90s"},
+		{d: -1500 * time.Microsecond, want: "-1.5ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := FormatDurationAutoUnit(tt.d); got != tt.want {
+				t.Errorf("FormatDurationAutoUnit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}